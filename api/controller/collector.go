@@ -1,12 +1,21 @@
 package controller
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
-	"viot/pkg/processor"
+	"viot/api/middleware"
 	"viot/logger"
 	"viot/models"
+	"viot/pkg/collector/core"
+	"viot/pkg/collector/parsers"
+	"viot/pkg/processor"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -18,46 +27,273 @@ type TelegrafController struct {
 	logger     logger.Logger
 	lastError  error
 	lastAccess time.Time
+	status     sync.Mutex // 保護 lastError 與 lastAccess，接收端點與隊列工作協程會同時更新
+	queue      *core.IngestQueue
+	decoder    *middleware.RequestDecoder
+	sources    *core.SourceTracker
+	dedup      *core.Deduplicator
+	auth       *middleware.IngestAuth
+
+	process func(point *models.RestAPIPoint) error // 處理單個數據點，默認為收集器的 ProcessSinglePoint
 }
 
 // NewTelegrafController 創建一個新的Telegraf控制器
-func NewTelegrafController(collector *processor.Collector, log logger.Logger) *TelegrafController {
-	return &TelegrafController{
+// 接收隊列依 config 的 buffer 與 manager.queue 設置創建並啟動，請求大小上限取自 ingest.max_body_size，
+// config 為 nil 或未設置時使用默認值
+func NewTelegrafController(collector *processor.Collector, config *models.CollectorConfig, log logger.Logger) *TelegrafController {
+	var maxBodySize int64
+	if config != nil {
+		maxBodySize = config.Ingest.MaxBodySize
+	}
+
+	tc := &TelegrafController{
 		collector:  collector,
 		logger:     log.Named("telegraf-controller"),
 		lastError:  nil,
 		lastAccess: time.Now(),
+		decoder:    middleware.NewRequestDecoder(maxBodySize),
+		sources:    core.NewSourceTracker(),
+		dedup:      core.NewDeduplicator(config),
+		auth:       middleware.NewIngestAuth(log),
+		process:    collector.ProcessSinglePoint,
+	}
+
+	if config != nil {
+		auth := config.Ingest.Auth
+		if err := tc.auth.SetCredentialsFile(auth.CredentialsFile, auth.CheckInterval); err != nil {
+			// 驗證仍為啟用狀態且無可用憑證，接收端點拒絕所有請求直至文件可正確載入
+			tc.logger.Error("載入接收憑證失敗，接收端點將拒絕所有請求",
+				zap.String("path", auth.CredentialsFile),
+				zap.Error(err))
+		}
+	}
+
+	// 隊列在 Close 時停止並處理完剩餘數據，不跟隨請求或其他上下文結束
+	tc.queue = core.NewIngestQueue(config, tc, log)
+	tc.queue.Start(context.Background())
+	return tc
+}
+
+// Close 停止接收隊列，等待已入隊（已返回 202）的數據處理完成，之後入隊的請求返回 503
+// 應在 HTTP 服務器停止接收請求後調用（見 router.Router.Shutdown）
+func (tc *TelegrafController) Close() error {
+	if tc.queue != nil {
+		return tc.queue.Stop()
 	}
+	return nil
+}
+
+// HandleData 處理接收隊列交付的數據點，實現 core.DataHandler
+func (tc *TelegrafController) HandleData(ctx context.Context, points []models.RestAPIPoint) error {
+	var firstErr error
+	failed := 0
+	for i := range points {
+		if err := tc.process(&points[i]); err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if firstErr != nil {
+		tc.setLastError(firstErr)
+		return fmt.Errorf("%d 個數據點處理失敗: %w", failed, firstErr)
+	}
+	return nil
+}
+
+// RequestDecoder 返回接收端點使用的請求解碼器（gzip/deflate 解壓與大小限制）
+func (tc *TelegrafController) RequestDecoder() *middleware.RequestDecoder {
+	return tc.decoder
+}
+
+// IngestAuth 返回接收端點使用的代理驗證器
+func (tc *TelegrafController) IngestAuth() *middleware.IngestAuth {
+	return tc.auth
 }
 
 // ReceiveTelegrafData 接收來自Telegraf的數據
 func (tc *TelegrafController) ReceiveTelegrafData(c *gin.Context) {
-	tc.lastAccess = time.Now()
+	tc.touch()
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		tc.setLastError(err)
+		tc.logger.Error("讀取Telegraf數據失敗", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
 
-	// 從請求正文中讀取數據
-	err := tc.collector.ProcessDataFromReader(c.Request.Body)
+	// Telegraf outputs.http 的 data_format = "json" 原生格式
+	if parsers.IsTelegrafJSON(body) {
+		tc.receiveTelegrafJSON(c, body)
+		return
+	}
+
+	points, err := parsers.ParseRestAPIJSON(body)
 	if err != nil {
-		tc.lastError = err
-		tc.logger.Error("處理Telegraf數據失敗", zap.Error(err))
+		tc.setLastError(err)
+		tc.sources.RecordRejected(c.ClientIP(), nil, 0, err)
+		tc.logger.Error("解析Telegraf數據失敗", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error":   err.Error(),
 		})
 		return
 	}
+	agent := identifyAgent(c, points)
+
+	total := len(points)
+	points = tc.deduplicate(points)
+	duplicates := total - len(points)
+	if len(points) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success":    true,
+			"duplicates": duplicates,
+		})
+		return
+	}
+
+	// 啟用接收隊列時非同步處理
+	if tc.queue != nil {
+		if status, err := tc.enqueue(c, agent, points); err != nil {
+			c.JSON(status, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"success":    true,
+			"queued":     len(points),
+			"duplicates": duplicates,
+		})
+		return
+	}
+
+	for i := range points {
+		if err := tc.process(&points[i]); err != nil {
+			tc.setLastError(err)
+			if i > 0 {
+				tc.sources.RecordAccepted(agent, points[:i])
+			}
+			tc.sources.RecordRejected(agent, points[i:], 0, err)
+			tc.forget(points[i:])
+			tc.logger.Error("處理Telegraf數據失敗", zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+	tc.sources.RecordAccepted(agent, points)
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
+		"success":    true,
+		"duplicates": duplicates,
+	})
+}
+
+// receiveTelegrafJSON 處理 Telegraf 原生 JSON 批次，回報每個被拒絕指標的原因
+func (tc *TelegrafController) receiveTelegrafJSON(c *gin.Context, body []byte) {
+	units, err := parsers.ParseTimestampUnits(c.Query("json_timestamp_units"))
+	if err != nil {
+		tc.setLastError(err)
+		tc.sources.RecordRejected(c.ClientIP(), nil, 0, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	batch, err := parsers.ParseTelegrafJSON(body, units)
+	if err != nil {
+		tc.setLastError(err)
+		tc.sources.RecordRejected(c.ClientIP(), nil, 0, err)
+		tc.logger.Error("解析Telegraf JSON失敗", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	agent := identifyAgent(c, batch.Points)
+	if len(batch.Rejections) > 0 {
+		tc.sources.RecordRejected(agent, nil, len(batch.Rejections),
+			fmt.Errorf("%s", batch.Rejections[0].Error))
+	}
+	duplicates := tc.deduplicateBatch(batch)
+
+	// 啟用接收隊列時整批入隊，隊列已滿則讓 Telegraf 稍後重試整批
+	if tc.queue != nil && len(batch.Points) > 0 {
+		if status, err := tc.enqueue(c, agent, batch.Points); err != nil {
+			c.JSON(status, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"success":    true,
+			"accepted":   len(batch.Points),
+			"rejected":   batch.Rejections,
+			"duplicates": duplicates,
+		})
+		return
+	}
+
+	accepted := make([]models.RestAPIPoint, 0, len(batch.Points))
+	for i := range batch.Points {
+		if err := tc.process(&batch.Points[i]); err != nil {
+			tc.setLastError(err)
+			tc.sources.RecordRejected(agent, batch.Points[i:i+1], 1, err)
+			tc.forget(batch.Points[i : i+1])
+			tc.logger.Error("處理Telegraf指標失敗",
+				zap.String("metric", batch.Points[i].Metric),
+				zap.Error(err))
+			batch.Reject(batch.Indexes[i], batch.Points[i].Metric, err)
+			continue
+		}
+		accepted = append(accepted, batch.Points[i])
+	}
+	if len(accepted) > 0 {
+		tc.sources.RecordAccepted(agent, accepted)
+	}
+
+	if len(batch.Rejections) > 0 {
+		tc.logger.Warn("部分Telegraf指標被拒絕",
+			zap.Int("accepted", len(accepted)),
+			zap.Int("rejected", len(batch.Rejections)))
+	}
+
+	// 全部被拒絕時返回 400，避免 Telegraf 對格式錯誤的批次無限重試
+	status := http.StatusOK
+	if len(accepted) == 0 && duplicates == 0 && len(batch.Rejections) > 0 {
+		status = http.StatusBadRequest
+	}
+
+	c.JSON(status, gin.H{
+		"success":    status == http.StatusOK,
+		"accepted":   len(accepted),
+		"rejected":   batch.Rejections,
+		"duplicates": duplicates,
 	})
 }
 
 // ReceiveTelegrafMetric 接收單個Telegraf指標
 func (tc *TelegrafController) ReceiveTelegrafMetric(c *gin.Context) {
-	tc.lastAccess = time.Now()
+	tc.touch()
 
 	var point models.RestAPIPoint
 	if err := c.BindJSON(&point); err != nil {
-		tc.lastError = err
+		tc.setLastError(err)
+		tc.sources.RecordRejected(c.ClientIP(), nil, 1, err)
 		tc.logger.Error("解析Telegraf指標失敗", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -66,9 +302,41 @@ func (tc *TelegrafController) ReceiveTelegrafMetric(c *gin.Context) {
 		return
 	}
 
-	err := tc.collector.ProcessSinglePoint(&point)
+	// 與 ViOT JSON 相同，沒有時間戳的指標使用接收時間
+	if point.Timestamp.IsZero() {
+		point.Timestamp = time.Now()
+	}
+
+	points := []models.RestAPIPoint{point}
+	agent := identifyAgent(c, points)
+
+	if len(tc.deduplicate(points)) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"duplicate": true,
+		})
+		return
+	}
+
+	if tc.queue != nil {
+		if status, err := tc.enqueue(c, agent, points); err != nil {
+			c.JSON(status, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"success": true,
+		})
+		return
+	}
+
+	err := tc.process(&point)
 	if err != nil {
-		tc.lastError = err
+		tc.setLastError(err)
+		tc.sources.RecordRejected(agent, points, 1, err)
+		tc.forget(points)
 		tc.logger.Error("處理Telegraf指標失敗", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -76,29 +344,311 @@ func (tc *TelegrafController) ReceiveTelegrafMetric(c *gin.Context) {
 		})
 		return
 	}
+	tc.sources.RecordAccepted(agent, points)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 	})
 }
 
+// SetIngestQueue 替換接收隊列並停止原有隊列，為 nil 時在請求內同步處理
+func (tc *TelegrafController) SetIngestQueue(queue *core.IngestQueue) {
+	if tc.queue != nil && tc.queue != queue {
+		tc.queue.Stop()
+	}
+	tc.queue = queue
+}
+
+// enqueue 將數據點放入接收隊列，失敗時返回應回應的 HTTP 狀態碼與錯誤：
+// 隊列已滿時設置 Retry-After 標頭並返回 429；批次大於隊列總容量時重試也無法入隊，返回 413
+func (tc *TelegrafController) enqueue(c *gin.Context, agent string, points []models.RestAPIPoint) (int, error) {
+	if err := tc.queue.Enqueue(points); err != nil {
+		tc.setLastError(err)
+		tc.sources.RecordRejected(agent, points, len(points), err)
+		tc.forget(points)
+		if errors.Is(err, core.ErrQueueClosed) {
+			// 服務正在關閉，Telegraf 稍後重試時由重新啟動的服務接收
+			return http.StatusServiceUnavailable, err
+		}
+		if errors.Is(err, core.ErrBatchTooLarge) {
+			tc.logger.Warn("批次超過接收隊列容量，要求Telegraf減小批次",
+				zap.Int("points", len(points)),
+				zap.Int("capacity", tc.queue.Stats().Capacity))
+			return http.StatusRequestEntityTooLarge, err
+		}
+		retryAfter := int(tc.queue.RetryAfter().Seconds())
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		tc.logger.Warn("接收隊列已滿，要求Telegraf稍後重試",
+			zap.Int("points", len(points)),
+			zap.Int("retry_after", retryAfter))
+		return http.StatusTooManyRequests, err
+	}
+	tc.sources.RecordAccepted(agent, points)
+	return http.StatusAccepted, nil
+}
+
+// deduplicate 過濾去重窗口內已接收過的數據點
+func (tc *TelegrafController) deduplicate(points []models.RestAPIPoint) []models.RestAPIPoint {
+	if tc.dedup == nil {
+		return points
+	}
+
+	unique := tc.dedup.Filter(points)
+	if len(unique) < len(points) {
+		tc.logger.Debug("過濾重複數據點",
+			zap.Int("duplicates", len(points)-len(unique)),
+			zap.Int("total", len(points)))
+	}
+	return unique
+}
+
+// deduplicateBatch 過濾 Telegraf JSON 批次中的重複數據點並保持原始位置對應，返回重複數
+func (tc *TelegrafController) deduplicateBatch(batch *parsers.TelegrafBatch) int {
+	if tc.dedup == nil {
+		return 0
+	}
+
+	flags := tc.dedup.Check(batch.Points)
+	points := batch.Points[:0]
+	indexes := batch.Indexes[:0]
+	duplicates := 0
+	for i, duplicate := range flags {
+		if duplicate {
+			duplicates++
+			continue
+		}
+		points = append(points, batch.Points[i])
+		indexes = append(indexes, batch.Indexes[i])
+	}
+	batch.Points = points
+	batch.Indexes = indexes
+
+	if duplicates > 0 {
+		tc.logger.Debug("過濾重複Telegraf指標", zap.Int("duplicates", duplicates))
+	}
+	return duplicates
+}
+
+// forget 數據未被接收時移除去重記錄，使 Telegraf 重送時能再次接收
+func (tc *TelegrafController) forget(points []models.RestAPIPoint) {
+	if tc.dedup != nil {
+		tc.dedup.Forget(points)
+	}
+}
+
+// identifyAgent 取得數據來源的 Telegraf 代理名稱
+// 通過接收驗證的請求以驗證身份為準，並以 agent 標籤標記每個數據點；
+// 未啟用驗證時優先使用 host 標籤，否則使用客戶端 IP
+func identifyAgent(c *gin.Context, points []models.RestAPIPoint) string {
+	if agent := c.GetString(middleware.IngestAgentKey); agent != "" {
+		for i := range points {
+			if points[i].Tags == nil {
+				points[i].Tags = make(map[string]string)
+			}
+			points[i].Tags["agent"] = agent
+		}
+		return agent
+	}
+
+	for _, point := range points {
+		if host := point.Tags["host"]; host != "" {
+			return host
+		}
+	}
+	return c.ClientIP()
+}
+
+// ReceiveInfluxWrite 接收 Telegraf outputs.influxdb_v2 推送的行協議數據
+func (tc *TelegrafController) ReceiveInfluxWrite(c *gin.Context) {
+	tc.touch()
+
+	if c.Query("bucket") == "" {
+		influxError(c, http.StatusBadRequest, "invalid", "bucket not specified")
+		return
+	}
+
+	precision, err := parsers.ParsePrecision(c.Query("precision"))
+	if err != nil {
+		tc.setLastError(err)
+		influxError(c, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		tc.setLastError(err)
+		tc.logger.Error("讀取行協議數據失敗", zap.Error(err))
+		influxError(c, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	points, err := parsers.ParseLineProtocol(body, precision)
+	if err != nil {
+		tc.setLastError(err)
+		tc.sources.RecordRejected(c.ClientIP(), nil, 0, err)
+		tc.logger.Error("解析行協議數據失敗",
+			zap.String("org", c.Query("org")),
+			zap.String("bucket", c.Query("bucket")),
+			zap.Error(err))
+		influxError(c, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	agent := identifyAgent(c, points)
+
+	points = tc.deduplicate(points)
+	if len(points) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	if tc.queue != nil {
+		if status, err := tc.enqueue(c, agent, points); err != nil {
+			code := "too many requests"
+			switch status {
+			case http.StatusRequestEntityTooLarge:
+				code = "request too large"
+			case http.StatusServiceUnavailable:
+				code = "unavailable"
+			}
+			influxError(c, status, code, err.Error())
+			return
+		}
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	// 與接收隊列相同，個別數據點處理失敗不影響其他數據點；已有數據點被接收時返回 204，
+	// 避免 Telegraf 丟棄或重送部分已套用的批次
+	accepted := make([]models.RestAPIPoint, 0, len(points))
+	var firstErr error
+	for i := range points {
+		if err := tc.process(&points[i]); err != nil {
+			tc.setLastError(err)
+			tc.sources.RecordRejected(agent, points[i:i+1], 1, err)
+			tc.forget(points[i : i+1])
+			tc.logger.Error("處理行協議數據點失敗",
+				zap.String("metric", points[i].Metric),
+				zap.Error(err))
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		accepted = append(accepted, points[i])
+	}
+
+	if len(accepted) == 0 {
+		influxError(c, http.StatusBadRequest, "invalid", firstErr.Error())
+		return
+	}
+	tc.sources.RecordAccepted(agent, accepted)
+	if firstErr != nil {
+		tc.logger.Warn("部分行協議數據點處理失敗",
+			zap.Int("accepted", len(accepted)),
+			zap.Int("rejected", len(points)-len(accepted)))
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// influxError 以 InfluxDB v2 的錯誤格式回應，讓 Telegraf 能正確判斷是否重試
+func influxError(c *gin.Context, status int, code, message string) {
+	c.JSON(status, gin.H{
+		"code":    code,
+		"message": message,
+	})
+}
+
 // GetCollectorStats 獲取收集器處理統計
 func (tc *TelegrafController) GetCollectorStats(c *gin.Context) {
 	stats := tc.collector.GetStats()
 
-	c.JSON(http.StatusOK, gin.H{
+	errorMessage := tc.getLastErrorMessage()
+	tc.status.Lock()
+	lastAccess := tc.lastAccess
+	tc.status.Unlock()
+
+	result := gin.H{
 		"success": true,
 		"stats":   stats,
 		"status": gin.H{
-			"last_access": tc.lastAccess,
-			"error":       tc.lastError != nil,
-			"error_msg":   tc.getLastErrorMessage(),
+			"last_access": lastAccess,
+			"error":       errorMessage != "",
+			"error_msg":   errorMessage,
 		},
+	}
+	if tc.queue != nil {
+		result["queue"] = tc.queue.Stats()
+	}
+	result["request_decoder"] = tc.decoder.Stats()
+	result["sources"] = tc.sources.Summary()
+	if tc.dedup != nil {
+		result["dedup"] = tc.dedup.Stats()
+	}
+	result["ingest_auth"] = tc.auth.Stats()
+
+	c.JSON(http.StatusOK, result)
+}
+
+// maxSourcesPage /api/telegraf/sources 可請求的最大頁碼
+const maxSourcesPage = 1000000
+
+// GetSources 分頁列出各 Telegraf 代理與設備的接收統計，最久未出現的來源排在最前
+func (tc *TelegrafController) GetSources(c *gin.Context) {
+	sourceType := c.Query("type")
+	if sourceType != "" && sourceType != core.SourceTypeAgent && sourceType != core.SourceTypeDevice {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   fmt.Sprintf("無效的來源類型: %s", sourceType),
+		})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	if page > maxSourcesPage {
+		page = maxSourcesPage
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if err != nil || pageSize < 1 {
+		pageSize = 50
+	}
+	if pageSize > 500 {
+		pageSize = 500
+	}
+
+	sources, total := tc.sources.List(sourceType, page, pageSize)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+		"sources":   sources,
 	})
 }
 
+// touch 記錄接收端點最後被訪問的時間
+func (tc *TelegrafController) touch() {
+	tc.status.Lock()
+	defer tc.status.Unlock()
+	tc.lastAccess = time.Now()
+}
+
+// setLastError 記錄最後的錯誤
+func (tc *TelegrafController) setLastError(err error) {
+	tc.status.Lock()
+	defer tc.status.Unlock()
+	tc.lastError = err
+}
+
 // getLastErrorMessage 獲取最後的錯誤消息
 func (tc *TelegrafController) getLastErrorMessage() string {
+	tc.status.Lock()
+	defer tc.status.Unlock()
 	if tc.lastError == nil {
 		return ""
 	}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"viot/logger"
+	"viot/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordingProcessor 記錄交給收集器的數據點，指定的指標處理失敗
+type recordingProcessor struct {
+	mutex  sync.Mutex
+	points []models.RestAPIPoint
+	fail   map[string]bool
+}
+
+func (p *recordingProcessor) process(point *models.RestAPIPoint) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.fail[point.Metric] {
+		return errors.New("處理失敗")
+	}
+	p.points = append(p.points, *point)
+	return nil
+}
+
+func (p *recordingProcessor) processed() []models.RestAPIPoint {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]models.RestAPIPoint(nil), p.points...)
+}
+
+// newTestIngestRouter 創建同步處理數據點的控制器與接收路由
+func newTestIngestRouter(t *testing.T, processor *recordingProcessor) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	tc := NewTelegrafController(nil, nil, logger.DefaultLogger)
+	tc.SetIngestQueue(nil)
+	tc.process = processor.process
+	t.Cleanup(func() { tc.Close() })
+
+	router := gin.New()
+	router.POST("/api/v2/write", tc.RequestDecoder().Handler(), tc.ReceiveInfluxWrite)
+	router.POST("/api/telegraf/metric", tc.ReceiveTelegrafMetric)
+	return router
+}
+
+func postInflux(router *gin.Engine, query string, body []byte, encoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/write?"+query, bytes.NewReader(body))
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestReceiveInfluxWriteGzip(t *testing.T) {
+	processor := &recordingProcessor{}
+	router := newTestIngestRouter(t, processor)
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write([]byte("pdu,host=pdu-01 current=12.5 1700000000123\npdu,host=pdu-02 current=3 1700000000456\n"))
+	zw.Close()
+
+	w := postInflux(router, "org=viot&bucket=raw&precision=ms", body.Bytes(), "gzip")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("應返回 204，實際為 %d: %s", w.Code, w.Body)
+	}
+
+	points := processor.processed()
+	if len(points) != 2 {
+		t.Fatalf("應處理 2 個數據點，實際為 %d", len(points))
+	}
+	if points[0].Tags["host"] != "pdu-01" || points[0].Fields["current"] != 12.5 {
+		t.Errorf("數據點不正確: %+v", points[0])
+	}
+	if want := time.UnixMilli(1700000000123); !points[0].Timestamp.Equal(want) {
+		t.Errorf("時間戳應為 %v，實際為 %v", want, points[0].Timestamp)
+	}
+}
+
+func TestReceiveInfluxWriteRejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		body  string
+	}{
+		{"缺少 bucket", "org=viot", "pdu current=1"},
+		{"不支援的精度", "bucket=raw&precision=h", "pdu current=1"},
+		{"格式錯誤的行", "bucket=raw", "pdu current=1\npdu current="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := &recordingProcessor{}
+			router := newTestIngestRouter(t, processor)
+
+			w := postInflux(router, tt.query, []byte(tt.body), "")
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("應返回 400，實際為 %d: %s", w.Code, w.Body)
+			}
+			if got := len(processor.processed()); got != 0 {
+				t.Errorf("整批被拒絕時不應處理任何數據點，實際處理了 %d 個", got)
+			}
+		})
+	}
+}
+
+func TestReceiveInfluxWritePartialFailure(t *testing.T) {
+	processor := &recordingProcessor{fail: map[string]bool{"bad": true}}
+	router := newTestIngestRouter(t, processor)
+
+	// 部分數據點已被接收時返回 204，Telegraf 不重送整批
+	body := "pdu current=1 1700000000\nbad current=2 1700000000\npdu current=3 1700000001\n"
+	w := postInflux(router, "bucket=raw&precision=s", []byte(body), "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("部分失敗時應返回 204，實際為 %d: %s", w.Code, w.Body)
+	}
+	points := processor.processed()
+	if len(points) != 2 || points[0].Fields["current"] != 1.0 || points[1].Fields["current"] != 3.0 {
+		t.Fatalf("失敗的數據點之後的數據點仍應被處理，實際為 %+v", points)
+	}
+
+	// 全部失敗時返回 400
+	w = postInflux(router, "bucket=raw&precision=s", []byte("bad current=4 1700000002\n"), "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("全部失敗時應返回 400，實際為 %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestReceiveTelegrafMetricWithoutTimestamp(t *testing.T) {
+	processor := &recordingProcessor{}
+	router := newTestIngestRouter(t, processor)
+
+	// 沒有時間戳的相同讀數是不同時間的讀數，不應被去重
+	body := []byte(`{"metric":"pdu","tags":{"host":"pdu-01"},"fields":{"current":1}}`)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/telegraf/metric", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || bytes.Contains(w.Body.Bytes(), []byte("duplicate")) {
+			t.Fatalf("第 %d 次請求應被接收，實際為 %d: %s", i+1, w.Code, w.Body)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	points := processor.processed()
+	if len(points) != 2 {
+		t.Fatalf("應處理 2 個數據點，實際為 %d", len(points))
+	}
+	if points[0].Timestamp.IsZero() {
+		t.Error("沒有時間戳的指標應使用接收時間")
+	}
+}
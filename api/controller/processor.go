@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"net/http"
+
+	"viot/api/response"
+	"viot/logger"
+	"viot/pkg/processor"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProcessorController 處理數據處理器相關的 API 請求
+type ProcessorController struct {
+	processorManager *processor.ProcessorManager
+	pduMetrics       *processor.PrometheusOutputHandler
+	logger           logger.Logger
+}
+
+// NewProcessorController 創建一個新的處理器控制器
+func NewProcessorController(processorManager *processor.ProcessorManager, logger logger.Logger) *ProcessorController {
+	return &ProcessorController{
+		processorManager: processorManager,
+		logger:           logger.Named("processor-controller"),
+	}
+}
+
+// SetPDUMetrics 設置提供 /metrics/pdu 的 Prometheus 輸出處理程序，處理程序需同時註冊到輸出路由器
+func (c *ProcessorController) SetPDUMetrics(handler *processor.PrometheusOutputHandler) {
+	c.pduMetrics = handler
+}
+
+// GetUnmatchedFields 獲取無法解析的PDU字段
+// @Summary 獲取無法解析的PDU字段
+// @Description 列出各PDU處理器中沒有字段規則匹配或範圍尚未支援的字段，用於修正型號描述檔
+// @Tags Processor
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /api/processor/fields/unmatched [get]
+func (c *ProcessorController) GetUnmatchedFields(ctx *gin.Context) {
+	response.Success(ctx, "獲取未匹配字段成功", c.processorManager.UnmatchedFields())
+}
+
+// ResetUnmatchedFields 清除字段診斷記錄
+// @Summary 清除字段診斷記錄
+// @Description 修正型號描述檔後清除記錄，重新觀察未匹配字段
+// @Tags Processor
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /api/processor/fields/unmatched [delete]
+func (c *ProcessorController) ResetUnmatchedFields(ctx *gin.Context) {
+	c.processorManager.ResetFieldDiagnostics()
+	c.logger.Info("已清除字段診斷記錄")
+	response.Success(ctx, "已清除字段診斷記錄", nil)
+}
+
+// GetLatestPDUData 獲取各設備最近一次處理的 PDU 數據
+// @Summary 獲取最近的 PDU 讀數
+// @Description 列出各設備最近一次處理的 PDU 數據，含相位、分支與插座
+// @Tags Processor
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /api/processor/pdu [get]
+func (c *ProcessorController) GetLatestPDUData(ctx *gin.Context) {
+	response.Success(ctx, "獲取 PDU 讀數成功", c.processorManager.LatestPDUData())
+}
+
+// GetPDUOutlets 獲取指定設備的插座數據
+// @Summary 獲取 PDU 插座數據
+// @Description 獲取指定設備最近一次處理的插座電流、功率、能耗與開關狀態
+// @Tags Processor
+// @Accept json
+// @Produce json
+// @Param device path string true "設備（device 標籤、IP 或名稱）"
+// @Success 200 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /api/processor/pdu/{device}/outlets [get]
+func (c *ProcessorController) GetPDUOutlets(ctx *gin.Context) {
+	device := ctx.Param("device")
+	pdu, ok := c.processorManager.FindPDUData(device)
+	if !ok {
+		response.Fail(ctx, http.StatusNotFound, "找不到設備的 PDU 讀數", device)
+		return
+	}
+
+	response.Success(ctx, "獲取插座數據成功", gin.H{
+		"device":    device,
+		"timestamp": pdu.Timestamp,
+		"outlets":   pdu.Outlets,
+	})
+}
+
+// GetPipelineStatus 獲取處理管線狀態
+// @Summary 獲取處理管線狀態
+// @Description 依執行順序列出處理管線各階段的啟用狀態、輸入輸出數、丟棄數、錯誤與平均耗時
+// @Tags Processor
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Router /api/processor/pipeline [get]
+func (c *ProcessorController) GetPipelineStatus(ctx *gin.Context) {
+	response.Success(ctx, "獲取處理管線狀態成功", c.processorManager.PipelineStatus())
+}
+
+// ReloadPipeline 重新載入處理管線配置
+// @Summary 重新載入處理管線
+// @Description 重新讀取處理管線配置文件，載入失敗時保留原有管線
+// @Tags Processor
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Router /api/processor/pipeline/reload [post]
+func (c *ProcessorController) ReloadPipeline(ctx *gin.Context) {
+	if err := c.processorManager.ReloadPipeline(); err != nil {
+		response.Fail(ctx, http.StatusBadRequest, "重新載入處理管線失敗", err.Error())
+		return
+	}
+
+	c.logger.Info("處理管線已重新載入")
+	response.Success(ctx, "處理管線已重新載入", c.processorManager.PipelineStatus())
+}
+
+// GetOutputStatus 獲取輸出路由器狀態
+// @Summary 獲取輸出處理程序狀態
+// @Description 依註冊順序列出各輸出處理程序的斷路器狀態、隊列深度、交付、失敗、丟棄數與交付耗時
+// @Tags Processor
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /api/processor/outputs [get]
+func (c *ProcessorController) GetOutputStatus(ctx *gin.Context) {
+	status, ok := c.processorManager.OutputStatus()
+	if !ok {
+		response.Fail(ctx, http.StatusNotFound, "未設置輸出路由器", "")
+		return
+	}
+	response.Success(ctx, "獲取輸出處理程序狀態成功", status)
+}
+
+// GetPDUMetrics 以 Prometheus 文本格式返回最近的 PDU 讀數
+// @Summary 獲取 PDU Prometheus 指標
+// @Description 以 Prometheus 文本格式返回各設備最近一次處理的總體、相位與分支電流、電壓、功率與能耗，超過最長時間沒有新數據的設備不輸出
+// @Tags Processor
+// @Produce plain
+// @Success 200 {string} string
+// @Failure 404 {object} response.Response
+// @Router /metrics/pdu [get]
+func (c *ProcessorController) GetPDUMetrics(ctx *gin.Context) {
+	if c.pduMetrics == nil {
+		response.Fail(ctx, http.StatusNotFound, "未啟用 PDU 指標輸出", "")
+		return
+	}
+	c.pduMetrics.ServeHTTP(ctx.Writer, ctx.Request)
+}
@@ -0,0 +1,351 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"viot/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// 接收端點的 HMAC 簽名標頭
+const (
+	HeaderIngestAgent     = "X-ViOT-Agent"
+	HeaderIngestSignature = "X-ViOT-Signature"
+)
+
+// IngestAgentKey 驗證通過後代理名稱在 gin.Context 中的鍵
+const IngestAgentKey = "ingest_agent"
+
+// defaultCredentialsCheckInterval 檢查憑證文件是否變更的默認間隔
+const defaultCredentialsCheckInterval = 10 * time.Second
+
+// 驗證失敗原因
+var (
+	errMissingCredentials = errors.New("缺少接收憑證")
+	errInvalidToken       = errors.New("無效的令牌")
+	errUnknownAgent       = errors.New("未知或已停用的代理")
+	errInvalidSignature   = errors.New("簽名驗證失敗")
+)
+
+// IngestAgent 憑證文件中的單個代理
+type IngestAgent struct {
+	Name     string `yaml:"name"`
+	Token    string `yaml:"token"`    // Bearer 令牌
+	Secret   string `yaml:"secret"`   // HMAC-SHA256 簽名密鑰
+	Disabled bool   `yaml:"disabled"` // 停用後立即拒絕該代理
+}
+
+// ingestCredentials 憑證文件格式
+type ingestCredentials struct {
+	Agents []IngestAgent `yaml:"agents"`
+}
+
+// IngestAuthStats 接收驗證統計
+type IngestAuthStats struct {
+	Enabled       bool      `json:"enabled"`
+	Agents        int       `json:"agents"`
+	Authorized    int64     `json:"authorized"`
+	Failed        int64     `json:"failed"`
+	LastLoaded    time.Time `json:"last_loaded"`
+	LastLoadError string    `json:"last_load_error,omitempty"`
+}
+
+// IngestAuth Telegraf 接收端點的代理驗證，支援 Bearer 令牌與請求內容的 HMAC-SHA256 簽名
+// 憑證由 YAML 文件管理，文件變更後自動重新載入，無需重啟即可新增或撤銷代理；文件被刪除時拒絕所有請求
+type IngestAuth struct {
+	logger        logger.Logger
+	path          string
+	checkInterval time.Duration
+	tokens        map[[sha256.Size]byte]string // 令牌摘要 -> 代理名稱
+	secrets       map[string][]byte            // 代理名稱 -> 簽名密鑰
+	modTime       time.Time
+	lastCheck     time.Time
+	lastLoaded    time.Time
+	lastLoadError string
+	authorized    atomic.Int64
+	failed        atomic.Int64
+	mutex         sync.RWMutex
+}
+
+// NewIngestAuth 創建接收驗證器，未設置憑證文件時不驗證
+func NewIngestAuth(log logger.Logger) *IngestAuth {
+	return &IngestAuth{
+		logger:        log.Named("ingest-auth"),
+		checkInterval: defaultCredentialsCheckInterval,
+		tokens:        make(map[[sha256.Size]byte]string),
+		secrets:       make(map[string][]byte),
+	}
+}
+
+// SetCredentialsFile 設置憑證文件並立即載入，path 為空時關閉驗證
+func (a *IngestAuth) SetCredentialsFile(path string, checkInterval time.Duration) error {
+	a.mutex.Lock()
+	a.path = path
+	if checkInterval > 0 {
+		a.checkInterval = checkInterval
+	}
+	a.modTime = time.Time{}
+	a.mutex.Unlock()
+
+	if path == "" {
+		a.logger.Warn("未設置接收憑證文件，Telegraf 接收端點不進行驗證")
+		return nil
+	}
+	return a.Reload()
+}
+
+// Reload 重新載入憑證文件；載入失敗時保留原有憑證
+func (a *IngestAuth) Reload() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.load()
+}
+
+// Enabled 是否已啟用驗證
+func (a *IngestAuth) Enabled() bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.path != ""
+}
+
+// Stats 返回驗證統計
+func (a *IngestAuth) Stats() IngestAuthStats {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	agents := make(map[string]struct{})
+	for _, name := range a.tokens {
+		agents[name] = struct{}{}
+	}
+	for name := range a.secrets {
+		agents[name] = struct{}{}
+	}
+
+	return IngestAuthStats{
+		Enabled:       a.path != "",
+		Agents:        len(agents),
+		Authorized:    a.authorized.Load(),
+		Failed:        a.failed.Load(),
+		LastLoaded:    a.lastLoaded,
+		LastLoadError: a.lastLoadError,
+	}
+}
+
+// Handler 返回 ViOT 接收端點使用的 gin 中間件
+func (a *IngestAuth) Handler() gin.HandlerFunc {
+	return a.handler(func(c *gin.Context, err error) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+	})
+}
+
+// InfluxHandler 返回 InfluxDB v2 相容寫入端點使用的 gin 中間件，錯誤格式與 InfluxDB 一致
+func (a *IngestAuth) InfluxHandler() gin.HandlerFunc {
+	return a.handler(func(c *gin.Context, err error) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"code":    "unauthorized",
+			"message": err.Error(),
+		})
+	})
+}
+
+// handler 驗證請求並將代理名稱存入 gin.Context
+func (a *IngestAuth) handler(reject func(c *gin.Context, err error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.Enabled() {
+			c.Next()
+			return
+		}
+
+		a.refresh()
+
+		agent, err := a.authenticate(c.Request)
+		if err != nil {
+			a.failed.Add(1)
+			a.logger.Warn("接收端點驗證失敗",
+				zap.String("remote", c.ClientIP()),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("agent", c.GetHeader(HeaderIngestAgent)),
+				zap.Error(err))
+			reject(c, err)
+			return
+		}
+
+		a.authorized.Add(1)
+		c.Set(IngestAgentKey, agent)
+		c.Next()
+	}
+}
+
+// authenticate 依請求標頭選擇 HMAC 簽名或 Bearer 令牌驗證，返回代理名稱
+func (a *IngestAuth) authenticate(r *http.Request) (string, error) {
+	if signature := r.Header.Get(HeaderIngestSignature); signature != "" {
+		return a.verifySignature(r, r.Header.Get(HeaderIngestAgent), signature)
+	}
+
+	token := bearerToken(r.Header.Get("Authorization"))
+	if token == "" {
+		return "", errMissingCredentials
+	}
+
+	a.mutex.RLock()
+	agent, ok := a.tokens[sha256.Sum256([]byte(token))]
+	a.mutex.RUnlock()
+	if !ok {
+		return "", errInvalidToken
+	}
+	return agent, nil
+}
+
+// verifySignature 驗證 "sha256=<hex>" 格式的請求內容簽名，簽名針對解壓後的內容計算
+func (a *IngestAuth) verifySignature(r *http.Request, agent, signature string) (string, error) {
+	a.mutex.RLock()
+	secret, ok := a.secrets[agent]
+	a.mutex.RUnlock()
+	if !ok {
+		return "", errUnknownAgent
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return "", errInvalidSignature
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", fmt.Errorf("讀取請求內容失敗: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return "", errInvalidSignature
+	}
+	return agent, nil
+}
+
+// refresh 定期檢查憑證文件的修改時間，變更時重新載入
+func (a *IngestAuth) refresh() {
+	a.mutex.RLock()
+	due := time.Since(a.lastCheck) >= a.checkInterval
+	a.mutex.RUnlock()
+	if !due {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if time.Since(a.lastCheck) < a.checkInterval {
+		return
+	}
+	a.lastCheck = time.Now()
+
+	info, err := os.Stat(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		a.revoke(err)
+		return
+	}
+	if err != nil || info.ModTime().Equal(a.modTime) {
+		return
+	}
+	if err := a.load(); err != nil {
+		a.logger.Error("重新載入接收憑證失敗，沿用原有憑證", zap.Error(err))
+	}
+}
+
+// revoke 憑證文件被刪除時撤銷所有憑證，拒絕全部請求直至文件重新出現，調用方須持有寫鎖
+func (a *IngestAuth) revoke(err error) {
+	if len(a.tokens) == 0 && len(a.secrets) == 0 && a.modTime.IsZero() {
+		return
+	}
+
+	a.tokens = make(map[[sha256.Size]byte]string)
+	a.secrets = make(map[string][]byte)
+	a.modTime = time.Time{}
+	a.lastLoadError = err.Error()
+	a.logger.Error("接收憑證文件已被刪除，撤銷所有代理憑證", zap.String("path", a.path))
+}
+
+// load 讀取憑證文件並替換現有憑證，調用方須持有寫鎖
+func (a *IngestAuth) load() error {
+	a.lastCheck = time.Now()
+
+	info, err := os.Stat(a.path)
+	if err != nil {
+		a.lastLoadError = err.Error()
+		return fmt.Errorf("讀取憑證文件失敗: %w", err)
+	}
+
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		a.lastLoadError = err.Error()
+		return fmt.Errorf("讀取憑證文件失敗: %w", err)
+	}
+
+	var credentials ingestCredentials
+	if err := yaml.Unmarshal(data, &credentials); err != nil {
+		a.lastLoadError = err.Error()
+		return fmt.Errorf("解析憑證文件失敗: %w", err)
+	}
+
+	tokens := make(map[[sha256.Size]byte]string)
+	secrets := make(map[string][]byte)
+	for i, agent := range credentials.Agents {
+		if agent.Name == "" {
+			a.lastLoadError = fmt.Sprintf("第 %d 個代理缺少名稱", i)
+			return errors.New(a.lastLoadError)
+		}
+		if agent.Disabled {
+			continue
+		}
+		if agent.Token != "" {
+			tokens[sha256.Sum256([]byte(agent.Token))] = agent.Name
+		}
+		if agent.Secret != "" {
+			secrets[agent.Name] = []byte(agent.Secret)
+		}
+	}
+
+	a.tokens = tokens
+	a.secrets = secrets
+	a.modTime = info.ModTime()
+	a.lastLoaded = time.Now()
+	a.lastLoadError = ""
+
+	a.logger.Info("接收憑證已載入",
+		zap.String("path", a.path),
+		zap.Int("tokens", len(tokens)),
+		zap.Int("secrets", len(secrets)))
+	return nil
+}
+
+// bearerToken 從 "Bearer xxx" 或 InfluxDB 的 "Token xxx" 格式的 Authorization 標頭取出令牌
+func bearerToken(header string) string {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found {
+		return ""
+	}
+	if !strings.EqualFold(scheme, "Bearer") && !strings.EqualFold(scheme, "Token") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -1,8 +1,11 @@
 package router
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"viot/api/controller"
 	"viot/logger"
@@ -22,6 +25,7 @@ type Router struct {
 	dataCenterController *controller.DataCenterController
 	deployController     *controller.DeployController
 	telegrafController   *controller.TelegrafController
+	processorController  *controller.ProcessorController
 	config               config.Config
 	logger               logger.Logger
 	// Web 服務相關配置
@@ -30,13 +34,17 @@ type Router struct {
 	staticPath   string
 	templatePath string
 	configFile   string
+
+	server      *http.Server
+	serverMutex sync.Mutex
 }
 
-// NewRouter 創建一個新的路由器
+// NewRouter 創建一個新的路由器，processorController 為 nil 時不註冊處理器相關路由
 func NewRouter(
 	dataCenterController *controller.DataCenterController,
 	deployController *controller.DeployController,
 	telegrafController *controller.TelegrafController,
+	processorController *controller.ProcessorController,
 	config config.Config,
 	logger logger.Logger,
 ) *Router {
@@ -45,6 +53,7 @@ func NewRouter(
 		dataCenterController: dataCenterController,
 		deployController:     deployController,
 		telegrafController:   telegrafController,
+		processorController:  processorController,
 		config:               config,
 		logger:               logger.Named("router"),
 		// 默認 Web 配置
@@ -106,10 +115,33 @@ func (r *Router) setupAPIRoutes() {
 		api.GET("/devices", r.deployController.GetDevices)
 		api.POST("/devices/:ip/deploy", r.deployController.DeployDevice)
 
-		// Telegraf 數據相關路由
-		api.POST("/telegraf/data", r.telegrafController.ReceiveTelegrafData)
-		api.POST("/telegraf/metric", r.telegrafController.ReceiveTelegrafMetric)
+		// Telegraf 數據相關路由，接收端點透明解壓 gzip/deflate 並限制請求大小，
+		// 解壓後驗證代理令牌或請求內容簽名
+		decode := r.telegrafController.RequestDecoder().Handler()
+		auth := r.telegrafController.IngestAuth()
+		api.POST("/telegraf/data", decode, auth.Handler(), r.telegrafController.ReceiveTelegrafData)
+		api.POST("/telegraf/metric", decode, auth.Handler(), r.telegrafController.ReceiveTelegrafMetric)
 		api.GET("/telegraf/stats", r.telegrafController.GetCollectorStats)
+		api.GET("/telegraf/sources", r.telegrafController.GetSources)
+
+		// InfluxDB v2 相容寫入端點，供 Telegraf outputs.influxdb_v2 直接推送
+		api.POST("/v2/write", decode, auth.InfluxHandler(), r.telegrafController.ReceiveInfluxWrite)
+
+		// 處理器讀數與診斷相關路由
+		if r.processorController != nil {
+			api.GET("/processor/fields/unmatched", r.processorController.GetUnmatchedFields)
+			api.DELETE("/processor/fields/unmatched", r.processorController.ResetUnmatchedFields)
+			api.GET("/processor/pdu", r.processorController.GetLatestPDUData)
+			api.GET("/processor/pdu/:device/outlets", r.processorController.GetPDUOutlets)
+			api.GET("/processor/pipeline", r.processorController.GetPipelineStatus)
+			api.POST("/processor/pipeline/reload", r.processorController.ReloadPipeline)
+			api.GET("/processor/outputs", r.processorController.GetOutputStatus)
+		}
+	}
+
+	// Prometheus 抓取端點
+	if r.processorController != nil {
+		r.engine.GET("/metrics/pdu", r.processorController.GetPDUMetrics)
 	}
 }
 
@@ -152,10 +184,39 @@ func (r *Router) setupWebRoutes() {
 	r.logger.Info("Web 路由設置完成")
 }
 
-// Run 啟動 HTTP 服務器
+// Run 啟動 HTTP 服務器，直至 Shutdown 被調用
 func (r *Router) Run(addr string) error {
 	r.logger.Info("啟動 HTTP 服務器", logger.String("addr", addr))
-	return r.engine.Run(addr)
+
+	server := &http.Server{Addr: addr, Handler: r.engine}
+	r.serverMutex.Lock()
+	r.server = server
+	r.serverMutex.Unlock()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown 停止接收新請求並等待進行中的請求完成，之後關閉 Telegraf 控制器，
+// 處理完接收隊列中已返回 202 的數據
+func (r *Router) Shutdown(ctx context.Context) error {
+	r.serverMutex.Lock()
+	server := r.server
+	r.serverMutex.Unlock()
+
+	var err error
+	if server != nil {
+		err = server.Shutdown(ctx)
+	}
+	if r.telegrafController != nil {
+		if closeErr := r.telegrafController.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	r.logger.Info("HTTP 服務器已關閉")
+	return err
 }
 
 // GetEngine 獲取 Gin 引擎
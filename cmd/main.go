@@ -1 +1,6 @@
 package main
+
+import (
+	// 註冊 MQTT 訂閱輸入插件工廠
+	_ "viot/pkg/collector/inputs/mqtt"
+)
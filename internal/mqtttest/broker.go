@@ -0,0 +1,224 @@
+// Package mqtttest 提供測試用的嵌入式 MQTT 3.1.1 代理伺服器
+package mqtttest
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Message 代理伺服器收到的發布訊息
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+// Broker 測試用的嵌入式 MQTT 3.1.1 代理伺服器，只實現連線、發布確認、訂閱與 QoS 0 轉發
+// 停止確認時收到的 PUBLISH 不記錄、不轉發也不回覆 PUBACK，模擬連線未斷但發布逾時
+type Broker struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	conns    map[net.Conn][]string // 連線 -> 訂閱的主題過濾器
+	messages []Message
+	granted  []byte
+	noAck    bool
+}
+
+// Start 在 addr 啟動代理伺服器，addr 為空時監聽本機的隨機端口；測試結束時自動停止
+func Start(t testing.TB, addr string) *Broker {
+	t.Helper()
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("啟動測試代理伺服器失敗: %v", err)
+	}
+
+	b := &Broker{listener: listener, conns: make(map[net.Conn][]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			b.mutex.Lock()
+			b.conns[conn] = nil
+			b.mutex.Unlock()
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(b.Stop)
+	return b
+}
+
+// Addr 返回監聽地址
+func (b *Broker) Addr() string {
+	return b.listener.Addr().String()
+}
+
+// URL 返回客戶端使用的代理伺服器地址
+func (b *Broker) URL() string {
+	return "tcp://" + b.Addr()
+}
+
+// Stop 關閉監聽與所有連線，模擬代理伺服器停機
+func (b *Broker) Stop() {
+	b.listener.Close()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = make(map[net.Conn][]string)
+}
+
+// SetNoAck 設置是否停止確認發布
+func (b *Broker) SetNoAck(noAck bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.noAck = noAck
+}
+
+// Received 返回依序收到的發布訊息
+func (b *Broker) Received() []Message {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]Message(nil), b.messages...)
+}
+
+// SubscribedQoS 返回客戶端訂閱時請求的 QoS
+func (b *Broker) SubscribedQoS() []byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]byte(nil), b.granted...)
+}
+
+func (b *Broker) serve(conn net.Conn) {
+	defer func() {
+		b.mutex.Lock()
+		delete(b.conns, conn)
+		b.mutex.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		header, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		length, multiplier := 0, 1
+		for {
+			digit, err := reader.ReadByte()
+			if err != nil {
+				return
+			}
+			length += int(digit&127) * multiplier
+			multiplier *= 128
+			if digit&128 == 0 {
+				break
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case 1: // CONNECT
+			conn.Write([]byte{0x20, 2, 0, 0})
+		case 3: // PUBLISH
+			b.mutex.Lock()
+			noAck := b.noAck
+			b.mutex.Unlock()
+			if noAck {
+				continue
+			}
+
+			qos := (header >> 1) & 3
+			topicLen := int(body[0])<<8 | int(body[1])
+			topic := string(body[2 : 2+topicLen])
+			payload := body[2+topicLen:]
+			if qos > 0 {
+				conn.Write([]byte{0x40, 2, payload[0], payload[1]})
+				payload = payload[2:]
+			}
+			b.mutex.Lock()
+			b.messages = append(b.messages, Message{Topic: topic, Payload: payload, QoS: qos, Retain: header&1 == 1})
+			b.mutex.Unlock()
+			b.forward(topic, payload)
+		case 8: // SUBSCRIBE
+			ack := []byte{0x90, 0, body[0], body[1]}
+			rest := body[2:]
+			b.mutex.Lock()
+			for len(rest) > 0 {
+				filterLen := int(rest[0])<<8 | int(rest[1])
+				b.conns[conn] = append(b.conns[conn], string(rest[2:2+filterLen]))
+				b.granted = append(b.granted, rest[2+filterLen])
+				ack = append(ack, 0)
+				rest = rest[3+filterLen:]
+			}
+			b.mutex.Unlock()
+			ack[1] = byte(len(ack) - 2)
+			conn.Write(ack)
+		case 10: // UNSUBSCRIBE
+			conn.Write([]byte{0xb0, 2, body[0], body[1]})
+		case 12: // PINGREQ
+			conn.Write([]byte{0xd0, 0})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+// forward 以 QoS 0 轉發訊息給所有匹配的訂閱者
+func (b *Broker) forward(topic string, payload []byte) {
+	packet := []byte{0x30}
+	length := 2 + len(topic) + len(payload)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 128
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	packet = append(packet, byte(len(topic)>>8), byte(len(topic)))
+	packet = append(packet, topic...)
+	packet = append(packet, payload...)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for conn, filters := range b.conns {
+		for _, filter := range filters {
+			if topicMatches(filter, topic) {
+				conn.Write(packet)
+				break
+			}
+		}
+	}
+}
+
+// topicMatches 檢查主題是否符合訂閱的主題過濾器，支援 + 與 # 萬用字元
+func topicMatches(filter, topic string) bool {
+	filterParts := strings.Split(filter, "/")
+	topicParts := strings.Split(topic, "/")
+	for i, part := range filterParts {
+		if part == "#" {
+			return true
+		}
+		if i >= len(topicParts) || (part != "+" && part != topicParts[i]) {
+			return false
+		}
+	}
+	return len(filterParts) == len(topicParts)
+}
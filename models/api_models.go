@@ -49,6 +49,8 @@ type PDUScale struct {
 	Voltage      float64
 	Power        float64
 	Energy       float64
+	Temperature  float64 // 未設置時為 1
+	Humidity     float64 // 未設置時為 1
 }
 
 // PDUManufacturerHandler PDU製造商處理器介面
@@ -66,23 +68,72 @@ type PDUPoint struct {
 	Fields    map[string]interface{} `json:"fields"`
 }
 
+// PDUData 處理後的PDU數據
+type PDUData struct {
+	Name        string            `json:"name"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Tags        map[string]string `json:"tags"`
+	Current     float64           `json:"current,omitempty"`
+	Voltage     float64           `json:"voltage,omitempty"`
+	Power       float64           `json:"power,omitempty"`
+	Energy      float64           `json:"energy,omitempty"`       // 累計能耗計數器
+	EnergyDelta float64           `json:"energy_delta,omitempty"` // 與上次讀數之間的能耗增量
+	Branches    []Branch          `json:"branches,omitempty"`
+	Phases      []Phase           `json:"phases,omitempty"`
+	Outlets     []Outlet          `json:"outlets,omitempty"`
+	Environment []EnvProbe        `json:"environment,omitempty"`
+
+	// 衍生指標
+	ApparentPower    float64 `json:"apparent_power,omitempty"`    // 視在功率 (VA)
+	PowerFactor      float64 `json:"power_factor,omitempty"`      // 功率因數
+	CurrentImbalance float64 `json:"current_imbalance,omitempty"` // 相電流不平衡度 (%)
+	NeutralCurrent   float64 `json:"neutral_current,omitempty"`   // 三相中性線電流估算值
+
+	// Fields 處理管線計算的額外字段（如 CEL 階段），與總體數據一同輸出
+	Fields map[string]float64 `json:"fields,omitempty"`
+}
 
 // Branch 分支數據
 type Branch struct {
-	ID      string  `json:"id"`
-	Current float64 `json:"current,omitempty"`
-	Voltage float64 `json:"voltage,omitempty"`
-	Power   float64 `json:"power,omitempty"`
-	Energy  float64 `json:"energy,omitempty"`
+	ID          string  `json:"id"`
+	Current     float64 `json:"current,omitempty"`
+	Voltage     float64 `json:"voltage,omitempty"`
+	Power       float64 `json:"power,omitempty"`
+	Energy      float64 `json:"energy,omitempty"`
+	EnergyDelta float64 `json:"energy_delta,omitempty"`
 }
 
 // Phase 相位數據
 type Phase struct {
-	ID      string  `json:"id"`
-	Current float64 `json:"current,omitempty"`
-	Voltage float64 `json:"voltage,omitempty"`
-	Power   float64 `json:"power,omitempty"`
-	Energy  float64 `json:"energy,omitempty"`
+	ID            string  `json:"id"`
+	Current       float64 `json:"current,omitempty"`
+	Voltage       float64 `json:"voltage,omitempty"` // 相電壓 (L-N)
+	Power         float64 `json:"power,omitempty"`
+	Energy        float64 `json:"energy,omitempty"`
+	EnergyDelta   float64 `json:"energy_delta,omitempty"`
+	ApparentPower float64 `json:"apparent_power,omitempty"` // 視在功率 (VA)
+	PowerFactor   float64 `json:"power_factor,omitempty"`   // 功率因數
+	LineVoltage   float64 `json:"line_voltage,omitempty"`   // 與下一相之間的線電壓 (L-L)
+}
+
+// Outlet 插座數據，用於逐插座計量或可開關的 PDU
+type Outlet struct {
+	ID          string  `json:"id"`
+	Current     float64 `json:"current,omitempty"`
+	Voltage     float64 `json:"voltage,omitempty"`
+	Power       float64 `json:"power,omitempty"`
+	Energy      float64 `json:"energy,omitempty"`
+	EnergyDelta float64 `json:"energy_delta,omitempty"`
+	State       string  `json:"state,omitempty"` // on、off，無法對應時為原始值
+}
+
+// EnvProbe 環境探頭讀數
+type EnvProbe struct {
+	ID    string  `json:"id"`
+	Type  string  `json:"type"` // temperature、humidity 或 door
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+	State string  `json:"state,omitempty"` // 門磁狀態 open、closed，無法對應時為原始值
 }
 
 // DeviceConfig 設備配置
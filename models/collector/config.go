@@ -55,6 +55,24 @@ type CollectorConfig struct {
 			BatchSize int `json:"batch_size"`
 		} `json:"queue"`
 	} `json:"manager"`
+	Ingest struct {
+		MaxBodySize int64 `json:"max_body_size"` // 解壓後的最大請求大小（位元組）
+		Dedup       struct {
+			TTL        time.Duration `json:"ttl"`         // 去重窗口
+			MaxEntries int           `json:"max_entries"` // 記憶的最大鍵數
+		} `json:"dedup"`
+		Auth struct {
+			CredentialsFile string        `json:"credentials_file"` // 代理憑證文件，為空時不驗證
+			CheckInterval   time.Duration `json:"check_interval"`   // 檢查憑證文件變更的間隔
+		} `json:"auth"`
+	} `json:"ingest"`
+	RemoteWrite struct {
+		Enabled     bool   `json:"enabled"`
+		Listen      string `json:"listen"`      // 監聽地址，默認 ":9201"
+		Path        string `json:"path"`        // 接收路徑，默認 /api/v1/write
+		Measurement string `json:"measurement"` // 數據點的測量名稱，默認 prometheus
+	} `json:"remote_write"`
+	MQTT MQTTConfig `json:"mqtt"`
 }
 
 // SNMPCollectorConfig SNMP 收集器配置
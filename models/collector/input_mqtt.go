@@ -0,0 +1,64 @@
+package collector
+
+import "time"
+
+// defaultMQTTQoS 默認訂閱 QoS
+const defaultMQTTQoS byte = 1
+
+// DefaultMQTTConfig 默認 MQTT 配置
+var DefaultMQTTConfig = MQTTConfig{
+	ClientID:       "viot-collector",
+	QoS:            qos(defaultMQTTQoS),
+	ConnectTimeout: 10 * time.Second,
+	KeepAlive:      30 * time.Second,
+}
+
+// MQTTConfig MQTT 訂閱輸入配置
+type MQTTConfig struct {
+	Enabled        bool               `json:"enabled" yaml:"enabled"`
+	Broker         string             `json:"broker" yaml:"broker"` // 如 tcp://127.0.0.1:1883
+	ClientID       string             `json:"client_id" yaml:"client_id"`
+	Username       string             `json:"username" yaml:"username"`
+	Password       string             `json:"password" yaml:"password"`
+	QoS            *byte              `json:"qos" yaml:"qos"` // 0、1 或 2，未設置時為 1
+	ConnectTimeout time.Duration      `json:"connect_timeout" yaml:"connect_timeout"`
+	KeepAlive      time.Duration      `json:"keep_alive" yaml:"keep_alive"`
+	Subscriptions  []MQTTSubscription `json:"subscriptions" yaml:"subscriptions"`
+}
+
+// MQTTSubscription 單個主題過濾器的訂閱與解碼規則
+type MQTTSubscription struct {
+	Topic       string `json:"topic" yaml:"topic"`             // 主題過濾器，如 power/+/+/+
+	Measurement string `json:"measurement" yaml:"measurement"` // 數據點的指標名稱，為空時使用主題
+	// TopicTags 主題各段對應的標籤名稱，以 / 分隔，_ 表示略過該段，如 _/factory/room/device
+	TopicTags string `json:"topic_tags" yaml:"topic_tags"`
+	// Fields 字段名稱到 JSON 路徑（以 . 分隔）的映射，為空時取頂層所有數值
+	Fields map[string]string `json:"fields" yaml:"fields"`
+	// Tags 標籤名稱到 JSON 路徑的映射
+	Tags           map[string]string `json:"tags" yaml:"tags"`
+	TimestampPath  string            `json:"timestamp_path" yaml:"timestamp_path"`   // 時間戳的 JSON 路徑，為空時使用接收時間
+	TimestampUnits time.Duration     `json:"timestamp_units" yaml:"timestamp_units"` // 數值時間戳的單位，默認秒
+}
+
+// MergeWithDefault 合併默認配置
+func (c *MQTTConfig) MergeWithDefault() *MQTTConfig {
+	merged := *c
+	if merged.ClientID == "" {
+		merged.ClientID = DefaultMQTTConfig.ClientID
+	}
+	if merged.QoS == nil || *merged.QoS > 2 {
+		merged.QoS = qos(defaultMQTTQoS)
+	}
+	if merged.ConnectTimeout == 0 {
+		merged.ConnectTimeout = DefaultMQTTConfig.ConnectTimeout
+	}
+	if merged.KeepAlive == 0 {
+		merged.KeepAlive = DefaultMQTTConfig.KeepAlive
+	}
+	return &merged
+}
+
+// qos 返回 QoS 值的指針，使未設置與明確設置為 0 可以區分
+func qos(v byte) *byte {
+	return &v
+}
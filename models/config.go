@@ -30,8 +30,9 @@ type ServiceController struct {
 		webservice.WebserviceConfig `json:"webservice"`
 	}
 	Processor struct {
-		Enabled                   bool `json:"enabled"`
-		Interval                  int  `json:"interval"`
+		Enabled                   bool   `json:"enabled"`
+		Interval                  int    `json:"interval"`
+		PipelineFile              string `json:"pipeline_file"` // 處理管線配置文件，為空時不使用處理管線
 		processor.ProcessorConfig `json:"processor"`
 	} `json:"processor"`
 	Collector struct {
@@ -0,0 +1,116 @@
+package models
+
+// PDUProfile PDU 型號描述檔，以 YAML 宣告型號的匹配條件、字段與比例因子
+// 新增 PDU 型號只需新增描述檔，無需修改程式碼
+type PDUProfile struct {
+	Name  string          `yaml:"name" json:"name"`
+	Match PDUProfileMatch `yaml:"match" json:"match"`
+
+	// SlaveID Modbus 從站 ID，非 0 時要求 slave_id 標籤一致
+	SlaveID int `yaml:"slave_id" json:"slave_id,omitempty"`
+
+	// RequiredFields 更名後必須存在的字段
+	RequiredFields []string `yaml:"required_fields" json:"required_fields,omitempty"`
+
+	// Rename 原始字段名到標準字段名的映射
+	Rename map[string]string `yaml:"rename" json:"rename,omitempty"`
+
+	// Scale 各物理量的比例因子，未設置的物理量為 1
+	Scale PDUProfileScale `yaml:"scale" json:"scale"`
+
+	// Totals 物理量到總體字段名的映射，如 current: total_current
+	Totals map[string]string `yaml:"totals" json:"totals,omitempty"`
+
+	// Fields 字段命名規則，依序匹配，優先於 totals、branches 與 phases
+	Fields []PDUFieldRule `yaml:"fields" json:"fields,omitempty"`
+
+	// Branches 分支字段命名模式，如 branch_{id}_{quantity}，等同 scope 為 branch 的字段規則
+	Branches string `yaml:"branches" json:"branches,omitempty"`
+
+	// Phases 相位字段命名模式，如 {quantity}_{id}，等同 scope 為 phase 的字段規則
+	Phases string `yaml:"phases" json:"phases,omitempty"`
+
+	// Outlets 插座字段命名模式，如 outlet_{id}_{quantity}，等同 scope 為 outlet 的字段規則
+	Outlets string `yaml:"outlets" json:"outlets,omitempty"`
+
+	// OutletStates 插座狀態原始值到 on/off 的映射，如 "1": on；未設置時 0 為 off、1 為 on
+	OutletStates map[string]string `yaml:"outlet_states" json:"outlet_states,omitempty"`
+
+	// Env 環境探頭字段命名模式，如 sensor_{id}_{quantity}，等同 scope 為 env 的字段規則
+	Env string `yaml:"env" json:"env,omitempty"`
+
+	// EnvUnits 環境探頭物理量的單位，未設置時溫度為 C、濕度為 %RH
+	EnvUnits map[string]string `yaml:"env_units" json:"env_units,omitempty"`
+
+	// DoorStates 門磁原始值到 open/closed 的映射；未設置時 0 為 closed、1 為 open
+	DoorStates map[string]string `yaml:"door_states" json:"door_states,omitempty"`
+
+	// CounterBits 能耗計數器位寬（如 32），用於判斷計數器溢位；0 時使用處理器設置
+	CounterBits int `yaml:"counter_bits" json:"counter_bits,omitempty"`
+
+	// Validation 數據驗證規則，未設置時使用處理器設置
+	Validation *PDUValidation `yaml:"validation" json:"validation,omitempty"`
+}
+
+// PDUProfileMatch 描述檔的匹配條件
+type PDUProfileMatch struct {
+	// Manufacturer 製造商，不區分大小寫，支援 * 萬用字元
+	Manufacturer string `yaml:"manufacturer" json:"manufacturer"`
+
+	// Models 型號列表，不區分大小寫，支援 * 萬用字元；為空時匹配該製造商所有型號
+	Models []string `yaml:"models" json:"models,omitempty"`
+
+	// Detect 無型號標籤時用於識別型號的字段片段，全部出現在字段名中才匹配
+	Detect []string `yaml:"detect" json:"detect,omitempty"`
+}
+
+// PDUProfileScale 描述檔的比例因子
+type PDUProfileScale struct {
+	Current float64 `yaml:"current" json:"current,omitempty"`
+	Voltage float64 `yaml:"voltage" json:"voltage,omitempty"`
+	Power   float64 `yaml:"power" json:"power,omitempty"`
+	Energy  float64 `yaml:"energy" json:"energy,omitempty"`
+
+	Temperature float64 `yaml:"temperature" json:"temperature,omitempty"`
+	Humidity    float64 `yaml:"humidity" json:"humidity,omitempty"`
+}
+
+// PDUFieldRule 字段命名規則，從字段名解析範圍、ID 與物理量
+type PDUFieldRule struct {
+	// Scope 範圍：total、phase、branch、outlet 或 env
+	Scope string `yaml:"scope" json:"scope"`
+
+	// Pattern 含 {id} 與 {quantity} 佔位符的模板，如 branch_{id}_{quantity}
+	Pattern string `yaml:"pattern" json:"pattern,omitempty"`
+
+	// Regex 含 id 與 quantity 命名分組的正則表達式，與 Pattern 擇一
+	Regex string `yaml:"regex" json:"regex,omitempty"`
+
+	// ID 固定的 ID，用於字段名不含 ID 的規則
+	ID string `yaml:"id" json:"id,omitempty"`
+
+	// Quantity 固定的物理量，用於字段名不含物理量的規則
+	Quantity string `yaml:"quantity" json:"quantity,omitempty"`
+}
+
+// PDUValidation 數據驗證規則
+// Bounds 與 MaxRate 的鍵為物理量（如 current，適用所有範圍）或 <scope>.<quantity>（如 phase.voltage，優先使用）
+type PDUValidation struct {
+	// Action 未通過驗證時的處理方式：drop 丟棄（默認）或 flag 標記後仍輸出，兩者都會寫入隔離區
+	Action string `yaml:"action" json:"action,omitempty"`
+
+	// Bounds 數值上下限
+	Bounds map[string]PDUBound `yaml:"bounds" json:"bounds,omitempty"`
+
+	// MaxRate 每秒最大變化量，與同一設備上一個未超出上下限的讀數比較
+	MaxRate map[string]float64 `yaml:"max_rate" json:"max_rate,omitempty"`
+
+	// Required 必須存在的標準字段，如 current、phase_L1_voltage
+	Required []string `yaml:"required" json:"required,omitempty"`
+}
+
+// PDUBound 數值上下限，未設置的一側不檢查
+type PDUBound struct {
+	Min *float64 `yaml:"min" json:"min,omitempty"`
+	Max *float64 `yaml:"max" json:"max,omitempty"`
+}
@@ -10,5 +10,9 @@ type ProcessorStatus struct {
 	ProcessedCount int64     `json:"processed_count"`
 	ErrorCount     int64     `json:"error_count"`
 	LastError      string    `json:"last_error,omitempty"`
-	Stats          map[string]interface{}
+	// QuarantinedCount 未通過驗證規則而丟棄的數據數，不含標記後輸出的數據
+	QuarantinedCount int64 `json:"quarantined_count"`
+	// FlaggedCount 未通過驗證規則但仍標記後輸出的數據數
+	FlaggedCount int64 `json:"flagged_count"`
+	Stats        map[string]interface{}
 }
@@ -76,10 +76,13 @@ type PDUPending struct {
 // DeviceRegistry 設備註冊表記錄
 type DeviceRegistry struct {
 	Name         string    `csv:"name"`
+	IP           string    `csv:"ip"`
 	Factory      string    `csv:"factory"`
 	Phase        string    `csv:"phase"`
 	Datacenter   string    `csv:"datacenter"`
 	Room         string    `csv:"room"`
+	Rack         string    `csv:"rack"`
+	Side         string    `csv:"side"`
 	Type         string    `csv:"type"`
 	Manufacturer string    `csv:"manufacturer"`
 	Model        string    `csv:"model"`
@@ -91,10 +94,13 @@ type DeviceRegistry struct {
 // PDURegistry PDU註冊表記錄
 type PDURegistry struct {
 	Name         string    `csv:"name"`
+	IP           string    `csv:"ip"`
 	Factory      string    `csv:"factory"`
 	Phase        string    `csv:"phase"`
 	Datacenter   string    `csv:"datacenter"`
 	Room         string    `csv:"room"`
+	Rack         string    `csv:"rack"`
+	Side         string    `csv:"side"`
 	Type         string    `csv:"type"`
 	Manufacturer string    `csv:"manufacturer"`
 	Model        string    `csv:"model"`
@@ -0,0 +1,218 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"viot/models"
+)
+
+// 去重窗口默認參數
+const (
+	defaultDedupTTL        = 10 * time.Minute
+	defaultDedupMaxEntries = 200000
+)
+
+// DeduplicatorStats 去重統計
+type DeduplicatorStats struct {
+	TTL        time.Duration `json:"ttl"`
+	MaxEntries int           `json:"max_entries"`
+	Entries    int           `json:"entries"`
+	Checked    int64         `json:"checked"`
+	Duplicates int64         `json:"duplicates"`
+	Evicted    int64         `json:"evicted"`
+}
+
+// dedupEntry 按插入順序保存的鍵，用於過期與容量淘汰
+type dedupEntry struct {
+	key     string
+	expires time.Time
+}
+
+// Deduplicator 時間窗口內的數據點去重，過濾 Telegraf 在下游短暫不可用後重送的整批數據
+// 以指標名稱、標籤、字段與時間戳作為鍵；所有鍵的 TTL 相同，因此插入順序即過期順序
+// 沒有時間戳的數據點無法判斷是否為重送，不參與去重
+type Deduplicator struct {
+	ttl        time.Duration
+	maxEntries int
+	seen       map[string]time.Time
+	order      []dedupEntry
+	head       int
+	stats      DeduplicatorStats
+	mutex      sync.Mutex
+}
+
+// NewDeduplicator 根據收集器的接收配置創建去重器
+func NewDeduplicator(config *models.CollectorConfig) *Deduplicator {
+	ttl := defaultDedupTTL
+	maxEntries := defaultDedupMaxEntries
+
+	if config != nil {
+		if config.Ingest.Dedup.TTL > 0 {
+			ttl = config.Ingest.Dedup.TTL
+		}
+		if config.Ingest.Dedup.MaxEntries > 0 {
+			maxEntries = config.Ingest.Dedup.MaxEntries
+		}
+	}
+
+	return &Deduplicator{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		seen:       make(map[string]time.Time),
+		stats: DeduplicatorStats{
+			TTL:        ttl,
+			MaxEntries: maxEntries,
+		},
+	}
+}
+
+// Filter 過濾窗口內已出現過的數據點並記錄新數據點，返回未重複的數據點
+func (d *Deduplicator) Filter(points []models.RestAPIPoint) []models.RestAPIPoint {
+	duplicates := d.Check(points)
+
+	unique := make([]models.RestAPIPoint, 0, len(points))
+	for i, point := range points {
+		if !duplicates[i] {
+			unique = append(unique, point)
+		}
+	}
+	return unique
+}
+
+// Check 逐個檢查數據點是否在窗口內已出現過並記錄新數據點，返回與 points 對應的重複標記
+// 時間戳為零值的數據點一律視為不重複
+func (d *Deduplicator) Check(points []models.RestAPIPoint) []bool {
+	duplicates := make([]bool, len(points))
+	if len(points) == 0 {
+		return duplicates
+	}
+
+	now := time.Now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.expire(now)
+
+	for i, point := range points {
+		if point.Timestamp.IsZero() {
+			continue
+		}
+		d.stats.Checked++
+
+		key := DedupKey(point)
+		if expires, ok := d.seen[key]; ok && now.Before(expires) {
+			d.stats.Duplicates++
+			duplicates[i] = true
+			continue
+		}
+
+		expires := now.Add(d.ttl)
+		d.seen[key] = expires
+		d.order = append(d.order, dedupEntry{key: key, expires: expires})
+	}
+
+	// 超過容量時淘汰最早的鍵
+	for len(d.seen) > d.maxEntries {
+		if d.evictOldest() {
+			d.stats.Evicted++
+		}
+	}
+	d.compact()
+
+	return duplicates
+}
+
+// Forget 移除數據點的記錄，用於數據最終未被接收時（如隊列已滿），使重送不會被誤判為重複
+func (d *Deduplicator) Forget(points []models.RestAPIPoint) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, point := range points {
+		if !point.Timestamp.IsZero() {
+			delete(d.seen, DedupKey(point))
+		}
+	}
+}
+
+// Stats 返回去重統計
+func (d *Deduplicator) Stats() DeduplicatorStats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	stats := d.stats
+	stats.Entries = len(d.seen)
+	return stats
+}
+
+// expire 移除已過期的鍵
+func (d *Deduplicator) expire(now time.Time) {
+	for d.head < len(d.order) && !now.Before(d.order[d.head].expires) {
+		d.evictOldest()
+	}
+}
+
+// evictOldest 移除插入最早的鍵；鍵若已被重新插入或遺忘則僅推進隊列並返回 false
+func (d *Deduplicator) evictOldest() bool {
+	entry := d.order[d.head]
+	d.order[d.head] = dedupEntry{}
+	d.head++
+
+	if expires, ok := d.seen[entry.key]; ok && expires.Equal(entry.expires) {
+		delete(d.seen, entry.key)
+		return true
+	}
+	return false
+}
+
+// compact 回收隊列頭部已移除的空間
+func (d *Deduplicator) compact() {
+	if d.head > 0 && d.head*2 >= len(d.order) {
+		d.order = append(d.order[:0], d.order[d.head:]...)
+		d.head = 0
+	}
+}
+
+// DedupKey 生成數據點的去重鍵
+// 同一時間戳的數據可能按字段拆分成多個數據點，因此鍵中包含字段名稱；
+// 鍵中也包含主要值與字段值，同一時間戳但數值不同的數據是不同的讀數而非重送
+func DedupKey(point models.RestAPIPoint) string {
+	tagKeys := make([]string, 0, len(point.Tags))
+	for k := range point.Tags {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+
+	fieldKeys := make([]string, 0, len(point.Fields))
+	for k := range point.Fields {
+		fieldKeys = append(fieldKeys, k)
+	}
+	sort.Strings(fieldKeys)
+
+	var b strings.Builder
+	b.WriteString(point.Metric)
+	for _, k := range tagKeys {
+		b.WriteByte(',')
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(point.Tags[k])
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(point.Value, 'g', -1, 64))
+	for i, k := range fieldKeys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		fmt.Fprint(&b, point.Fields[k])
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(point.Timestamp.UnixNano(), 10))
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"viot/models"
+)
+
+func TestDeduplicatorCheck(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	point := func(current float64, timestamp time.Time) models.RestAPIPoint {
+		return models.RestAPIPoint{
+			Metric:    "pdu",
+			Tags:      map[string]string{"host": "pdu-01"},
+			Fields:    map[string]interface{}{"current": current},
+			Timestamp: timestamp,
+		}
+	}
+
+	d := NewDeduplicator(nil)
+	if got := d.Check([]models.RestAPIPoint{point(1, ts)}); got[0] {
+		t.Fatal("第一次出現的數據點不應視為重複")
+	}
+
+	tests := []struct {
+		name  string
+		point models.RestAPIPoint
+		want  bool
+	}{
+		{"重送相同的數據點", point(1, ts), true},
+		{"同一時間戳但數值不同", point(2, ts), false},
+		{"不同時間戳", point(1, ts.Add(time.Second)), false},
+		{"沒有時間戳", point(3, time.Time{}), false},
+		{"再次收到沒有時間戳的相同數據點", point(3, time.Time{}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.Check([]models.RestAPIPoint{tt.point})[0]; got != tt.want {
+				t.Errorf("重複標記應為 %v，實際為 %v", tt.want, got)
+			}
+		})
+	}
+
+	// 遺忘後重送的數據點可再次接收
+	d.Forget([]models.RestAPIPoint{point(1, ts)})
+	if d.Check([]models.RestAPIPoint{point(1, ts)})[0] {
+		t.Error("遺忘後的數據點不應視為重複")
+	}
+}
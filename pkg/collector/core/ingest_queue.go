@@ -0,0 +1,244 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"viot/logger"
+	"viot/models"
+
+	"go.uber.org/zap"
+)
+
+// ErrQueueFull 接收隊列已滿，調用方應稍後重試
+var ErrQueueFull = errors.New("接收隊列已滿")
+
+// ErrBatchTooLarge 批次超過隊列的總容量，重試也無法入隊，調用方應拆分批次
+var ErrBatchTooLarge = errors.New("批次超過接收隊列容量")
+
+// ErrQueueClosed 接收隊列已停止，不再接收數據
+var ErrQueueClosed = errors.New("接收隊列已停止")
+
+// 接收隊列默認參數，對應 CollectorConfig 未設置時的值
+const (
+	defaultQueueSize     = 10000
+	defaultWorkerCount   = 4
+	defaultFlushInterval = time.Second
+	defaultBatchSize     = 500
+)
+
+// IngestQueueStats 接收隊列統計
+type IngestQueueStats struct {
+	Depth       int       `json:"depth"`
+	Capacity    int       `json:"capacity"`
+	Workers     int       `json:"workers"`
+	Enqueued    int64     `json:"enqueued"`
+	Processed   int64     `json:"processed"`
+	Rejected    int64     `json:"rejected"`
+	ErrorCount  int64     `json:"error_count"`
+	LastFlushed time.Time `json:"last_flushed"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// IngestQueue 有界的非同步接收隊列，將 HTTP 接收與處理器解耦
+// 隊列以數據點計算容量，整批入隊或整批拒絕，避免 Telegraf 重試時產生部分重複
+type IngestQueue struct {
+	handler       DataHandler
+	logger        logger.Logger
+	batches       chan []models.RestAPIPoint
+	capacity      int
+	workerCount   int
+	batchSize     int
+	flushInterval time.Duration
+	stats         IngestQueueStats
+	closed        bool
+	mutex         sync.Mutex
+	wg            sync.WaitGroup
+	ctx           context.Context
+	cancel        context.CancelFunc
+}
+
+// NewIngestQueue 根據收集器的緩衝配置創建接收隊列
+func NewIngestQueue(config *models.CollectorConfig, handler DataHandler, logger logger.Logger) *IngestQueue {
+	capacity := defaultQueueSize
+	workerCount := defaultWorkerCount
+	flushInterval := defaultFlushInterval
+	batchSize := defaultBatchSize
+
+	if config != nil {
+		if config.Buffer.Size > 0 {
+			capacity = config.Buffer.Size
+		}
+		if config.Buffer.WorkerCount > 0 {
+			workerCount = config.Buffer.WorkerCount
+		}
+		if config.Buffer.FlushInterval > 0 {
+			flushInterval = config.Buffer.FlushInterval
+		}
+		if config.Manager.Queue.BatchSize > 0 {
+			batchSize = config.Manager.Queue.BatchSize
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &IngestQueue{
+		handler:       handler,
+		logger:        logger.Named("ingest-queue"),
+		batches:       make(chan []models.RestAPIPoint, capacity),
+		capacity:      capacity,
+		workerCount:   workerCount,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		stats: IngestQueueStats{
+			Capacity: capacity,
+			Workers:  workerCount,
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start 啟動工作協程
+func (q *IngestQueue) Start(ctx context.Context) error {
+	q.ctx, q.cancel = context.WithCancel(ctx)
+
+	for i := 0; i < q.workerCount; i++ {
+		q.wg.Add(1)
+		go q.worker(i)
+	}
+
+	q.logger.Info("接收隊列已啟動",
+		zap.Int("capacity", q.capacity),
+		zap.Int("workers", q.workerCount),
+		zap.Int("batch_size", q.batchSize),
+		zap.Duration("flush_interval", q.flushInterval))
+	return nil
+}
+
+// Stop 停止接收並等待工作協程處理完已入隊的數據，之後的 Enqueue 返回 ErrQueueClosed
+func (q *IngestQueue) Stop() error {
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		return nil
+	}
+	// 先拒絕新數據再通知工作協程，確保工作協程退出前取出所有已入隊的數據
+	q.closed = true
+	q.mutex.Unlock()
+
+	if q.cancel != nil {
+		q.cancel()
+	}
+	q.wg.Wait()
+
+	q.logger.Info("接收隊列已停止")
+	return nil
+}
+
+// Enqueue 將一批數據點放入隊列，隊列空間不足時返回 ErrQueueFull，
+// 批次大於隊列總容量時返回 ErrBatchTooLarge，隊列已停止時返回 ErrQueueClosed
+func (q *IngestQueue) Enqueue(points []models.RestAPIPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		q.stats.Rejected += int64(len(points))
+		return ErrQueueClosed
+	}
+
+	if len(points) > q.capacity {
+		q.stats.Rejected += int64(len(points))
+		return ErrBatchTooLarge
+	}
+
+	if q.stats.Depth+len(points) > q.capacity {
+		q.stats.Rejected += int64(len(points))
+		return ErrQueueFull
+	}
+
+	// 容量以數據點計算且每批至少一個點，因此通道不會阻塞
+	q.batches <- points
+	q.stats.Depth += len(points)
+	q.stats.Enqueued += int64(len(points))
+	return nil
+}
+
+// RetryAfter 返回建議的重試等待時間
+func (q *IngestQueue) RetryAfter() time.Duration {
+	if q.flushInterval < time.Second {
+		return time.Second
+	}
+	return q.flushInterval
+}
+
+// Stats 返回隊列統計
+func (q *IngestQueue) Stats() IngestQueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.stats
+}
+
+// worker 從隊列取出數據，累積到批次大小或刷新間隔後交給處理器
+func (q *IngestQueue) worker(id int) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.flushInterval)
+	defer ticker.Stop()
+
+	buffer := make([]models.RestAPIPoint, 0, q.batchSize)
+	for {
+		select {
+		case <-q.ctx.Done():
+			// 處理剩餘數據後退出
+			for {
+				select {
+				case points := <-q.batches:
+					buffer = append(buffer, points...)
+				default:
+					q.flush(buffer)
+					return
+				}
+			}
+		case points := <-q.batches:
+			buffer = append(buffer, points...)
+			if len(buffer) >= q.batchSize {
+				q.flush(buffer)
+				buffer = make([]models.RestAPIPoint, 0, q.batchSize)
+			}
+		case <-ticker.C:
+			if len(buffer) > 0 {
+				q.flush(buffer)
+				buffer = make([]models.RestAPIPoint, 0, q.batchSize)
+			}
+		}
+	}
+}
+
+// flush 將緩衝的數據交給處理器並更新統計
+func (q *IngestQueue) flush(points []models.RestAPIPoint) {
+	if len(points) == 0 {
+		return
+	}
+
+	// 關閉期間仍需完成處理，因此不使用已取消的隊列上下文
+	err := q.handler.HandleData(context.Background(), points)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.stats.Depth -= len(points)
+	q.stats.LastFlushed = time.Now()
+	if err != nil {
+		q.stats.ErrorCount++
+		q.stats.LastError = err.Error()
+		q.logger.Error("處理隊列數據失敗", zap.Int("count", len(points)), zap.Error(err))
+		return
+	}
+	q.stats.Processed += int64(len(points))
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"viot/logger"
+	"viot/models"
+)
+
+// countingHandler 計算收到的數據點
+type countingHandler struct {
+	mutex  sync.Mutex
+	points int
+}
+
+func (h *countingHandler) HandleData(_ context.Context, points []models.RestAPIPoint) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.points += len(points)
+	return nil
+}
+
+func (h *countingHandler) count() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.points
+}
+
+func TestIngestQueueStopDrainsAndRejects(t *testing.T) {
+	config := &models.CollectorConfig{}
+	config.Buffer.FlushInterval = time.Hour
+	config.Manager.Queue.BatchSize = 1000
+
+	handler := &countingHandler{}
+	queue := NewIngestQueue(config, handler, logger.DefaultLogger)
+	queue.Start(context.Background())
+
+	// 未達批次大小與刷新間隔，停止前數據仍在工作協程的緩衝中
+	for i := 0; i < 10; i++ {
+		if err := queue.Enqueue([]models.RestAPIPoint{{Metric: "cpu"}, {Metric: "mem"}}); err != nil {
+			t.Fatalf("入隊失敗: %v", err)
+		}
+	}
+	if err := queue.Stop(); err != nil {
+		t.Fatalf("停止隊列失敗: %v", err)
+	}
+	if got := handler.count(); got != 20 {
+		t.Fatalf("停止時應處理完 20 個已入隊的數據點，實際為 %d", got)
+	}
+
+	if err := queue.Enqueue([]models.RestAPIPoint{{Metric: "cpu"}}); !errors.Is(err, ErrQueueClosed) {
+		t.Fatalf("停止後入隊應返回 ErrQueueClosed，實際為 %v", err)
+	}
+	if err := queue.Stop(); err != nil {
+		t.Fatalf("重複停止不應返回錯誤: %v", err)
+	}
+	if stats := queue.Stats(); stats.Processed != 20 || stats.Rejected != 1 || stats.Depth != 0 {
+		t.Errorf("統計不正確: %+v", stats)
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 
 	"viot/logger"
@@ -11,6 +12,26 @@ import (
 	"go.uber.org/zap"
 )
 
+// InputFactory 根據收集器配置創建輸入插件，未啟用時返回 nil
+// 位於子包的輸入插件（如 inputs/mqtt）依賴 core，無法由 core 直接創建，改為在 init 中註冊工廠
+type InputFactory func(config *models.CollectorConfig, handler DataHandler, logger logger.Logger) (Input, error)
+
+var (
+	inputFactories     = make(map[string]InputFactory)
+	inputFactoriesLock sync.RWMutex
+)
+
+// RegisterInputFactory 註冊輸入插件工廠，由 CreateDefaultInputs 調用；重複註冊同名工廠時 panic
+func RegisterInputFactory(name string, factory InputFactory) {
+	inputFactoriesLock.Lock()
+	defer inputFactoriesLock.Unlock()
+
+	if _, exists := inputFactories[name]; exists {
+		panic(fmt.Sprintf("輸入插件工廠 %s 已經註冊", name))
+	}
+	inputFactories[name] = factory
+}
+
 // InputManager 管理所有輸入插件
 type InputManager struct {
 	inputs   map[string]Input
@@ -49,6 +70,37 @@ func (m *InputManager) CreateDefaultInputs() error {
 		return fmt.Errorf("註冊 Modbus 輸入插件失敗: %w", err)
 	}
 
+	// 創建 Prometheus remote_write 輸入插件，樣本經由 HandleData 進入與 Telegraf 相同的處理流程
+	if m.config != nil && m.config.RemoteWrite.Enabled {
+		remoteWriteInput := NewRemoteWriteInput(m.config, m, m.logger)
+		if err := m.RegisterInput(remoteWriteInput); err != nil {
+			return fmt.Errorf("註冊 remote_write 輸入插件失敗: %w", err)
+		}
+	}
+
+	// 創建已註冊工廠的輸入插件，數據同樣經由 HandleData 進入處理流程
+	inputFactoriesLock.RLock()
+	defer inputFactoriesLock.RUnlock()
+
+	names := make([]string, 0, len(inputFactories))
+	for name := range inputFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		input, err := inputFactories[name](m.config, m, m.logger)
+		if err != nil {
+			return fmt.Errorf("創建 %s 輸入插件失敗: %w", name, err)
+		}
+		if input == nil {
+			continue
+		}
+		if err := m.RegisterInput(input); err != nil {
+			return fmt.Errorf("註冊 %s 輸入插件失敗: %w", name, err)
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"viot/logger"
+	"viot/models"
+	"viot/pkg/collector/parsers"
+
+	"go.uber.org/zap"
+)
+
+// 遠端寫入默認參數
+const (
+	defaultRemoteWriteListen  = ":9201"
+	defaultRemoteWritePath    = "/api/v1/write"
+	defaultRemoteWriteMaxSize = 32 << 20
+)
+
+// RemoteWriteInput Prometheus remote_write 接收輸入插件
+// 將 snappy 壓縮的 protobuf 樣本轉換為數據點後交給 DataHandler（通常為 InputManager），
+// 使 Prometheus SNMP exporter 與 Telegraf 的 PDU 數據進入同一個處理流程
+type RemoteWriteInput struct {
+	*BaseDeviceInput
+	handler     DataHandler
+	listen      string
+	path        string
+	measurement string
+	maxSize     int
+	server      *http.Server
+}
+
+// NewRemoteWriteInput 創建 remote_write 輸入插件，listen 為空時監聽默認的 :9201
+func NewRemoteWriteInput(config *models.CollectorConfig, handler DataHandler, logger logger.Logger) *RemoteWriteInput {
+	input := &RemoteWriteInput{
+		BaseDeviceInput: NewBaseDeviceInput("remote_write", config, logger),
+		handler:         handler,
+		listen:          defaultRemoteWriteListen,
+		path:            defaultRemoteWritePath,
+		maxSize:         defaultRemoteWriteMaxSize,
+	}
+
+	if config != nil {
+		if config.RemoteWrite.Listen != "" {
+			input.listen = config.RemoteWrite.Listen
+		}
+		input.measurement = config.RemoteWrite.Measurement
+		if config.RemoteWrite.Path != "" {
+			input.path = config.RemoteWrite.Path
+		}
+		if config.Ingest.MaxBodySize > 0 {
+			input.maxSize = int(config.Ingest.MaxBodySize)
+		}
+	}
+
+	return input
+}
+
+// Start 啟動輸入插件與獨立的 HTTP 接收服務
+// 監聽地址在返回前綁定，地址已被佔用或沒有權限時返回錯誤
+func (r *RemoteWriteInput) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", r.listen)
+	if err != nil {
+		return fmt.Errorf("remote_write 監聽 %s 失敗: %w", r.listen, err)
+	}
+	if err := r.BaseDeviceInput.Start(ctx); err != nil {
+		listener.Close()
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(r.path, r)
+	r.server = &http.Server{
+		Addr:              r.listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	r.logger.Info("remote_write 接收服務已啟動",
+		zap.String("listen", listener.Addr().String()),
+		zap.String("path", r.path))
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			r.logger.Error("remote_write 接收服務異常結束", zap.Error(err))
+			r.UpdateError(err)
+		}
+	}(r.server)
+
+	return nil
+}
+
+// Stop 停止輸入插件與 HTTP 服務
+func (r *RemoteWriteInput) Stop() error {
+	if r.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.server.Shutdown(ctx); err != nil {
+			r.logger.Error("關閉 remote_write 接收服務失敗", zap.Error(err))
+		}
+		r.server = nil
+	}
+	return r.BaseDeviceInput.Stop()
+}
+
+// ServeHTTP 處理 remote_write 請求
+// 數據格式錯誤返回 400，Prometheus 不會重試；處理失敗返回 500，由 Prometheus 重試
+func (r *RemoteWriteInput) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// snappy 壓縮率有限，壓縮內容不會超過解壓後的上限
+	body, err := io.ReadAll(io.LimitReader(req.Body, int64(r.maxSize)+1))
+	if err != nil {
+		r.reject(w, http.StatusBadRequest, fmt.Errorf("讀取請求內容失敗: %w", err))
+		return
+	}
+	if len(body) > r.maxSize {
+		r.reject(w, http.StatusRequestEntityTooLarge, fmt.Errorf("請求內容超過上限 %d 位元組", r.maxSize))
+		return
+	}
+
+	decoded, err := parsers.DecodeRemoteWrite(body, r.maxSize)
+	if err != nil {
+		r.reject(w, http.StatusBadRequest, err)
+		return
+	}
+
+	points, err := parsers.ParseRemoteWrite(decoded, r.measurement)
+	if err != nil {
+		r.reject(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(points) > 0 {
+		if err := r.handler.HandleData(req.Context(), points); err != nil {
+			r.reject(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	r.HandleData(req.Context(), points)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reject 記錄錯誤並回應
+func (r *RemoteWriteInput) reject(w http.ResponseWriter, status int, err error) {
+	r.UpdateError(err)
+	r.logger.Warn("拒絕 remote_write 請求", zap.Int("status", status), zap.Error(err))
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,27 @@
+package core
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"viot/logger"
+	"viot/models"
+)
+
+func TestRemoteWriteStartFailsWhenAddressInUse(t *testing.T) {
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("佔用監聽地址失敗: %v", err)
+	}
+	defer occupied.Close()
+
+	config := &models.CollectorConfig{}
+	config.RemoteWrite.Listen = occupied.Addr().String()
+
+	input := NewRemoteWriteInput(config, &countingHandler{}, logger.DefaultLogger)
+	if err := input.Start(context.Background()); err == nil {
+		input.Stop()
+		t.Fatal("監聽地址已被佔用時 Start 應返回錯誤")
+	}
+}
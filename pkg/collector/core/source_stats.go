@@ -0,0 +1,296 @@
+package core
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"viot/models"
+)
+
+// 數據來源類型
+const (
+	SourceTypeAgent  = "agent"
+	SourceTypeDevice = "device"
+)
+
+// rateWindowMinutes 計算每分鐘速率使用的時間窗口
+const rateWindowMinutes = 5
+
+// 來源記錄的默認保留參數，避免大量不同的 device 標籤使記錄無限增長
+const (
+	defaultSourceTTL        = 24 * time.Hour // 超過此時間未出現的來源被移除
+	defaultSourceMaxEntries = 10000          // 代理與設備各自的最大記錄數，超過時移除最久未出現的來源
+	sourcePruneInterval     = time.Minute
+)
+
+// SourceStats 單個數據來源（Telegraf 代理或設備）的接收統計
+type SourceStats struct {
+	Type                 string    `json:"type"`
+	Name                 string    `json:"name"`
+	Agent                string    `json:"agent,omitempty"`
+	FirstSeen            time.Time `json:"first_seen"`
+	LastSeen             time.Time `json:"last_seen"`
+	AcceptedTotal        int64     `json:"accepted_total"`
+	RejectedTotal        int64     `json:"rejected_total"`
+	AcceptedPerMinute    float64   `json:"accepted_per_minute"`
+	RejectedPerMinute    float64   `json:"rejected_per_minute"`
+	Batches              int64     `json:"batches"`
+	AverageBatchSize     float64   `json:"average_batch_size"`
+	LastError            string    `json:"last_error,omitempty"`
+	LastErrorTime        time.Time `json:"last_error_time,omitempty"`
+	SecondsSinceLastSeen float64   `json:"seconds_since_last_seen"`
+}
+
+// minuteBucket 一分鐘內的計數
+type minuteBucket struct {
+	minute   int64
+	accepted int64
+	rejected int64
+}
+
+// sourceEntry 來源的內部狀態
+type sourceEntry struct {
+	stats   SourceStats
+	buckets [rateWindowMinutes]minuteBucket
+}
+
+// add 將計數加入當前分鐘的桶
+func (e *sourceEntry) add(now time.Time, accepted, rejected int64) {
+	minute := now.Unix() / 60
+	bucket := &e.buckets[minute%rateWindowMinutes]
+	if bucket.minute != minute {
+		*bucket = minuteBucket{minute: minute}
+	}
+	bucket.accepted += accepted
+	bucket.rejected += rejected
+}
+
+// snapshot 計算速率並返回統計快照
+func (e *sourceEntry) snapshot(now time.Time) SourceStats {
+	stats := e.stats
+	current := now.Unix() / 60
+
+	var accepted, rejected int64
+	for _, bucket := range e.buckets {
+		if current-bucket.minute < rateWindowMinutes {
+			accepted += bucket.accepted
+			rejected += bucket.rejected
+		}
+	}
+
+	// 來源出現不足一個窗口時按實際時長計算，至少一分鐘
+	minutes := now.Sub(stats.FirstSeen).Minutes()
+	if minutes > rateWindowMinutes {
+		minutes = rateWindowMinutes
+	}
+	if minutes < 1 {
+		minutes = 1
+	}
+
+	stats.AcceptedPerMinute = float64(accepted) / minutes
+	stats.RejectedPerMinute = float64(rejected) / minutes
+	if stats.Batches > 0 {
+		stats.AverageBatchSize = float64(stats.AcceptedTotal+stats.RejectedTotal) / float64(stats.Batches)
+	}
+	stats.SecondsSinceLastSeen = now.Sub(stats.LastSeen).Seconds()
+	return stats
+}
+
+// SourceTracker 按 Telegraf 代理與設備追踪接收統計
+type SourceTracker struct {
+	agents     map[string]*sourceEntry
+	devices    map[string]*sourceEntry
+	ttl        time.Duration
+	maxEntries int
+	lastPrune  time.Time
+	evicted    int64
+	mutex      sync.Mutex
+}
+
+// NewSourceTracker 創建來源追踪器
+func NewSourceTracker() *SourceTracker {
+	return &SourceTracker{
+		agents:     make(map[string]*sourceEntry),
+		devices:    make(map[string]*sourceEntry),
+		ttl:        defaultSourceTTL,
+		maxEntries: defaultSourceMaxEntries,
+	}
+}
+
+// DeviceKey 從標籤取得設備識別，優先使用 device 標籤，其次為 ip
+func DeviceKey(tags map[string]string) string {
+	if device := tags["device"]; device != "" {
+		return device
+	}
+	return tags["ip"]
+}
+
+// RecordAccepted 記錄代理一批被接受的數據點
+func (t *SourceTracker) RecordAccepted(agent string, points []models.RestAPIPoint) {
+	t.record(agent, points, len(points), 0, nil)
+}
+
+// RecordRejected 記錄代理被拒絕的數據點
+// points 為可辨識設備的被拒數據點，count 為總拒絕數（可能包含無法解析的數據）
+func (t *SourceTracker) RecordRejected(agent string, points []models.RestAPIPoint, count int, err error) {
+	if count < len(points) {
+		count = len(points)
+	}
+	t.record(agent, points, 0, count, err)
+}
+
+// record 更新代理及其設備的統計
+func (t *SourceTracker) record(agent string, points []models.RestAPIPoint, accepted, rejected int, err error) {
+	now := time.Now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.prune(now)
+	agentEntry := t.entry(t.agents, SourceTypeAgent, agent, "", now)
+	agentEntry.stats.Batches++
+	agentEntry.stats.AcceptedTotal += int64(accepted)
+	agentEntry.stats.RejectedTotal += int64(rejected)
+	agentEntry.add(now, int64(accepted), int64(rejected))
+	if err != nil {
+		agentEntry.stats.LastError = err.Error()
+		agentEntry.stats.LastErrorTime = now
+	}
+
+	// 按設備分組，每組視為該設備的一個批次
+	perDevice := make(map[string]int)
+	for _, point := range points {
+		if key := DeviceKey(point.Tags); key != "" {
+			perDevice[key]++
+		}
+	}
+
+	for key, count := range perDevice {
+		deviceEntry := t.entry(t.devices, SourceTypeDevice, key, agent, now)
+		deviceEntry.stats.Agent = agent
+		deviceEntry.stats.Batches++
+		if rejected > 0 {
+			deviceEntry.stats.RejectedTotal += int64(count)
+			deviceEntry.add(now, 0, int64(count))
+			if err != nil {
+				deviceEntry.stats.LastError = err.Error()
+				deviceEntry.stats.LastErrorTime = now
+			}
+		} else {
+			deviceEntry.stats.AcceptedTotal += int64(count)
+			deviceEntry.add(now, int64(count), 0)
+		}
+	}
+}
+
+// prune 每分鐘最多一次移除超過保留時間未出現的來源，需持有鎖
+func (t *SourceTracker) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < sourcePruneInterval {
+		return
+	}
+	t.lastPrune = now
+
+	for _, entries := range []map[string]*sourceEntry{t.agents, t.devices} {
+		for name, e := range entries {
+			if now.Sub(e.stats.LastSeen) > t.ttl {
+				delete(entries, name)
+				t.evicted++
+			}
+		}
+	}
+}
+
+// evictOldest 移除最久未出現的來源，需持有鎖
+func (t *SourceTracker) evictOldest(entries map[string]*sourceEntry) {
+	var oldest string
+	var oldestSeen time.Time
+	for name, e := range entries {
+		if oldest == "" || e.stats.LastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = name, e.stats.LastSeen
+		}
+	}
+	if oldest != "" {
+		delete(entries, oldest)
+		t.evicted++
+	}
+}
+
+// entry 取得或創建來源記錄並更新最後出現時間，記錄數已達上限時先移除最久未出現的來源
+func (t *SourceTracker) entry(entries map[string]*sourceEntry, sourceType, name, agent string, now time.Time) *sourceEntry {
+	e, ok := entries[name]
+	if !ok {
+		if len(entries) >= t.maxEntries {
+			t.evictOldest(entries)
+		}
+		e = &sourceEntry{
+			stats: SourceStats{
+				Type:      sourceType,
+				Name:      name,
+				Agent:     agent,
+				FirstSeen: now,
+			},
+		}
+		entries[name] = e
+	}
+	e.stats.LastSeen = now
+	return e
+}
+
+// SourceSummary 來源數量摘要
+type SourceSummary struct {
+	Agents  int   `json:"agents"`
+	Devices int   `json:"devices"`
+	Evicted int64 `json:"evicted"` // 因過期或超過記錄數上限而移除的來源數
+}
+
+// Summary 返回已追踪的代理與設備數量
+func (t *SourceTracker) Summary() SourceSummary {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return SourceSummary{
+		Agents:  len(t.agents),
+		Devices: len(t.devices),
+		Evicted: t.evicted,
+	}
+}
+
+// List 分頁列出指定類型的來源，按最後出現時間升序排列，最久未出現的在前
+// sourceType 為空時列出所有來源；返回當頁數據與總數，page 或 pageSize 小於 1 時返回空頁
+func (t *SourceTracker) List(sourceType string, page, pageSize int) ([]SourceStats, int) {
+	now := time.Now()
+
+	t.mutex.Lock()
+	t.prune(now)
+	var all []SourceStats
+	if sourceType == "" || sourceType == SourceTypeAgent {
+		for _, e := range t.agents {
+			all = append(all, e.snapshot(now))
+		}
+	}
+	if sourceType == "" || sourceType == SourceTypeDevice {
+		for _, e := range t.devices {
+			all = append(all, e.snapshot(now))
+		}
+	}
+	t.mutex.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].LastSeen.Equal(all[j].LastSeen) {
+			return all[i].LastSeen.Before(all[j].LastSeen)
+		}
+		return all[i].Name < all[j].Name
+	})
+
+	total := len(all)
+	// 先以除法判斷頁數範圍，避免很大的 page 相乘溢出
+	if page < 1 || pageSize < 1 || page-1 >= (total+pageSize-1)/pageSize {
+		return []SourceStats{}, total
+	}
+	start := (page - 1) * pageSize
+	end := total
+	if pageSize < total-start {
+		end = start + pageSize
+	}
+	return all[start:end], total
+}
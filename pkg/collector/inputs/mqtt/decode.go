@@ -0,0 +1,196 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"viot/models"
+)
+
+// Decode 依訂閱規則將一則 MQTT 訊息轉換為數據點
+// 載荷可為單個 JSON 物件或物件陣列，每個物件轉換為一個數據點
+func Decode(sub models.MQTTSubscription, topic string, payload []byte, received time.Time) ([]models.RestAPIPoint, error) {
+	var body interface{}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, fmt.Errorf("解析 JSON 載荷失敗: %w", err)
+	}
+
+	var objects []interface{}
+	if list, ok := body.([]interface{}); ok {
+		objects = list
+	} else {
+		objects = []interface{}{body}
+	}
+
+	topicTags := TopicTags(sub.TopicTags, topic)
+	measurement := sub.Measurement
+	if measurement == "" {
+		measurement = topic
+	}
+
+	points := make([]models.RestAPIPoint, 0, len(objects))
+	for i, object := range objects {
+		point, err := decodeObject(sub, object, received)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 個物件: %w", i, err)
+		}
+
+		point.Metric = measurement
+		for k, v := range topicTags {
+			point.Tags[k] = v
+		}
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// TopicTags 依 / 分隔的標籤名稱從主題各段取得標籤，_ 或空名稱的段會被略過
+func TopicTags(pattern, topic string) map[string]string {
+	tags := make(map[string]string)
+	if pattern == "" {
+		return tags
+	}
+
+	names := strings.Split(pattern, "/")
+	segments := strings.Split(topic, "/")
+	for i, name := range names {
+		if i >= len(segments) {
+			break
+		}
+		if name == "" || name == "_" || segments[i] == "" {
+			continue
+		}
+		tags[name] = segments[i]
+	}
+	return tags
+}
+
+// decodeObject 依字段映射從單個 JSON 物件取出字段、標籤與時間戳
+func decodeObject(sub models.MQTTSubscription, object interface{}, received time.Time) (models.RestAPIPoint, error) {
+	point := models.RestAPIPoint{
+		Tags:      make(map[string]string),
+		Fields:    make(map[string]interface{}),
+		Timestamp: received,
+	}
+
+	if len(sub.Fields) == 0 {
+		// 未配置映射時取頂層所有數值
+		top, ok := object.(map[string]interface{})
+		if !ok {
+			return point, fmt.Errorf("載荷不是 JSON 物件")
+		}
+		for k, v := range top {
+			if value, ok := toFloat(v); ok {
+				point.Fields[k] = value
+			}
+		}
+	} else {
+		for field, path := range sub.Fields {
+			v, ok := lookup(object, path)
+			if !ok {
+				continue
+			}
+			value, ok := toFloat(v)
+			if !ok {
+				return point, fmt.Errorf("字段 %s (%s) 不是數值: %v", field, path, v)
+			}
+			point.Fields[field] = value
+		}
+	}
+	if len(point.Fields) == 0 {
+		return point, fmt.Errorf("載荷中沒有可用的字段")
+	}
+
+	for tag, path := range sub.Tags {
+		if v, ok := lookup(object, path); ok && v != nil {
+			point.Tags[tag] = fmt.Sprint(v)
+		}
+	}
+
+	if sub.TimestampPath != "" {
+		v, ok := lookup(object, sub.TimestampPath)
+		if !ok {
+			return point, fmt.Errorf("缺少時間戳 %s", sub.TimestampPath)
+		}
+		ts, err := parseTimestamp(v, sub.TimestampUnits)
+		if err != nil {
+			return point, err
+		}
+		point.Timestamp = ts
+	}
+
+	// 單一字段的數據點以該字段作為主要值
+	if len(point.Fields) == 1 {
+		for _, value := range point.Fields {
+			point.Value = value.(float64)
+		}
+	}
+
+	return point, nil
+}
+
+// lookup 以 . 分隔的路徑取值，陣列元素以數字索引表示，如 readings.0.current
+func lookup(object interface{}, path string) (interface{}, bool) {
+	current := object
+	for _, key := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			current = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// toFloat 將 JSON 值轉換為浮點數，接受數值、數字字串與布林值
+func toFloat(v interface{}) (float64, bool) {
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case bool:
+		if value {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// parseTimestamp 解析數值（依 units 換算，默認秒）或 RFC3339 字串時間戳
+func parseTimestamp(v interface{}, units time.Duration) (time.Time, error) {
+	if units <= 0 {
+		units = time.Second
+	}
+
+	switch value := v.(type) {
+	case float64:
+		return time.Unix(0, int64(value*float64(units))), nil
+	case string:
+		if ts, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return ts, nil
+		}
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return time.Unix(0, int64(f*float64(units))), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("無效的時間戳: %v", v)
+}
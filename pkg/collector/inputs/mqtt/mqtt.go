@@ -0,0 +1,141 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"viot/logger"
+	"viot/models"
+	"viot/pkg/collector/core"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+)
+
+// Input MQTT 訂閱輸入插件，接收設備自行發布的 JSON 讀數
+// 每則訊息依訂閱規則轉換為數據點後交給 DataHandler（通常為 InputManager）
+type Input struct {
+	*core.BaseDeviceInput
+	config  *models.MQTTConfig
+	handler core.DataHandler
+	logger  logger.Logger
+	client  paho.Client
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func init() {
+	core.RegisterInputFactory("mqtt", func(config *models.CollectorConfig, handler core.DataHandler, logger logger.Logger) (core.Input, error) {
+		if config == nil || !config.MQTT.Enabled {
+			return nil, nil
+		}
+		return NewInput(&config.MQTT, handler, logger), nil
+	})
+}
+
+// NewInput 創建 MQTT 輸入插件
+func NewInput(config *models.MQTTConfig, handler core.DataHandler, logger logger.Logger) *Input {
+	return &Input{
+		BaseDeviceInput: core.NewBaseDeviceInput("mqtt", nil, logger),
+		config:          config.MergeWithDefault(),
+		handler:         handler,
+		logger:          logger.Named("mqtt-input"),
+	}
+}
+
+// Start 在背景連接代理伺服器，連線成功後訂閱所有主題
+// 代理伺服器無法連線時不返回錯誤，客戶端持續重試，不影響其他輸入插件啟動；
+// 斷線後由客戶端自動重連，重連成功時重新訂閱
+func (m *Input) Start(ctx context.Context) error {
+	if m.config.Broker == "" {
+		return fmt.Errorf("未設置 MQTT 代理伺服器地址")
+	}
+	if len(m.config.Subscriptions) == 0 {
+		return fmt.Errorf("未設置 MQTT 訂閱主題")
+	}
+
+	m.ctx, m.cancel = context.WithCancel(ctx)
+
+	opts := paho.NewClientOptions().
+		AddBroker(m.config.Broker).
+		SetClientID(m.config.ClientID).
+		SetUsername(m.config.Username).
+		SetPassword(m.config.Password).
+		SetConnectTimeout(m.config.ConnectTimeout).
+		SetKeepAlive(m.config.KeepAlive).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(m.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			m.logger.Warn("MQTT 連線中斷，等待自動重連", zap.Error(err))
+			m.UpdateError(err)
+		})
+
+	m.client = paho.NewClient(opts)
+	// 啟用 ConnectRetry 時 Connect 在背景重試，不需等待
+	m.client.Connect()
+	m.logger.Info("正在連接 MQTT 代理伺服器", zap.String("broker", m.config.Broker))
+
+	return m.BaseDeviceInput.Start(ctx)
+}
+
+// Stop 取消訂閱並斷開連線，停止背景重試
+func (m *Input) Stop() error {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	if m.client != nil {
+		if m.client.IsConnectionOpen() {
+			topics := make([]string, 0, len(m.config.Subscriptions))
+			for _, sub := range m.config.Subscriptions {
+				topics = append(topics, sub.Topic)
+			}
+			m.client.Unsubscribe(topics...).WaitTimeout(m.config.ConnectTimeout)
+		}
+		// 仍在重試連線時亦需斷開，停止背景重試
+		m.client.Disconnect(250)
+	}
+	return m.BaseDeviceInput.Stop()
+}
+
+// onConnect 連線（含重連）成功後訂閱所有主題
+func (m *Input) onConnect(client paho.Client) {
+	m.logger.Info("已連接 MQTT 代理伺服器", zap.String("broker", m.config.Broker))
+
+	for _, sub := range m.config.Subscriptions {
+		sub := sub
+		token := client.Subscribe(sub.Topic, *m.config.QoS, func(_ paho.Client, msg paho.Message) {
+			m.handleMessage(sub, msg)
+		})
+		if !token.WaitTimeout(m.config.ConnectTimeout) || token.Error() != nil {
+			m.logger.Error("訂閱 MQTT 主題失敗",
+				zap.String("topic", sub.Topic),
+				zap.Error(token.Error()))
+			m.UpdateError(fmt.Errorf("訂閱主題 %s 失敗", sub.Topic))
+			continue
+		}
+		m.logger.Info("已訂閱 MQTT 主題", zap.String("topic", sub.Topic))
+	}
+}
+
+// handleMessage 解碼訊息並交給數據處理器
+func (m *Input) handleMessage(sub models.MQTTSubscription, msg paho.Message) {
+	points, err := Decode(sub, msg.Topic(), msg.Payload(), time.Now())
+	if err != nil {
+		m.logger.Warn("解碼 MQTT 訊息失敗",
+			zap.String("topic", msg.Topic()),
+			zap.Error(err))
+		m.UpdateError(err)
+		return
+	}
+
+	if err := m.handler.HandleData(m.ctx, points); err != nil {
+		m.logger.Error("處理 MQTT 數據失敗",
+			zap.String("topic", msg.Topic()),
+			zap.Error(err))
+		m.UpdateError(err)
+		return
+	}
+	m.HandleData(m.ctx, points)
+}
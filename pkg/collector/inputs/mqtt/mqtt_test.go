@@ -0,0 +1,169 @@
+package mqtt
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"viot/internal/mqtttest"
+	"viot/logger"
+	"viot/models"
+	"viot/pkg/collector/core"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// recordingHandler 記錄收到的數據點
+type recordingHandler struct {
+	mutex  sync.Mutex
+	points []models.RestAPIPoint
+}
+
+func (h *recordingHandler) HandleData(_ context.Context, points []models.RestAPIPoint) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.points = append(h.points, points...)
+	return nil
+}
+
+func (h *recordingHandler) received() []models.RestAPIPoint {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]models.RestAPIPoint(nil), h.points...)
+}
+
+func waitUntil(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待條件成立超時")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestInputManagerStartsMQTTInput(t *testing.T) {
+	broker := mqtttest.Start(t, "")
+
+	config := &models.CollectorConfig{}
+	config.MQTT = models.MQTTConfig{
+		Enabled: true,
+		Broker:  broker.URL(),
+		Subscriptions: []models.MQTTSubscription{{
+			Topic:       "power/+/+/+",
+			Measurement: "meter",
+			TopicTags:   "_/factory/room/device",
+			Fields:      map[string]string{"current": "readings.0.current", "voltage": "voltage"},
+		}},
+	}
+
+	manager := core.NewInputManager(config, logger.DefaultLogger)
+	if err := manager.CreateDefaultInputs(); err != nil {
+		t.Fatalf("創建默認輸入插件失敗: %v", err)
+	}
+	if _, err := manager.GetInput("mqtt"); err != nil {
+		t.Fatalf("MQTT 輸入插件未註冊: %v", err)
+	}
+
+	handler := &recordingHandler{}
+	manager.RegisterHandler(handler)
+	if err := manager.StartAll(context.Background()); err != nil {
+		t.Fatalf("啟動輸入插件失敗: %v", err)
+	}
+	defer manager.StopAll()
+
+	waitUntil(t, func() bool { return len(broker.SubscribedQoS()) == 1 })
+	if qos := broker.SubscribedQoS()[0]; qos != 1 {
+		t.Fatalf("未設置 qos 時應以 QoS 1 訂閱，實際為 %d", qos)
+	}
+
+	publisher := paho.NewClient(paho.NewClientOptions().AddBroker(broker.URL()).SetClientID("publisher"))
+	if token := publisher.Connect(); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("發布端連線失敗: %v", token.Error())
+	}
+	defer publisher.Disconnect(0)
+
+	payload := `{"voltage": 229.5, "readings": [{"current": 3.2}]}`
+	if token := publisher.Publish("power/F1/R1/meter-01", 0, false, payload); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("發布訊息失敗: %v", token.Error())
+	}
+
+	waitUntil(t, func() bool { return len(handler.received()) == 1 })
+	point := handler.received()[0]
+	if point.Metric != "meter" {
+		t.Errorf("指標名稱應為 meter，實際為 %q", point.Metric)
+	}
+	if point.Tags["factory"] != "F1" || point.Tags["room"] != "R1" || point.Tags["device"] != "meter-01" {
+		t.Errorf("主題標籤不正確: %v", point.Tags)
+	}
+	if point.Fields["current"] != 3.2 || point.Fields["voltage"] != 229.5 {
+		t.Errorf("字段不正確: %v", point.Fields)
+	}
+}
+
+func TestInputStartsWithoutBroker(t *testing.T) {
+	// 取得一個沒有代理伺服器監聽的地址
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("取得監聽地址失敗: %v", err)
+	}
+	broker := "tcp://" + listener.Addr().String()
+	listener.Close()
+
+	config := &models.CollectorConfig{}
+	config.MQTT = models.MQTTConfig{
+		Enabled:        true,
+		Broker:         broker,
+		ConnectTimeout: time.Second,
+		Subscriptions:  []models.MQTTSubscription{{Topic: "power/#"}},
+	}
+
+	manager := core.NewInputManager(config, logger.DefaultLogger)
+	if err := manager.CreateDefaultInputs(); err != nil {
+		t.Fatalf("創建默認輸入插件失敗: %v", err)
+	}
+
+	// 代理伺服器無法連線時不應阻止其他輸入插件啟動
+	start := time.Now()
+	if err := manager.StartAll(context.Background()); err != nil {
+		t.Fatalf("代理伺服器無法連線時 StartAll 不應返回錯誤: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Start 不應等待連線，實際耗時 %s", elapsed)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		manager.StopAll()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("仍在重試連線時 StopAll 應及時返回")
+	}
+}
+
+func TestMergeWithDefaultQoS(t *testing.T) {
+	zero := byte(0)
+	tests := []struct {
+		name string
+		qos  *byte
+		want byte
+	}{
+		{"未設置", nil, 1},
+		{"明確設置為 0", &zero, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := models.MQTTConfig{QoS: tt.qos}
+			if got := *config.MergeWithDefault().QoS; got != tt.want {
+				t.Errorf("QoS 應為 %d，實際為 %d", tt.want, got)
+			}
+		})
+	}
+}
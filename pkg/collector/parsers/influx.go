@@ -0,0 +1,109 @@
+package parsers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"viot/models"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+// ParsePrecision 將 InfluxDB v2 write API 的 precision 參數轉換為行協議精度
+func ParsePrecision(precision string) (lineprotocol.Precision, error) {
+	switch strings.ToLower(precision) {
+	case "", "ns", "n":
+		return lineprotocol.Nanosecond, nil
+	case "us", "u":
+		return lineprotocol.Microsecond, nil
+	case "ms":
+		return lineprotocol.Millisecond, nil
+	case "s":
+		return lineprotocol.Second, nil
+	default:
+		return lineprotocol.Nanosecond, fmt.Errorf("不支援的時間精度: %s", precision)
+	}
+}
+
+// ParseLineProtocol 將 InfluxDB 行協議批次解析為 API 數據點
+// 任何一行解析失敗時整批拒絕，與 InfluxDB 的行為一致
+func ParseLineProtocol(data []byte, precision lineprotocol.Precision) ([]models.RestAPIPoint, error) {
+	now := time.Now()
+	points := make([]models.RestAPIPoint, 0, bytes.Count(data, []byte("\n"))+1)
+
+	dec := lineprotocol.NewDecoderWithBytes(data)
+	for line := 1; dec.Next(); line++ {
+		point, err := decodeLine(dec, precision, now)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行解析失敗: %w", line, err)
+		}
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// decodeLine 解析單行行協議數據
+func decodeLine(dec *lineprotocol.Decoder, precision lineprotocol.Precision, now time.Time) (models.RestAPIPoint, error) {
+	measurement, err := dec.Measurement()
+	if err != nil {
+		return models.RestAPIPoint{}, err
+	}
+
+	point := models.RestAPIPoint{
+		Metric: string(measurement),
+		Tags:   make(map[string]string),
+		Fields: make(map[string]interface{}),
+	}
+
+	for {
+		key, value, err := dec.NextTag()
+		if err != nil {
+			return models.RestAPIPoint{}, err
+		}
+		if key == nil {
+			break
+		}
+		point.Tags[string(key)] = string(value)
+	}
+
+	for {
+		key, value, err := dec.NextField()
+		if err != nil {
+			return models.RestAPIPoint{}, err
+		}
+		if key == nil {
+			break
+		}
+		point.Fields[string(key)] = value.Interface()
+	}
+
+	timestamp, err := dec.Time(precision, now)
+	if err != nil {
+		return models.RestAPIPoint{}, err
+	}
+	point.Timestamp = timestamp
+
+	// 單值指標沿用 value 字段作為主要值
+	if value, ok := toFloat64(point.Fields["value"]); ok {
+		point.Value = value
+	}
+
+	return point, nil
+}
+
+// toFloat64 將行協議字段值轉換為 float64
+func toFloat64(v interface{}) (float64, bool) {
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case int64:
+		return float64(value), true
+	case uint64:
+		return float64(value), true
+	default:
+		return 0, false
+	}
+}
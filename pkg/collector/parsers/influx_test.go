@@ -0,0 +1,110 @@
+package parsers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+func TestParsePrecision(t *testing.T) {
+	tests := []struct {
+		precision string
+		line      string
+		want      time.Time
+	}{
+		{"", "cpu value=1 1700000000123456789", time.Unix(0, 1700000000123456789)},
+		{"ns", "cpu value=1 1700000000123456789", time.Unix(0, 1700000000123456789)},
+		{"us", "cpu value=1 1700000000123456", time.UnixMicro(1700000000123456)},
+		{"ms", "cpu value=1 1700000000123", time.UnixMilli(1700000000123)},
+		{"s", "cpu value=1 1700000000", time.Unix(1700000000, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run("precision="+tt.precision, func(t *testing.T) {
+			precision, err := ParsePrecision(tt.precision)
+			if err != nil {
+				t.Fatalf("解析精度失敗: %v", err)
+			}
+			points, err := ParseLineProtocol([]byte(tt.line), precision)
+			if err != nil {
+				t.Fatalf("解析行協議失敗: %v", err)
+			}
+			if len(points) != 1 || !points[0].Timestamp.Equal(tt.want) {
+				t.Fatalf("時間戳應為 %v，實際為 %+v", tt.want, points)
+			}
+		})
+	}
+
+	if _, err := ParsePrecision("h"); err == nil {
+		t.Error("不支援的精度應返回錯誤")
+	}
+}
+
+func TestParseLineProtocol(t *testing.T) {
+	body := "pdu,host=pdu-01,room=R3 current=12.5,outlets=24i,count=3u,state=\"on\" 1700000000\n" +
+		"\n" +
+		"temp value=24.1\n"
+
+	before := time.Now()
+	points, err := ParseLineProtocol([]byte(body), mustPrecision(t, "s"))
+	if err != nil {
+		t.Fatalf("解析行協議失敗: %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("應解析出 2 個數據點，實際為 %d", len(points))
+	}
+
+	pdu := points[0]
+	if pdu.Metric != "pdu" || pdu.Tags["host"] != "pdu-01" || pdu.Tags["room"] != "R3" {
+		t.Errorf("指標名稱或標籤不正確: %+v", pdu)
+	}
+	if pdu.Fields["current"] != 12.5 || pdu.Fields["outlets"] != int64(24) ||
+		pdu.Fields["count"] != uint64(3) || pdu.Fields["state"] != "on" {
+		t.Errorf("字段不正確: %v", pdu.Fields)
+	}
+
+	// 沒有時間戳的行使用接收時間（依精度截斷），value 字段作為主要值
+	temp := points[1]
+	if temp.Value != 24.1 {
+		t.Errorf("主要值應為 24.1，實際為 %g", temp.Value)
+	}
+	if temp.Timestamp.Before(before.Truncate(time.Second)) || temp.Timestamp.After(time.Now()) {
+		t.Errorf("沒有時間戳時應使用接收時間，實際為 %v", temp.Timestamp)
+	}
+}
+
+func TestParseLineProtocolRejectsMalformedLines(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"缺少字段", "cpu,host=a 1700000000"},
+		{"字段值無效", "cpu value=abc"},
+		{"時間戳無效", "cpu value=1 abc"},
+		{"未關閉的字串", "cpu value=\"on"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := "cpu value=1\n" + tt.body
+			points, err := ParseLineProtocol([]byte(body), mustPrecision(t, ""))
+			if err == nil {
+				t.Fatalf("格式錯誤的行應使整批被拒絕，實際解析出 %+v", points)
+			}
+			if !strings.Contains(err.Error(), "第 2 行") {
+				t.Errorf("錯誤應指出第 2 行，實際為 %v", err)
+			}
+		})
+	}
+}
+
+func mustPrecision(t *testing.T, precision string) lineprotocol.Precision {
+	t.Helper()
+	p, err := ParsePrecision(precision)
+	if err != nil {
+		t.Fatalf("解析精度失敗: %v", err)
+	}
+	return p
+}
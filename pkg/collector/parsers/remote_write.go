@@ -0,0 +1,265 @@
+package parsers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"viot/models"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DefaultRemoteWriteMeasurement 與 Telegraf inputs.prometheus metric_version = 2 相同的測量名稱
+const DefaultRemoteWriteMeasurement = "prometheus"
+
+// remoteWriteNameLabel Prometheus 保存指標名稱的標籤
+const remoteWriteNameLabel = "__name__"
+
+// remoteWriteSample 解碼後的單個樣本
+type remoteWriteSample struct {
+	value     float64
+	timestamp int64 // 毫秒
+}
+
+// remoteWriteSeries 解碼後的時間序列
+type remoteWriteSeries struct {
+	labels  map[string]string
+	samples []remoteWriteSample
+}
+
+// DecodeRemoteWrite 解壓 snappy 格式的 remote_write 請求內容，解壓後大小超過 maxSize 時返回錯誤
+func DecodeRemoteWrite(data []byte, maxSize int) ([]byte, error) {
+	size, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, fmt.Errorf("無效的 snappy 內容: %w", err)
+	}
+	if maxSize > 0 && size > maxSize {
+		return nil, fmt.Errorf("解壓後內容 %d 位元組超過上限 %d 位元組", size, maxSize)
+	}
+
+	decoded, err := snappy.Decode(nil, data)
+	if err != nil {
+		return nil, fmt.Errorf("解壓 snappy 內容失敗: %w", err)
+	}
+	return decoded, nil
+}
+
+// ParseRemoteWrite 解析 Prometheus remote_write 的 WriteRequest（已解壓的 protobuf）
+// 轉換方式與 Telegraf metric_version = 2 一致：指標名稱成為字段名，其餘標籤成為標籤，
+// 標籤與時間戳相同的樣本合併為同一個數據點；NaN（過期標記）與無窮值會被略過
+func ParseRemoteWrite(data []byte, measurement string) ([]models.RestAPIPoint, error) {
+	if measurement == "" {
+		measurement = DefaultRemoteWriteMeasurement
+	}
+
+	series, err := decodeWriteRequest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]models.RestAPIPoint, 0, len(series))
+	index := make(map[string]int)
+	for _, ts := range series {
+		name := ts.labels[remoteWriteNameLabel]
+		if name == "" {
+			return nil, fmt.Errorf("時間序列缺少 %s 標籤", remoteWriteNameLabel)
+		}
+
+		tags := make(map[string]string, len(ts.labels))
+		for k, v := range ts.labels {
+			if k != remoteWriteNameLabel {
+				tags[k] = v
+			}
+		}
+		key := labelsKey(tags)
+
+		for _, sample := range ts.samples {
+			if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+				continue
+			}
+
+			pointKey := fmt.Sprintf("%s@%d", key, sample.timestamp)
+			i, ok := index[pointKey]
+			if !ok {
+				pointTags := make(map[string]string, len(tags))
+				for k, v := range tags {
+					pointTags[k] = v
+				}
+				i = len(points)
+				index[pointKey] = i
+				points = append(points, models.RestAPIPoint{
+					Metric:    measurement,
+					Tags:      pointTags,
+					Fields:    make(map[string]interface{}),
+					Timestamp: time.UnixMilli(sample.timestamp),
+				})
+			}
+			points[i].Fields[name] = sample.value
+		}
+	}
+
+	// 單一字段的數據點以該字段作為主要值
+	for i := range points {
+		if len(points[i].Fields) == 1 {
+			for _, value := range points[i].Fields {
+				points[i].Value = value.(float64)
+			}
+		}
+	}
+
+	return points, nil
+}
+
+// labelsKey 生成排序後的標籤鍵
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+// decodeWriteRequest 解碼 WriteRequest，只讀取 timeseries (1)，其餘字段略過
+func decodeWriteRequest(data []byte) ([]remoteWriteSeries, error) {
+	var series []remoteWriteSeries
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := decodeTimeSeries(value)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("解析 WriteRequest 失敗: %w", err)
+	}
+	return series, nil
+}
+
+// decodeTimeSeries 解碼 TimeSeries 的 labels (1) 與 samples (2)
+func decodeTimeSeries(data []byte) (remoteWriteSeries, error) {
+	ts := remoteWriteSeries{labels: make(map[string]string)}
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			name, labelValue, err := decodeLabel(value)
+			if err != nil {
+				return err
+			}
+			ts.labels[name] = labelValue
+		case 2:
+			sample, err := decodeSample(value)
+			if err != nil {
+				return err
+			}
+			ts.samples = append(ts.samples, sample)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+// decodeLabel 解碼 Label 的 name (1) 與 value (2)
+func decodeLabel(data []byte) (string, string, error) {
+	var name, value string
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			name = string(v)
+		case 2:
+			value = string(v)
+		}
+		return nil
+	})
+	return name, value, err
+}
+
+// decodeSample 解碼 Sample 的 value (1, double) 與 timestamp (2, int64 毫秒)
+func decodeSample(data []byte) (remoteWriteSample, error) {
+	var sample remoteWriteSample
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return sample, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return sample, protowire.ParseError(n)
+			}
+			sample.value = math.Float64frombits(v)
+			data = data[n:]
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return sample, protowire.ParseError(n)
+			}
+			sample.timestamp = int64(v)
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return sample, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return sample, nil
+}
+
+// walkMessage 逐個讀取訊息字段，長度前綴字段以原始內容傳給 fn，其餘類型傳入 nil
+func walkMessage(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var value []byte
+		if typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value = v
+			data = data[n:]
+		} else {
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package parsers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"viot/models"
+)
+
+// ParseRestAPIJSON 解析 ViOT 自有的 JSON 格式，接受單個數據點或數據點陣列
+func ParseRestAPIJSON(data []byte) ([]models.RestAPIPoint, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("請求內容為空")
+	}
+
+	var points []models.RestAPIPoint
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &points); err != nil {
+			return nil, fmt.Errorf("解析數據點陣列失敗: %w", err)
+		}
+	} else {
+		var point models.RestAPIPoint
+		if err := json.Unmarshal(data, &point); err != nil {
+			return nil, fmt.Errorf("解析數據點失敗: %w", err)
+		}
+		points = append(points, point)
+	}
+
+	now := time.Now()
+	for i := range points {
+		if points[i].Metric == "" {
+			return nil, fmt.Errorf("第 %d 個數據點缺少指標名稱", i)
+		}
+		if points[i].Timestamp.IsZero() {
+			points[i].Timestamp = now
+		}
+	}
+
+	return points, nil
+}
@@ -0,0 +1,184 @@
+package parsers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"viot/models"
+)
+
+// DefaultTimestampUnits Telegraf JSON 序列化器預設的 json_timestamp_units
+const DefaultTimestampUnits = time.Second
+
+// TelegrafMetric Telegraf data_format = "json" 輸出的單個指標
+type TelegrafMetric struct {
+	Name      string                 `json:"name"`
+	Tags      map[string]string      `json:"tags"`
+	Fields    map[string]interface{} `json:"fields"`
+	Timestamp json.Number            `json:"timestamp"`
+}
+
+// Rejection 被拒絕的指標及原因
+type Rejection struct {
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error"`
+}
+
+// ParseTimestampUnits 解析 json_timestamp_units 參數，為空時使用預設值
+func ParseTimestampUnits(units string) (time.Duration, error) {
+	if units == "" {
+		return DefaultTimestampUnits, nil
+	}
+
+	d, err := time.ParseDuration(units)
+	if err != nil {
+		return 0, fmt.Errorf("無效的時間戳單位 %s: %w", units, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("時間戳單位必須大於 0: %s", units)
+	}
+	return d, nil
+}
+
+// IsTelegrafJSON 判斷請求內容是否為 Telegraf 原生 JSON 格式
+// 批次格式為 {"metrics":[...]}，非批次格式為單個 {"name","tags","fields","timestamp"}
+func IsTelegrafJSON(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return false
+	}
+
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+
+	if _, ok := probe["metrics"]; ok {
+		return true
+	}
+
+	_, hasName := probe["name"]
+	_, hasFields := probe["fields"]
+	_, hasMetric := probe["metric"]
+	return hasName && hasFields && !hasMetric
+}
+
+// TelegrafBatch Telegraf JSON 批次的解析結果
+type TelegrafBatch struct {
+	Points     []models.RestAPIPoint
+	Indexes    []int // Points 中每個數據點在原始批次中的位置
+	Rejections []Rejection
+}
+
+// Reject 記錄批次中第 index 個數據點被拒絕
+func (b *TelegrafBatch) Reject(index int, name string, err error) {
+	b.Rejections = append(b.Rejections, Rejection{Index: index, Name: name, Error: err.Error()})
+}
+
+// ParseTelegrafJSON 解析 Telegraf 原生 JSON 格式，逐個指標驗證
+// 格式錯誤的指標不會中斷整批解析，而是記錄在批次的拒絕列表中
+func ParseTelegrafJSON(data []byte, units time.Duration) (*TelegrafBatch, error) {
+	var payload struct {
+		Metrics []json.RawMessage `json:"metrics"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("解析 Telegraf JSON 失敗: %w", err)
+	}
+
+	// 非批次格式時整個請求就是一個指標
+	if payload.Metrics == nil {
+		payload.Metrics = []json.RawMessage{data}
+	}
+
+	batch := &TelegrafBatch{
+		Points:  make([]models.RestAPIPoint, 0, len(payload.Metrics)),
+		Indexes: make([]int, 0, len(payload.Metrics)),
+	}
+
+	for i, raw := range payload.Metrics {
+		var metric TelegrafMetric
+		if err := json.Unmarshal(raw, &metric); err != nil {
+			batch.Reject(i, "", err)
+			continue
+		}
+
+		point, err := metric.toPoint(units)
+		if err != nil {
+			batch.Reject(i, metric.Name, err)
+			continue
+		}
+		batch.Points = append(batch.Points, point)
+		batch.Indexes = append(batch.Indexes, i)
+	}
+
+	return batch, nil
+}
+
+// toPoint 將 Telegraf 指標轉換為 API 數據點
+func (m TelegrafMetric) toPoint(units time.Duration) (models.RestAPIPoint, error) {
+	if m.Name == "" {
+		return models.RestAPIPoint{}, fmt.Errorf("缺少指標名稱")
+	}
+	if len(m.Fields) == 0 {
+		return models.RestAPIPoint{}, fmt.Errorf("缺少字段")
+	}
+
+	for key, value := range m.Fields {
+		switch value.(type) {
+		case float64, string, bool:
+		default:
+			return models.RestAPIPoint{}, fmt.Errorf("字段 %s 的類型 %T 不受支援", key, value)
+		}
+	}
+
+	timestamp, err := m.timestamp(units)
+	if err != nil {
+		return models.RestAPIPoint{}, err
+	}
+
+	point := models.RestAPIPoint{
+		Metric:    m.Name,
+		Tags:      m.Tags,
+		Fields:    m.Fields,
+		Timestamp: timestamp,
+	}
+	if point.Tags == nil {
+		point.Tags = make(map[string]string)
+	}
+
+	// 單值指標沿用 value 字段作為主要值
+	if value, ok := m.Fields["value"].(float64); ok {
+		point.Value = value
+	}
+
+	return point, nil
+}
+
+// timestamp 依 json_timestamp_units 換算時間戳，未提供時使用當前時間
+// 換算後超出 time.Time 以納秒表示的範圍（約 1678 至 2262 年）時返回錯誤，通常是單位設置與時間戳不符
+func (m TelegrafMetric) timestamp(units time.Duration) (time.Time, error) {
+	if m.Timestamp == "" {
+		return time.Now(), nil
+	}
+
+	if ts, err := m.Timestamp.Int64(); err == nil {
+		if ts > math.MaxInt64/int64(units) || ts < math.MinInt64/int64(units) {
+			return time.Time{}, fmt.Errorf("時間戳 %d 以單位 %s 換算後超出範圍", ts, units)
+		}
+		return time.Unix(0, ts*int64(units)), nil
+	}
+
+	ts, err := m.Timestamp.Float64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("無效的時間戳: %s", m.Timestamp)
+	}
+	ns := ts * float64(units)
+	if math.IsNaN(ns) || ns >= math.MaxInt64 || ns < math.MinInt64 {
+		return time.Time{}, fmt.Errorf("時間戳 %s 以單位 %s 換算後超出範圍", m.Timestamp, units)
+	}
+	return time.Unix(0, int64(ns)), nil
+}
@@ -0,0 +1,165 @@
+package parsers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsTelegrafJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"批次", `{"metrics":[{"name":"cpu","fields":{"value":1}}]}`, true},
+		{"單個指標", `{"name":"cpu","tags":{},"fields":{"value":1},"timestamp":1700000000}`, true},
+		{"ViOT JSON", `{"metric":"cpu","name":"x","fields":{"value":1}}`, false},
+		{"ViOT JSON 陣列", `[{"metric":"cpu","value":1}]`, false},
+		{"格式錯誤", `{"metrics":`, false},
+		{"空白", "  ", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTelegrafJSON([]byte(tt.body)); got != tt.want {
+				t.Errorf("IsTelegrafJSON 應為 %v，實際為 %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseTelegrafJSONBatch(t *testing.T) {
+	body := `{"metrics":[
+		{"name":"pdu","tags":{"host":"pdu-01"},"fields":{"current":12.5,"state":"on"},"timestamp":1700000000},
+		{"name":"","fields":{"value":1},"timestamp":1700000000},
+		"not a metric",
+		{"name":"temp","fields":{"value":24.1},"timestamp":1700000001}
+	]}`
+
+	batch, err := ParseTelegrafJSON([]byte(body), DefaultTimestampUnits)
+	if err != nil {
+		t.Fatalf("解析批次失敗: %v", err)
+	}
+
+	if len(batch.Points) != 2 {
+		t.Fatalf("應接收 2 個指標，實際為 %d", len(batch.Points))
+	}
+	if batch.Indexes[0] != 0 || batch.Indexes[1] != 3 {
+		t.Errorf("數據點在原始批次中的位置應為 [0 3]，實際為 %v", batch.Indexes)
+	}
+	pdu := batch.Points[0]
+	if pdu.Metric != "pdu" || pdu.Tags["host"] != "pdu-01" || pdu.Fields["current"] != 12.5 {
+		t.Errorf("數據點不正確: %+v", pdu)
+	}
+	if !pdu.Timestamp.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("時間戳不正確: %v", pdu.Timestamp)
+	}
+	if temp := batch.Points[1]; temp.Value != 24.1 || temp.Tags == nil {
+		t.Errorf("單值指標應以 value 為主要值並有非 nil 的標籤: %+v", temp)
+	}
+
+	if len(batch.Rejections) != 2 {
+		t.Fatalf("應拒絕 2 個指標，實際為 %+v", batch.Rejections)
+	}
+	if batch.Rejections[0].Index != 1 || batch.Rejections[1].Index != 2 {
+		t.Errorf("被拒絕指標的位置應為 1 與 2，實際為 %+v", batch.Rejections)
+	}
+}
+
+func TestParseTelegrafJSONSingleMetric(t *testing.T) {
+	body := `{"name":"pdu","tags":{"host":"pdu-01"},"fields":{"value":3},"timestamp":1700000000}`
+
+	batch, err := ParseTelegrafJSON([]byte(body), DefaultTimestampUnits)
+	if err != nil {
+		t.Fatalf("解析單個指標失敗: %v", err)
+	}
+	if len(batch.Points) != 1 || len(batch.Rejections) != 0 {
+		t.Fatalf("應接收 1 個指標，實際為 %+v", batch)
+	}
+	if point := batch.Points[0]; point.Metric != "pdu" || point.Value != 3 || batch.Indexes[0] != 0 {
+		t.Errorf("數據點不正確: %+v", point)
+	}
+
+	if _, err := ParseTelegrafJSON([]byte(`{"metrics":`), DefaultTimestampUnits); err == nil {
+		t.Error("格式錯誤的請求應返回錯誤")
+	}
+}
+
+func TestTelegrafJSONTimestampUnits(t *testing.T) {
+	tests := []struct {
+		units     string
+		timestamp string
+		want      time.Time
+	}{
+		{"", "1700000000", time.Unix(1700000000, 0)},
+		{"1s", "1700000000.5", time.Unix(1700000000, 500000000)},
+		{"1ms", "1700000000123", time.UnixMilli(1700000000123)},
+		{"1us", "1700000000123456", time.UnixMicro(1700000000123456)},
+		{"1ns", "1700000000123456789", time.Unix(0, 1700000000123456789)},
+		{"10ms", "170000000012", time.UnixMilli(1700000000120)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.units+"/"+tt.timestamp, func(t *testing.T) {
+			units, err := ParseTimestampUnits(tt.units)
+			if err != nil {
+				t.Fatalf("解析時間戳單位失敗: %v", err)
+			}
+			body := `{"name":"cpu","fields":{"value":1},"timestamp":` + tt.timestamp + `}`
+			batch, err := ParseTelegrafJSON([]byte(body), units)
+			if err != nil {
+				t.Fatalf("解析失敗: %v", err)
+			}
+			if len(batch.Points) != 1 {
+				t.Fatalf("應接收指標，實際拒絕: %+v", batch.Rejections)
+			}
+			if got := batch.Points[0].Timestamp; !got.Equal(tt.want) {
+				t.Errorf("時間戳應為 %v，實際為 %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTelegrafJSONTimestampOverflow(t *testing.T) {
+	// 單位設置與時間戳不符，換算後超出範圍的指標應被拒絕，而不是得到溢出後的時間
+	tests := []struct {
+		units     time.Duration
+		timestamp string
+	}{
+		{time.Second, "1700000000123"},
+		{time.Millisecond, "1700000000123456789"},
+		{time.Second, "1700000000123.5"},
+		{time.Second, "-1700000000123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.units.String()+"/"+tt.timestamp, func(t *testing.T) {
+			body := `{"metrics":[{"name":"cpu","fields":{"value":1},"timestamp":` + tt.timestamp + `}]}`
+			batch, err := ParseTelegrafJSON([]byte(body), tt.units)
+			if err != nil {
+				t.Fatalf("解析失敗: %v", err)
+			}
+			if len(batch.Points) != 0 {
+				t.Fatalf("超出範圍的時間戳應被拒絕，實際為 %v", batch.Points[0].Timestamp)
+			}
+			if len(batch.Rejections) != 1 || !strings.Contains(batch.Rejections[0].Error, "超出範圍") {
+				t.Errorf("拒絕原因應為超出範圍，實際為 %+v", batch.Rejections)
+			}
+		})
+	}
+}
+
+func TestParseTimestampUnits(t *testing.T) {
+	if units, err := ParseTimestampUnits(""); err != nil || units != DefaultTimestampUnits {
+		t.Errorf("未設置時應為 %v，實際為 %v, %v", DefaultTimestampUnits, units, err)
+	}
+	if units, err := ParseTimestampUnits("1ms"); err != nil || units != time.Millisecond {
+		t.Errorf("應為 1ms，實際為 %v, %v", units, err)
+	}
+	for _, invalid := range []string{"0s", "-1s", "ms"} {
+		if _, err := ParseTimestampUnits(invalid); err == nil {
+			t.Errorf("%q 應返回錯誤", invalid)
+		}
+	}
+}
@@ -126,6 +126,20 @@ func (p *BaseProcessor) IncrementErrorCount(count int64) {
 	p.status.ErrorCount += count
 }
 
+// IncrementQuarantinedCount 增加未通過驗證而丟棄的數據計數
+func (p *BaseProcessor) IncrementQuarantinedCount(count int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.status.QuarantinedCount += count
+}
+
+// IncrementFlaggedCount 增加標記後仍輸出的數據計數
+func (p *BaseProcessor) IncrementFlaggedCount(count int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.status.FlaggedCount += count
+}
+
 // GetConfig 獲取處理器配置
 func (p *BaseProcessor) GetConfig() models.ProcessorConfig {
 	return p.config
@@ -164,6 +178,20 @@ func (p *BaseProcessor) GetErrorCount() int64 {
 	return p.status.ErrorCount
 }
 
+// GetQuarantinedCount 獲取未通過驗證而丟棄的數據計數
+func (p *BaseProcessor) GetQuarantinedCount() int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.status.QuarantinedCount
+}
+
+// GetFlaggedCount 獲取標記後仍輸出的數據計數
+func (p *BaseProcessor) GetFlaggedCount() int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.status.FlaggedCount
+}
+
 // GetLastError 獲取最後錯誤
 func (p *BaseProcessor) GetLastError() string {
 	p.mutex.RLock()
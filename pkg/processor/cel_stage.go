@@ -0,0 +1,348 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"viot/models"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"go.uber.org/zap"
+)
+
+func init() {
+	RegisterStageType("cel", newCELStage)
+}
+
+// CEL 表達式執行失敗（如字段或標籤不存在）時的處理方式
+const (
+	celOnErrorKeep = "keep" // 保留原數據（默認）
+	celOnErrorFlag = "flag" // 保留原數據並加上 cel_error 標籤
+	celOnErrorDrop = "drop" // 丟棄該筆數據
+)
+
+// CELErrorTag 表達式執行失敗且 on_error 為 flag 時加上的標籤，值為階段名稱
+const CELErrorTag = "cel_error"
+
+// celEnv CEL 表達式可使用的變數
+// fields 為展開後的數值字段（見 pduFieldMap），tags 為標籤，name 為數據名稱，time 為時間戳
+// 允許 double 與整數直接比較，fields.current > 0 不必寫成 0.0
+var celEnv = func() *cel.Env {
+	env, err := cel.NewEnv(
+		cel.Variable("fields", cel.MapType(cel.StringType, cel.DoubleType)),
+		cel.Variable("tags", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("name", cel.StringType),
+		cel.Variable("time", cel.TimestampType),
+		cel.CrossTypeNumericComparisons(true),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return env
+}()
+
+// celExpression 已編譯的 CEL 表達式
+type celExpression struct {
+	name    string // 字段或標籤名稱，filter 為 "filter"
+	source  string
+	program cel.Program
+}
+
+// celAssignment 階段選項中的字段或標籤表達式，依列出的順序計算
+type celAssignment struct {
+	Name string `yaml:"name"`
+	Expr string `yaml:"expr"`
+}
+
+// celStage 以 CEL 表達式過濾數據、計算字段與改寫標籤
+// 依序執行 filter、fields、tags；後面的表達式可使用前面計算的字段與標籤
+type celStage struct {
+	name     string
+	filter   *celExpression
+	fields   []celExpression
+	tags     []celExpression
+	onError  string
+	pipeline *Pipeline
+
+	warned     map[string]bool
+	evalErrors int64
+	mutex      sync.Mutex
+}
+
+func newCELStage(config StageConfig, pipeline *Pipeline) (Stage, error) {
+	var opts struct {
+		Filter  string          `yaml:"filter"`
+		Fields  []celAssignment `yaml:"fields"`
+		Tags    []celAssignment `yaml:"tags"`
+		OnError string          `yaml:"on_error"`
+	}
+	if err := stageOptions(config.Options, &opts); err != nil {
+		return nil, err
+	}
+
+	s := &celStage{
+		name:     config.Name,
+		onError:  opts.OnError,
+		pipeline: pipeline,
+		warned:   make(map[string]bool),
+	}
+	switch s.onError {
+	case "":
+		s.onError = celOnErrorKeep
+	case celOnErrorKeep, celOnErrorFlag, celOnErrorDrop:
+	default:
+		return nil, fmt.Errorf("無效的 on_error %q，可用值為 keep、flag 或 drop", opts.OnError)
+	}
+
+	if opts.Filter != "" {
+		expr, err := compileCEL("filter", opts.Filter, cel.BoolType)
+		if err != nil {
+			return nil, err
+		}
+		s.filter = &expr
+	}
+	for _, field := range opts.Fields {
+		if field.Name == "" {
+			return nil, fmt.Errorf("字段表達式 %q 缺少 name", field.Expr)
+		}
+		expr, err := compileCEL("字段 "+field.Name, field.Expr, cel.DoubleType, cel.IntType, cel.UintType)
+		if err != nil {
+			return nil, err
+		}
+		expr.name = field.Name
+		s.fields = append(s.fields, expr)
+	}
+	for _, tag := range opts.Tags {
+		if tag.Name == "" {
+			return nil, fmt.Errorf("標籤表達式 %q 缺少 name", tag.Expr)
+		}
+		expr, err := compileCEL("標籤 "+tag.Name, tag.Expr, cel.StringType)
+		if err != nil {
+			return nil, err
+		}
+		expr.name = tag.Name
+		s.tags = append(s.tags, expr)
+	}
+
+	if s.filter == nil && len(s.fields) == 0 && len(s.tags) == 0 {
+		return nil, fmt.Errorf("未設置 filter、fields 或 tags")
+	}
+	return s, nil
+}
+
+// compileCEL 編譯並檢查表達式的返回類型
+func compileCEL(label, source string, allowed ...*cel.Type) (celExpression, error) {
+	ast, iss := celEnv.Compile(source)
+	if iss.Err() != nil {
+		return celExpression{}, fmt.Errorf("%s 編譯失敗: %w", label, iss.Err())
+	}
+
+	matched := false
+	for _, t := range allowed {
+		if ast.OutputType().IsExactType(t) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return celExpression{}, fmt.Errorf("%s 的返回類型為 %s，應為 %s", label, ast.OutputType(), typeNames(allowed))
+	}
+
+	program, err := celEnv.Program(ast)
+	if err != nil {
+		return celExpression{}, fmt.Errorf("%s 創建程序失敗: %w", label, err)
+	}
+	return celExpression{name: label, source: source, program: program}, nil
+}
+
+// typeNames 返回類型名稱列表
+func typeNames(list []*cel.Type) string {
+	names := ""
+	for i, t := range list {
+		if i > 0 {
+			names += " 或 "
+		}
+		names += t.String()
+	}
+	return names
+}
+
+// Process 依序執行過濾、字段與標籤表達式
+func (s *celStage) Process(_ context.Context, data []models.PDUData) ([]models.PDUData, error) {
+	result := data[:0]
+	for _, pdu := range data {
+		keep, err := s.apply(&pdu)
+		if err != nil {
+			s.warn(err)
+			switch s.onError {
+			case celOnErrorDrop:
+				continue
+			case celOnErrorFlag:
+				pdu.Tags = copyTags(pdu.Tags)
+				pdu.Tags[CELErrorTag] = s.name
+			}
+		}
+		if keep {
+			result = append(result, pdu)
+		}
+	}
+	return result, nil
+}
+
+// apply 對單筆數據執行表達式，返回是否保留
+// 錯誤時 keep 為 true，由 on_error 決定是否保留原數據
+func (s *celStage) apply(pdu *models.PDUData) (bool, error) {
+	fields := pduFieldMap(*pdu)
+	tags := copyTags(pdu.Tags)
+	activation := map[string]interface{}{
+		"fields": fields,
+		"tags":   tags,
+		"name":   pdu.Name,
+		"time":   pdu.Timestamp,
+	}
+
+	if s.filter != nil {
+		out, _, err := s.filter.program.Eval(activation)
+		if err != nil {
+			return true, fmt.Errorf("%s: %w", s.filter.name, err)
+		}
+		if out != types.True {
+			return false, nil
+		}
+	}
+
+	var computed map[string]float64
+	for _, expr := range s.fields {
+		out, _, err := expr.program.Eval(activation)
+		if err != nil {
+			return true, fmt.Errorf("字段 %s: %w", expr.name, err)
+		}
+		var value float64
+		switch v := out.Value().(type) {
+		case float64:
+			value = v
+		case int64:
+			value = float64(v)
+		case uint64:
+			value = float64(v)
+		}
+		if computed == nil {
+			computed = make(map[string]float64, len(pdu.Fields)+len(s.fields))
+			for k, v := range pdu.Fields {
+				computed[k] = v
+			}
+		}
+		computed[expr.name] = value
+		fields[expr.name] = value
+	}
+
+	tagsChanged := false
+	for _, expr := range s.tags {
+		out, _, err := expr.program.Eval(activation)
+		if err != nil {
+			return true, fmt.Errorf("標籤 %s: %w", expr.name, err)
+		}
+		// 返回空字串時移除標籤
+		if value, _ := out.Value().(string); value != "" {
+			tags[expr.name] = value
+		} else {
+			delete(tags, expr.name)
+		}
+		tagsChanged = true
+	}
+
+	if computed != nil {
+		pdu.Fields = computed
+	}
+	if tagsChanged {
+		pdu.Tags = tags
+	}
+	return true, nil
+}
+
+// warn 記錄並計數表達式執行錯誤，同一錯誤只以警告記錄第一次，之後以除錯等級記錄
+func (s *celStage) warn(err error) {
+	s.mutex.Lock()
+	s.evalErrors++
+	first := !s.warned[err.Error()]
+	s.warned[err.Error()] = true
+	s.mutex.Unlock()
+
+	fields := []zap.Field{zap.String("stage", s.name), zap.String("on_error", s.onError), zap.Error(err)}
+	if first {
+		s.pipeline.logger.Warn("CEL 表達式執行失敗", fields...)
+	} else {
+		s.pipeline.logger.Debug("CEL 表達式執行失敗", fields...)
+	}
+}
+
+// EvalErrors 返回表達式執行失敗的數據筆數，顯示於管線狀態的 eval_errors
+func (s *celStage) EvalErrors() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.evalErrors
+}
+
+// pduFieldMap 將 PDU 數據展開為字段表，命名與 HandlePDUData 相同：
+// 總體為物理量名稱，其餘為 phase_<id>_<quantity>、branch_<id>_<quantity>、outlet_<id>_<quantity>、env_<id>_<type>，
+// 相位另有與原始字段相同的 <quantity>_<id> 別名（如 power_L1），並包含之前階段計算的字段
+func pduFieldMap(pdu models.PDUData) map[string]float64 {
+	fields := map[string]float64{
+		"current":           pdu.Current,
+		"voltage":           pdu.Voltage,
+		"power":             pdu.Power,
+		"energy":            pdu.Energy,
+		"energy_delta":      pdu.EnergyDelta,
+		"apparent_power":    pdu.ApparentPower,
+		"power_factor":      pdu.PowerFactor,
+		"current_imbalance": pdu.CurrentImbalance,
+		"neutral_current":   pdu.NeutralCurrent,
+	}
+	set := func(prefix, suffix string, values map[string]float64) {
+		for quantity, value := range values {
+			fields[prefix+quantity+suffix] = value
+		}
+	}
+
+	for _, phase := range pdu.Phases {
+		values := map[string]float64{
+			"current":        phase.Current,
+			"voltage":        phase.Voltage,
+			"power":          phase.Power,
+			"energy":         phase.Energy,
+			"energy_delta":   phase.EnergyDelta,
+			"apparent_power": phase.ApparentPower,
+			"power_factor":   phase.PowerFactor,
+			"line_voltage":   phase.LineVoltage,
+		}
+		set("phase_"+phase.ID+"_", "", values)
+		set("", "_"+phase.ID, values)
+	}
+	for _, branch := range pdu.Branches {
+		set("branch_"+branch.ID+"_", "", map[string]float64{
+			"current":      branch.Current,
+			"voltage":      branch.Voltage,
+			"power":        branch.Power,
+			"energy":       branch.Energy,
+			"energy_delta": branch.EnergyDelta,
+		})
+	}
+	for _, outlet := range pdu.Outlets {
+		set("outlet_"+outlet.ID+"_", "", map[string]float64{
+			"current":      outlet.Current,
+			"voltage":      outlet.Voltage,
+			"power":        outlet.Power,
+			"energy":       outlet.Energy,
+			"energy_delta": outlet.EnergyDelta,
+		})
+	}
+	for _, probe := range pdu.Environment {
+		fields["env_"+probe.ID+"_"+probe.Type] = probe.Value
+	}
+	for field, value := range pdu.Fields {
+		fields[field] = value
+	}
+	return fields
+}
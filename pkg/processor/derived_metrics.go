@@ -0,0 +1,117 @@
+package processor
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"viot/models"
+)
+
+// derivedFieldSuffixes 處理器輸出的衍生字段後綴，重新處理輸出數據時不可視為原始讀數
+var derivedFieldSuffixes = []string{
+	"energy_delta",
+	"apparent_power",
+	"power_factor",
+	"line_voltage",
+	"current_imbalance",
+	"neutral_current",
+}
+
+// isDerivedField 判斷字段是否為處理器輸出的衍生字段
+func isDerivedField(field string) bool {
+	for _, suffix := range derivedFieldSuffixes {
+		if strings.HasSuffix(field, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// computeDerivedMetrics 以電流、電壓與功率計算衍生指標
+// 視在功率與功率因數假設電壓單位為 V、電流為 A、功率為 W
+func computeDerivedMetrics(pdu *models.PDUData) {
+	// 相位依 ID 排序（數字 ID 依數值），確保線電壓以固定順序（L1-L2、L2-L3、L3-L1）計算
+	sort.Slice(pdu.Phases, func(i, j int) bool {
+		return lessID(pdu.Phases[i].ID, pdu.Phases[j].ID)
+	})
+
+	var phaseApparent float64
+	for i := range pdu.Phases {
+		phase := &pdu.Phases[i]
+		phase.ApparentPower = phase.Voltage * phase.Current
+		phase.PowerFactor = powerFactor(phase.Power, phase.ApparentPower)
+		phaseApparent += phase.ApparentPower
+	}
+
+	// 總視在功率：有相位數據時為各相之和，否則以總電壓與總電流計算
+	if phaseApparent > 0 {
+		pdu.ApparentPower = phaseApparent
+	} else {
+		pdu.ApparentPower = pdu.Voltage * pdu.Current
+	}
+	pdu.PowerFactor = powerFactor(pdu.Power, pdu.ApparentPower)
+
+	if len(pdu.Phases) < 2 {
+		return
+	}
+
+	currents := make([]float64, len(pdu.Phases))
+	for i, phase := range pdu.Phases {
+		currents[i] = phase.Current
+	}
+	pdu.CurrentImbalance = currentImbalance(currents)
+
+	if len(pdu.Phases) != 3 {
+		return
+	}
+
+	pdu.NeutralCurrent = neutralCurrent(currents[0], currents[1], currents[2])
+	for i := range pdu.Phases {
+		next := pdu.Phases[(i+1)%3]
+		pdu.Phases[i].LineVoltage = lineVoltage(pdu.Phases[i].Voltage, next.Voltage)
+	}
+}
+
+// powerFactor 有功功率與視在功率之比，缺少任一數值時為 0，並限制在 1 以內以吸收量測誤差
+func powerFactor(real, apparent float64) float64 {
+	if real <= 0 || apparent <= 0 {
+		return 0
+	}
+	return math.Min(real/apparent, 1)
+}
+
+// currentImbalance 相電流不平衡度：與平均值的最大偏差佔平均值的百分比
+func currentImbalance(currents []float64) float64 {
+	var sum float64
+	for _, c := range currents {
+		sum += c
+	}
+	avg := sum / float64(len(currents))
+	if avg <= 0 {
+		return 0
+	}
+
+	var maxDeviation float64
+	for _, c := range currents {
+		maxDeviation = math.Max(maxDeviation, math.Abs(c-avg))
+	}
+	return maxDeviation / avg * 100
+}
+
+// neutralCurrent 假設三相相角相差 120° 且負載功率因數相同，估算中性線電流
+func neutralCurrent(a, b, c float64) float64 {
+	sq := a*a + b*b + c*c - a*b - b*c - c*a
+	if sq <= 0 {
+		return 0
+	}
+	return math.Sqrt(sq)
+}
+
+// lineVoltage 由相角相差 120° 的兩個相電壓計算線電壓，任一相電壓缺失時為 0
+func lineVoltage(a, b float64) float64 {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	return math.Sqrt(a*a + b*b + a*b)
+}
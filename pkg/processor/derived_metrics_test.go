@@ -0,0 +1,22 @@
+package processor
+
+import (
+	"testing"
+
+	"viot/models"
+)
+
+func TestComputeDerivedMetricsSortsPhasesNumerically(t *testing.T) {
+	pdu := &models.PDUData{
+		Phases: []models.Phase{{ID: "10"}, {ID: "2"}, {ID: "1"}},
+	}
+	computeDerivedMetrics(pdu)
+
+	var ids []string
+	for _, phase := range pdu.Phases {
+		ids = append(ids, phase.ID)
+	}
+	if ids[0] != "1" || ids[1] != "2" || ids[2] != "10" {
+		t.Errorf("數字相位 ID 應依數值排序為 [1 2 10]，實際為 %v", ids)
+	}
+}
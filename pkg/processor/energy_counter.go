@@ -0,0 +1,210 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCounterBits 默認能耗計數器位寬
+	defaultCounterBits = 32
+
+	// defaultEnergySaveInterval 默認計數器狀態保存間隔
+	defaultEnergySaveInterval = time.Minute
+
+	// energyStateTTL 超過此時間未更新的計數器狀態在保存時清除
+	energyStateTTL = 30 * 24 * time.Hour
+
+	// wrapMargin 判斷溢位的範圍比例：上次讀數位於計數器上限附近且本次讀數接近 0 時才視為溢位
+	wrapMargin = 0.1
+)
+
+// CounterResult 單次計數器讀數的計算結果
+type CounterResult int
+
+const (
+	// CounterFirst 首次讀數，無增量
+	CounterFirst CounterResult = iota
+	// CounterNormal 計數器正常遞增
+	CounterNormal
+	// CounterWrapped 計數器溢位後從 0 重新計數
+	CounterWrapped
+	// CounterReset 計數器被重置（如設備重啟），增量為重置後的讀數
+	CounterReset
+	// CounterStale 讀數時間早於上次讀數，忽略
+	CounterStale
+)
+
+// counterState 計數器的上次讀數
+type counterState struct {
+	Value     float64   `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// EnergyCounterStats 能耗計數器統計
+type EnergyCounterStats struct {
+	Counters int       `json:"counters"`
+	Wrapped  int64     `json:"wrapped"`
+	Resets   int64     `json:"resets"`
+	Stale    int64     `json:"stale"`
+	LastSave time.Time `json:"last_save"`
+}
+
+// EnergyCounterTracker 記錄每個設備、分支與相位的能耗計數器上次讀數，計算考慮溢位與重置的增量
+// 狀態可保存到 JSON 文件，重啟後接續計算
+type EnergyCounterTracker struct {
+	mutex        sync.Mutex
+	counters     map[string]counterState
+	stateFile    string
+	saveInterval time.Duration
+	dirty        bool
+	lastSave     time.Time
+	wrapped      int64
+	resets       int64
+	stale        int64
+}
+
+// NewEnergyCounterTracker 創建能耗計數器追蹤器，stateFile 為空時不保存狀態
+func NewEnergyCounterTracker(stateFile string, saveInterval time.Duration) *EnergyCounterTracker {
+	if saveInterval <= 0 {
+		saveInterval = defaultEnergySaveInterval
+	}
+	return &EnergyCounterTracker{
+		counters:     make(map[string]counterState),
+		stateFile:    stateFile,
+		saveInterval: saveInterval,
+		lastSave:     time.Now(),
+	}
+}
+
+// Delta 以本次讀數更新計數器並返回增量
+// modulus 為計數器的溢位上限（已套用比例因子），0 表示計數器不會溢位
+func (t *EnergyCounterTracker) Delta(key string, value float64, ts time.Time, modulus float64) (float64, CounterResult) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	prev, ok := t.counters[key]
+	if ok && !ts.IsZero() && ts.Before(prev.Timestamp) {
+		t.stale++
+		return 0, CounterStale
+	}
+
+	t.counters[key] = counterState{Value: value, Timestamp: ts}
+	t.dirty = true
+
+	if !ok {
+		return 0, CounterFirst
+	}
+	if value >= prev.Value {
+		return value - prev.Value, CounterNormal
+	}
+
+	// 讀數下降：上次讀數接近上限且本次讀數接近 0 時視為溢位，否則視為重置
+	if modulus > 0 && prev.Value >= modulus*(1-wrapMargin) && value <= modulus*wrapMargin {
+		t.wrapped++
+		return modulus - prev.Value + value, CounterWrapped
+	}
+	t.resets++
+	return value, CounterReset
+}
+
+// Load 從狀態文件載入計數器，文件不存在時視為無狀態
+func (t *EnergyCounterTracker) Load() error {
+	if t.stateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(t.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("讀取能耗計數器狀態失敗: %w", err)
+	}
+
+	counters := make(map[string]counterState)
+	if err := json.Unmarshal(data, &counters); err != nil {
+		return fmt.Errorf("解析能耗計數器狀態失敗: %w", err)
+	}
+
+	t.mutex.Lock()
+	t.counters = counters
+	t.dirty = false
+	t.mutex.Unlock()
+	return nil
+}
+
+// SaveIfDue 距上次保存超過保存間隔且狀態有變更時保存
+func (t *EnergyCounterTracker) SaveIfDue() error {
+	t.mutex.Lock()
+	due := t.dirty && time.Since(t.lastSave) >= t.saveInterval
+	t.mutex.Unlock()
+
+	if !due {
+		return nil
+	}
+	return t.Save()
+}
+
+// Save 清除過期狀態後寫入狀態文件，先寫入臨時文件再更名以避免寫入中斷時損壞
+func (t *EnergyCounterTracker) Save() error {
+	if t.stateFile == "" {
+		return nil
+	}
+
+	t.mutex.Lock()
+	cutoff := time.Now().Add(-energyStateTTL)
+	for key, state := range t.counters {
+		if state.Timestamp.Before(cutoff) {
+			delete(t.counters, key)
+		}
+	}
+	data, err := json.Marshal(t.counters)
+	t.dirty = false
+	t.lastSave = time.Now()
+	t.mutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("序列化能耗計數器狀態失敗: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.stateFile), 0755); err != nil {
+		return fmt.Errorf("創建能耗計數器狀態目錄失敗: %w", err)
+	}
+
+	tmp := t.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("寫入能耗計數器狀態失敗: %w", err)
+	}
+	if err := os.Rename(tmp, t.stateFile); err != nil {
+		return fmt.Errorf("替換能耗計數器狀態文件失敗: %w", err)
+	}
+	return nil
+}
+
+// Stats 返回計數器統計
+func (t *EnergyCounterTracker) Stats() EnergyCounterStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return EnergyCounterStats{
+		Counters: len(t.counters),
+		Wrapped:  t.wrapped,
+		Resets:   t.resets,
+		Stale:    t.stale,
+		LastSave: t.lastSave,
+	}
+}
+
+// counterModulus 計算位寬為 bits 的計數器套用比例因子後的溢位上限，bits 不在 1-63 時視為不會溢位
+func counterModulus(bits int, scale float64) float64 {
+	if bits <= 0 || bits >= 64 {
+		return 0
+	}
+	return math.Ldexp(1, bits) * scale
+}
@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxUnmatchedFields 最多記錄的未匹配字段數，超過後新字段只計入 Overflow
+	maxUnmatchedFields = 1000
+
+	// ReasonUnmatched 沒有字段規則匹配
+	ReasonUnmatched = "unmatched"
+	// ReasonUnsupportedScope 字段已匹配，但該範圍不支援此物理量（如總體的 state）
+	ReasonUnsupportedScope = "unsupported_scope"
+)
+
+// UnmatchedField 未能解析的字段
+type UnmatchedField struct {
+	Field        string    `json:"field"`
+	Reason       string    `json:"reason"`
+	Manufacturer string    `json:"manufacturer"`
+	Model        string    `json:"model"`
+	Profile      string    `json:"profile,omitempty"`
+	Device       string    `json:"device"` // 最近一次出現的設備
+	Count        int64     `json:"count"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// FieldDiagnostics 記錄無法以字段語法解析的字段，供診斷端點查詢，避免字段被猜測歸類或靜默丟棄
+type FieldDiagnostics struct {
+	mutex    sync.Mutex
+	fields   map[string]*UnmatchedField
+	overflow int64
+}
+
+// NewFieldDiagnostics 創建字段診斷記錄
+func NewFieldDiagnostics() *FieldDiagnostics {
+	return &FieldDiagnostics{
+		fields: make(map[string]*UnmatchedField),
+	}
+}
+
+// Record 記錄一個未匹配字段，返回是否為首次出現
+func (d *FieldDiagnostics) Record(field, reason, manufacturer, model, profile, device string) bool {
+	key := profile + "|" + manufacturer + "|" + model + "|" + field
+	now := time.Now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if entry, ok := d.fields[key]; ok {
+		entry.Count++
+		entry.LastSeen = now
+		entry.Device = device
+		entry.Reason = reason
+		return false
+	}
+
+	if len(d.fields) >= maxUnmatchedFields {
+		d.overflow++
+		return false
+	}
+
+	d.fields[key] = &UnmatchedField{
+		Field:        field,
+		Reason:       reason,
+		Manufacturer: manufacturer,
+		Model:        model,
+		Profile:      profile,
+		Device:       device,
+		Count:        1,
+		FirstSeen:    now,
+		LastSeen:     now,
+	}
+	return true
+}
+
+// List 返回所有未匹配字段（出現次數多的在前）及因超過上限未記錄的次數
+func (d *FieldDiagnostics) List() ([]UnmatchedField, int64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	result := make([]UnmatchedField, 0, len(d.fields))
+	for _, entry := range d.fields {
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Field < result[j].Field
+	})
+	return result, d.overflow
+}
+
+// Reset 清除所有記錄，用於修正描述檔後重新觀察
+func (d *FieldDiagnostics) Reset() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.fields = make(map[string]*UnmatchedField)
+	d.overflow = 0
+}
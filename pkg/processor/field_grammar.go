@@ -0,0 +1,182 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"viot/models"
+)
+
+// FieldScope 字段所屬範圍
+type FieldScope string
+
+const (
+	ScopeTotal  FieldScope = "total"
+	ScopePhase  FieldScope = "phase"
+	ScopeBranch FieldScope = "branch"
+	ScopeOutlet FieldScope = "outlet"
+	ScopeEnv    FieldScope = "env"
+)
+
+// FieldName 解析後的字段名
+type FieldName struct {
+	Scope    FieldScope `json:"scope"`
+	ID       string     `json:"id,omitempty"`
+	Quantity string     `json:"quantity"`
+}
+
+// Canonical 返回標準字段名：總體為物理量名稱，其餘為 <scope>_<id>_<quantity>
+func (f FieldName) Canonical() string {
+	if f.Scope == ScopeTotal {
+		return f.Quantity
+	}
+	return fmt.Sprintf("%s_%s_%s", f.Scope, f.ID, f.Quantity)
+}
+
+// fieldRule 編譯後的字段規則
+type fieldRule struct {
+	scope    FieldScope
+	re       *regexp.Regexp
+	id       string
+	quantity string
+}
+
+// FieldGrammar 依序以規則解析字段名的範圍、ID 與物理量，第一個匹配的規則生效
+type FieldGrammar struct {
+	rules []fieldRule
+}
+
+// canonicalFieldRules 標準字段名規則，附加在所有語法之後
+var canonicalFieldRules = []models.PDUFieldRule{
+	{Scope: string(ScopeTotal), Pattern: "{quantity}"},
+	{Scope: string(ScopeBranch), Pattern: "branch_{id}_{quantity}"},
+	{Scope: string(ScopePhase), Pattern: "phase_{id}_{quantity}"},
+	{Scope: string(ScopeOutlet), Pattern: "outlet_{id}_{quantity}"},
+	{Scope: string(ScopeEnv), Pattern: "env_{id}_{quantity}"},
+}
+
+// defaultFieldGrammar 非描述檔處理程序使用的語法
+var defaultFieldGrammar = mustFieldGrammar([]models.PDUFieldRule{
+	{Scope: string(ScopeTotal), Pattern: "total_{quantity}"},
+	{Scope: string(ScopePhase), Regex: `^(?P<quantity>current|voltage|power|energy)_(?P<id>L[1-3])$`},
+	{Scope: string(ScopeEnv), Regex: `^(?P<quantity>temperature|humidity|door)_(?P<id>[A-Za-z0-9]+)$`},
+})
+
+// NewFieldGrammar 編譯字段規則，並附加標準字段名規則
+func NewFieldGrammar(rules []models.PDUFieldRule) (*FieldGrammar, error) {
+	g := &FieldGrammar{}
+	for i, rule := range append(append([]models.PDUFieldRule{}, rules...), canonicalFieldRules...) {
+		compiled, err := compileFieldRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 條字段規則: %w", i+1, err)
+		}
+		g.rules = append(g.rules, compiled)
+	}
+	return g, nil
+}
+
+// mustFieldGrammar 編譯內建語法，失敗時 panic
+func mustFieldGrammar(rules []models.PDUFieldRule) *FieldGrammar {
+	g, err := NewFieldGrammar(rules)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// Parse 解析字段名，沒有規則匹配時返回 false
+func (g *FieldGrammar) Parse(field string) (FieldName, bool) {
+	for _, rule := range g.rules {
+		match := rule.re.FindStringSubmatch(field)
+		if match == nil {
+			continue
+		}
+
+		name := FieldName{Scope: rule.scope, ID: rule.id, Quantity: rule.quantity}
+		if i := rule.re.SubexpIndex("id"); i > 0 && match[i] != "" {
+			name.ID = match[i]
+		}
+		if i := rule.re.SubexpIndex("quantity"); i > 0 {
+			quantity, ok := pduQuantities[strings.ToLower(match[i])]
+			if !ok {
+				continue
+			}
+			name.Quantity = quantity
+		}
+		if !scopeAllows(name.Scope, name.Quantity) {
+			continue
+		}
+		if name.Scope != ScopeTotal && name.ID == "" {
+			continue
+		}
+		return name, true
+	}
+	return FieldName{}, false
+}
+
+// compileFieldRule 編譯單條字段規則，pattern 為含 {id}、{quantity} 佔位符的模板，regex 為含同名分組的正則表達式
+func compileFieldRule(rule models.PDUFieldRule) (fieldRule, error) {
+	scope := FieldScope(strings.ToLower(rule.Scope))
+	switch scope {
+	case ScopeTotal, ScopePhase, ScopeBranch, ScopeOutlet, ScopeEnv:
+	default:
+		return fieldRule{}, fmt.Errorf("無效的範圍 %q", rule.Scope)
+	}
+
+	compiled := fieldRule{scope: scope, id: rule.ID}
+	if rule.Quantity != "" {
+		quantity, ok := pduQuantities[strings.ToLower(rule.Quantity)]
+		if !ok {
+			return fieldRule{}, fmt.Errorf("無效的物理量 %q", rule.Quantity)
+		}
+		if !scopeAllows(scope, quantity) {
+			return fieldRule{}, fmt.Errorf("範圍 %s 不支援物理量 %q", scope, rule.Quantity)
+		}
+		compiled.quantity = quantity
+	}
+
+	var err error
+	switch {
+	case rule.Regex != "" && rule.Pattern != "":
+		return fieldRule{}, fmt.Errorf("pattern 與 regex 只能設置其一")
+	case rule.Regex != "":
+		compiled.re, err = regexp.Compile(rule.Regex)
+	case rule.Pattern != "":
+		compiled.re, err = compileFieldTemplate(rule.Pattern)
+	default:
+		return fieldRule{}, fmt.Errorf("缺少 pattern 或 regex")
+	}
+	if err != nil {
+		return fieldRule{}, err
+	}
+
+	if compiled.quantity == "" && compiled.re.SubexpIndex("quantity") < 0 {
+		return fieldRule{}, fmt.Errorf("%s 缺少 {quantity}，且未設置 quantity", compiled.re)
+	}
+	if scope != ScopeTotal && compiled.id == "" && compiled.re.SubexpIndex("id") < 0 {
+		return fieldRule{}, fmt.Errorf("%s 缺少 {id}，且未設置 id", compiled.re)
+	}
+	return compiled, nil
+}
+
+// scopeAllows 環境探頭的物理量只屬於 env 範圍，電力物理量不屬於 env 範圍
+// 使 {quantity}_{id} 這類模式不會把 temperature_1 歸入相位
+func scopeAllows(scope FieldScope, quantity string) bool {
+	return envQuantities[quantity] == (scope == ScopeEnv)
+}
+
+// compileFieldTemplate 將含 {id} 與 {quantity} 佔位符的模板編譯為完整匹配的正則表達式
+func compileFieldTemplate(pattern string) (*regexp.Regexp, error) {
+	quantities := make([]string, 0, len(pduQuantities))
+	for q := range pduQuantities {
+		quantities = append(quantities, q)
+	}
+	sort.Strings(quantities)
+
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, regexp.QuoteMeta("{id}"), `(?P<id>[A-Za-z0-9]+)`, 1)
+	expr = strings.Replace(expr, regexp.QuoteMeta("{quantity}"), `(?P<quantity>`+strings.Join(quantities, "|")+`)`, 1)
+	return regexp.Compile("^" + expr + "$")
+}
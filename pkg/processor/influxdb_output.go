@@ -0,0 +1,322 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"viot/models"
+	"viot/storage/recovery"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultInfluxDBBatchSize 默認每批寫入的數據點數
+	defaultInfluxDBBatchSize = 500
+
+	// defaultInfluxDBFlushInterval 默認最長寫入間隔
+	defaultInfluxDBFlushInterval = time.Second
+
+	// defaultInfluxDBFallbackName 默認交給備份策略的文件名
+	defaultInfluxDBFallbackName = "influxdb_pdu"
+)
+
+// InfluxDBOutputConfig InfluxDB 輸出設置
+type InfluxDBOutputConfig struct {
+	URL           string        `json:"url" yaml:"url"`
+	Token         string        `json:"token" yaml:"token"`
+	Org           string        `json:"org" yaml:"org"`
+	Bucket        string        `json:"bucket" yaml:"bucket"`
+	Measurement   string        `json:"measurement" yaml:"measurement"`       // 總體序列名稱，默認 pdu，其餘序列加上 _phase、_branch 等後綴
+	BatchSize     int           `json:"batch_size" yaml:"batch_size"`         // 緩存的數據點達到此數量時立即寫入
+	FlushInterval time.Duration `json:"flush_interval" yaml:"flush_interval"` // 緩存的數據點最長等待時間
+	FallbackName  string        `json:"fallback_name" yaml:"fallback_name"`   // 寫入失敗時交給備份策略的文件名
+}
+
+// InfluxDBOutputStats InfluxDB 輸出統計
+type InfluxDBOutputStats struct {
+	Buffered  int       `json:"buffered"`  // 等待寫入的數據點數
+	Written   int64     `json:"written"`   // 已寫入的數據點數
+	Failed    int64     `json:"failed"`    // 寫入失敗的批次數
+	FellBack  int64     `json:"fell_back"` // 交給備份策略的 PDU 數據數
+	Replayed  int64     `json:"replayed"`  // 從備份策略重新寫入的 PDU 數據數
+	LastError string    `json:"last_error,omitempty"`
+	LastFlush time.Time `json:"last_flush"`
+}
+
+// InfluxDBOutputHandler InfluxDB輸出處理程序
+// PDU 數據以 SplitPDUData 拆分為總體、相位、分支、插座與環境探頭序列，緩存後分批以非同步寫入 API 寫入，
+// 寫入錯誤由 Errors() 通道取得；寫入失敗的整批 PDU 數據交給備份策略，下一次寫入成功後重新寫入
+type InfluxDBOutputHandler struct {
+	config   InfluxDBOutputConfig
+	client   influxdb2.Client
+	writeAPI api.WriteAPI
+	errors   <-chan error
+	fallback recovery.FallbackStrategy
+	logger   *zap.Logger
+
+	buffer      []models.PDUData
+	bufferSize  int // 緩存的數據點數
+	bufferMutex sync.Mutex
+	writeMutex  sync.Mutex // 同一時間只有一批數據寫入，寫入錯誤才能對應到該批數據
+
+	stats      InfluxDBOutputStats
+	needReplay bool // 備份策略中有待重新寫入的數據
+	statsMutex sync.Mutex
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewInfluxDBOutputHandler 創建InfluxDB輸出處理程序並開始定期寫入
+// 創建時不檢查連線，InfluxDB 無法連線時數據交給備份策略；fallback 為 nil 時寫入失敗的數據只記錄日誌
+func NewInfluxDBOutputHandler(config InfluxDBOutputConfig, fallback recovery.FallbackStrategy, logger *zap.Logger) (*InfluxDBOutputHandler, error) {
+	if config.URL == "" || config.Bucket == "" {
+		return nil, errors.New("InfluxDB 輸出缺少 url 或 bucket")
+	}
+	if config.Measurement == "" {
+		config.Measurement = "pdu"
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultInfluxDBBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultInfluxDBFlushInterval
+	}
+	if config.FallbackName == "" {
+		config.FallbackName = defaultInfluxDBFallbackName
+	}
+
+	// 由處理程序控制寫入時機並在 Flush 後檢查錯誤，客戶端不重試，失敗的批次直接交給備份策略
+	options := influxdb2.DefaultOptions().
+		SetBatchSize(uint(config.BatchSize)).
+		SetFlushInterval(uint(time.Hour / time.Millisecond)).
+		SetMaxRetries(0)
+	client := influxdb2.NewClientWithOptions(config.URL, config.Token, options)
+	writeAPI := client.WriteAPI(config.Org, config.Bucket)
+
+	h := &InfluxDBOutputHandler{
+		config:   config,
+		client:   client,
+		writeAPI: writeAPI,
+		// 需在寫入前取得錯誤通道，否則客戶端不會回報寫入錯誤
+		errors:   writeAPI.Errors(),
+		fallback: fallback,
+		logger:   logger.Named("influxdb-output"),
+		// 上次執行時未寫入的備份數據在第一次寫入成功後重新寫入
+		needReplay: fallback != nil,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go h.flushLoop()
+	return h, nil
+}
+
+// HandlePDUData 緩存PDU數據，緩存的數據點達到批次大小時立即寫入
+func (h *InfluxDBOutputHandler) HandlePDUData(ctx context.Context, data []models.PDUData) error {
+	h.bufferMutex.Lock()
+	for _, pdu := range data {
+		h.buffer = append(h.buffer, pdu)
+		h.bufferSize += pduSeriesCount(pdu)
+	}
+	full := h.bufferSize >= h.config.BatchSize
+	h.bufferMutex.Unlock()
+
+	if full {
+		return h.Flush()
+	}
+	return nil
+}
+
+// pduSeriesCount PDU 數據拆分後的數據點數
+func pduSeriesCount(pdu models.PDUData) int {
+	return 1 + len(pdu.Phases) + len(pdu.Branches) + len(pdu.Outlets) + len(pdu.Environment)
+}
+
+// flushLoop 定期寫入緩存的數據
+func (h *InfluxDBOutputHandler) flushLoop() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			if err := h.Flush(); err != nil {
+				h.logger.Error("定期寫入InfluxDB失敗", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Flush 寫入所有緩存的數據
+// 寫入失敗時整批交給備份策略，只有備份也失敗（數據遺失）時返回錯誤
+func (h *InfluxDBOutputHandler) Flush() error {
+	h.writeMutex.Lock()
+	defer h.writeMutex.Unlock()
+
+	h.bufferMutex.Lock()
+	batch := h.buffer
+	h.buffer = nil
+	h.bufferSize = 0
+	h.bufferMutex.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := h.write(batch); err != nil {
+		h.recordFailure(err)
+		h.logger.Error("寫入InfluxDB失敗，將數據交給備份策略",
+			zap.Int("count", len(batch)),
+			zap.Error(err))
+		return h.saveFallback(batch)
+	}
+
+	h.replay()
+	return nil
+}
+
+// write 寫入一批數據並等待寫入完成，返回該批數據的寫入錯誤
+// 非同步寫入 API 的 Flush 會等待所有批次送出，因此 Flush 返回後錯誤通道中的錯誤屬於這批數據
+func (h *InfluxDBOutputHandler) write(batch []models.PDUData) error {
+	h.drainErrors()
+
+	points := 0
+	for _, pdu := range batch {
+		for _, series := range SplitPDUData(pdu, h.config.Measurement) {
+			h.writeAPI.WritePoint(influxdb2.NewPoint(series.Measurement, series.Tags, series.Fields, series.Time))
+			points++
+		}
+	}
+	h.writeAPI.Flush()
+
+	if err := h.drainErrors(); err != nil {
+		return err
+	}
+
+	h.statsMutex.Lock()
+	h.stats.Written += int64(points)
+	h.stats.LastFlush = time.Now()
+	h.statsMutex.Unlock()
+	h.logger.Debug("已寫入InfluxDB",
+		zap.Int("count", len(batch)),
+		zap.Int("points", points))
+	return nil
+}
+
+// drainErrors 讀出錯誤通道中所有的錯誤，返回第一個錯誤
+func (h *InfluxDBOutputHandler) drainErrors() error {
+	var first error
+	for {
+		select {
+		case err, ok := <-h.errors:
+			if !ok {
+				return first
+			}
+			if first == nil {
+				first = err
+			}
+		default:
+			return first
+		}
+	}
+}
+
+// recordFailure 記錄寫入失敗
+func (h *InfluxDBOutputHandler) recordFailure(err error) {
+	h.statsMutex.Lock()
+	defer h.statsMutex.Unlock()
+	h.stats.Failed++
+	h.stats.LastError = err.Error()
+}
+
+// saveFallback 將寫入失敗的數據交給備份策略
+func (h *InfluxDBOutputHandler) saveFallback(batch []models.PDUData) error {
+	if h.fallback == nil {
+		return fmt.Errorf("未配置備份策略，%d 筆PDU數據未寫入InfluxDB", len(batch))
+	}
+	if err := h.fallback.SavePDUData(h.config.FallbackName, batch); err != nil {
+		return fmt.Errorf("備份PDU數據失敗: %w", err)
+	}
+
+	h.statsMutex.Lock()
+	h.stats.FellBack += int64(len(batch))
+	h.needReplay = true
+	h.statsMutex.Unlock()
+	return nil
+}
+
+// replay 寫入成功後重新寫入備份策略中的數據，成功後標記為已處理
+func (h *InfluxDBOutputHandler) replay() {
+	h.statsMutex.Lock()
+	needReplay := h.needReplay
+	h.needReplay = false
+	h.statsMutex.Unlock()
+
+	if !needReplay || h.fallback == nil {
+		return
+	}
+
+	pending, err := h.fallback.GetPendingPDUData()
+	if err != nil {
+		h.logger.Error("獲取待處理PDU數據失敗", zap.Error(err))
+		return
+	}
+	data := pending[h.config.FallbackName]
+	if len(data) == 0 {
+		return
+	}
+
+	if err := h.write(data); err != nil {
+		h.recordFailure(err)
+		h.statsMutex.Lock()
+		h.needReplay = true
+		h.statsMutex.Unlock()
+		h.logger.Error("重新寫入備份數據失敗", zap.Int("count", len(data)), zap.Error(err))
+		return
+	}
+	if err := h.fallback.MarkPDUDataProcessed(h.config.FallbackName); err != nil {
+		h.logger.Error("標記PDU數據已處理失敗", zap.Error(err))
+	}
+
+	h.statsMutex.Lock()
+	h.stats.Replayed += int64(len(data))
+	h.statsMutex.Unlock()
+	h.logger.Info("已重新寫入備份的PDU數據", zap.Int("count", len(data)))
+}
+
+// Stats 返回InfluxDB輸出統計
+func (h *InfluxDBOutputHandler) Stats() InfluxDBOutputStats {
+	h.bufferMutex.Lock()
+	buffered := h.bufferSize
+	h.bufferMutex.Unlock()
+
+	h.statsMutex.Lock()
+	defer h.statsMutex.Unlock()
+	stats := h.stats
+	stats.Buffered = buffered
+	return stats
+}
+
+// Close 停止定期寫入，寫入剩餘的數據並關閉客戶端；重複呼叫時返回第一次關閉的結果
+func (h *InfluxDBOutputHandler) Close() error {
+	h.closeOnce.Do(func() {
+		close(h.stop)
+		<-h.done
+
+		h.closeErr = h.Flush()
+		h.client.Close()
+	})
+	return h.closeErr
+}
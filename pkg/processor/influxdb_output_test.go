@@ -0,0 +1,186 @@
+package processor
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"viot/logger"
+	"viot/models"
+	"viot/storage/recovery"
+
+	"go.uber.org/zap"
+)
+
+// influxTestServer 模擬 InfluxDB v2 寫入端點，可切換為返回 503
+type influxTestServer struct {
+	*httptest.Server
+	mutex       sync.Mutex
+	unavailable bool
+	lines       []string
+}
+
+func newInfluxTestServer(t *testing.T) *influxTestServer {
+	s := &influxTestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.unavailable {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+			if line != "" {
+				s.lines = append(s.lines, line)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *influxTestServer) setUnavailable(unavailable bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.unavailable = unavailable
+}
+
+// totalLines 返回總體序列（measurement 為 pdu）的行
+func (s *influxTestServer) totalLines() []string {
+	return s.measurementLines("pdu")
+}
+
+// measurementLines 返回指定 measurement 的行
+func (s *influxTestServer) measurementLines(measurement string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var result []string
+	for _, line := range s.lines {
+		if strings.HasPrefix(line, measurement+",") {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+func testInfluxPDU(seconds int64) models.PDUData {
+	return models.PDUData{
+		Name:      "pdu",
+		Timestamp: time.Unix(seconds, 0),
+		Tags:      map[string]string{"ip": "10.0.0.1", "phase": "P3", "room": "R3"},
+		Current:   1,
+		Phases:    []models.Phase{{ID: "L1", Current: 1}},
+	}
+}
+
+func TestInfluxDBOutputFallbackAndReplay(t *testing.T) {
+	server := newInfluxTestServer(t)
+	fallback := recovery.NewJSONFallbackStrategy(t.TempDir(), logger.DefaultLogger)
+
+	h, err := NewInfluxDBOutputHandler(InfluxDBOutputConfig{
+		URL:           server.URL,
+		Org:           "viot",
+		Bucket:        "raw",
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+	}, fallback, zap.NewNop())
+	if err != nil {
+		t.Fatalf("創建InfluxDB輸出處理程序失敗: %v", err)
+	}
+
+	// InfluxDB 無法寫入時，同一秒內的兩批數據都應交給備份策略，不能互相覆蓋
+	server.setUnavailable(true)
+	for _, seconds := range []int64{100, 200} {
+		if err := h.HandlePDUData(context.Background(), []models.PDUData{testInfluxPDU(seconds)}); err != nil {
+			t.Fatalf("備份成功時不應返回錯誤: %v", err)
+		}
+	}
+	if stats := h.Stats(); stats.Failed != 2 || stats.FellBack != 2 {
+		t.Fatalf("應有 2 批寫入失敗並備份，實際為 %+v", stats)
+	}
+	pending, err := fallback.GetPendingPDUData()
+	if err != nil {
+		t.Fatalf("讀取備份數據失敗: %v", err)
+	}
+	if got := len(pending[defaultInfluxDBFallbackName]); got != 2 {
+		t.Fatalf("備份中應有 2 筆PDU數據，實際為 %d", got)
+	}
+
+	// 恢復後第一次寫入成功時重新寫入備份的數據
+	server.setUnavailable(false)
+	if err := h.HandlePDUData(context.Background(), []models.PDUData{testInfluxPDU(300)}); err != nil {
+		t.Fatalf("寫入失敗: %v", err)
+	}
+	if stats := h.Stats(); stats.Replayed != 2 {
+		t.Fatalf("應重新寫入 2 筆備份數據，實際為 %+v", stats)
+	}
+
+	lines := server.totalLines()
+	if len(lines) != 3 {
+		t.Fatalf("InfluxDB 應收到 3 筆總體數據，實際為 %d: %v", len(lines), lines)
+	}
+	for _, ts := range []string{" 100000000000", " 200000000000", " 300000000000"} {
+		found := false
+		for _, line := range lines {
+			if strings.HasSuffix(line, ts) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("缺少時間戳為%s 的數據: %v", ts, lines)
+		}
+	}
+
+	pending, err = fallback.GetPendingPDUData()
+	if err != nil {
+		t.Fatalf("讀取備份數據失敗: %v", err)
+	}
+	if got := len(pending[defaultInfluxDBFallbackName]); got != 0 {
+		t.Fatalf("重新寫入後備份應為空，實際有 %d 筆", got)
+	}
+
+	if err := h.Close(); err != nil {
+		t.Fatalf("關閉失敗: %v", err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("重複關閉不應返回錯誤: %v", err)
+	}
+}
+
+func TestInfluxDBOutputPhaseSeriesTags(t *testing.T) {
+	server := newInfluxTestServer(t)
+	h, err := NewInfluxDBOutputHandler(InfluxDBOutputConfig{
+		URL:           server.URL,
+		Org:           "viot",
+		Bucket:        "raw",
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+	}, nil, zap.NewNop())
+	if err != nil {
+		t.Fatalf("創建InfluxDB輸出處理程序失敗: %v", err)
+	}
+	defer h.Close()
+
+	if err := h.HandlePDUData(context.Background(), []models.PDUData{testInfluxPDU(100)}); err != nil {
+		t.Fatalf("寫入失敗: %v", err)
+	}
+
+	// 相位以 phase_id 區分，不能覆蓋設備的位置標籤 phase
+	lines := server.measurementLines("pdu_phase")
+	if len(lines) != 1 {
+		t.Fatalf("InfluxDB 應收到 1 筆相位數據，實際為 %d: %v", len(lines), lines)
+	}
+	if !strings.Contains(lines[0], ",phase=P3") || !strings.Contains(lines[0], ",phase_id=L1") {
+		t.Errorf("相位數據應保留位置標籤 phase=P3 並以 phase_id=L1 區分相位: %s", lines[0])
+	}
+}
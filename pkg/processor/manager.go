@@ -1,7 +1,9 @@
 package processor
 
 import (
+	"context"
 	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
@@ -17,14 +19,40 @@ type ProcessorManager struct {
 	processors     map[string]*ProcessorInstance
 	processorMutex sync.RWMutex
 	logger         logger.Logger
+	ctx            context.Context
+	router         models.OutputRouter
+
+	// 處理管線
+	pipeline           *Pipeline
+	pipelineFile       string
+	pipelineConfig     PipelineConfig
+	pipelineProcessors map[string]bool // 由 ingest 階段創建的處理器
+	pipelineLoadedAt   time.Time
+	pipelineError      string
+	pipelineMutex      sync.Mutex
+}
+
+// PipelineStatus 處理管線狀態
+type PipelineStatus struct {
+	File      string         `json:"file"`
+	LoadedAt  time.Time      `json:"loaded_at"`
+	LastError string         `json:"last_error,omitempty"`
+	Stages    []StageMetrics `json:"stages"`
 }
 
-// NewProcessorManager 創建處理器管理器
-func NewProcessorManager(logger logger.Logger) *ProcessorManager {
-	return &ProcessorManager{
-		processors: make(map[string]*models.ProcessorInstance),
-		logger:     logger,
+// NewProcessorManager 創建處理器管理器，pipelineFile 不為空時載入處理管線配置
+// 載入失敗時記錄錯誤，之後可修正配置並以 ReloadPipeline 重新載入
+func NewProcessorManager(pipelineFile string, logger logger.Logger) *ProcessorManager {
+	m := &ProcessorManager{
+		processors:         make(map[string]*models.ProcessorInstance),
+		logger:             logger,
+		pipelineProcessors: make(map[string]bool),
 	}
+	if pipelineFile != "" {
+		// 錯誤已由 ReloadPipeline 記錄並保存在 PipelineStatus 中
+		_ = m.LoadPipeline(pipelineFile)
+	}
+	return m
 }
 
 // RegisterProcessor 註冊處理器
@@ -145,11 +173,112 @@ func (m *ProcessorManager) CreateDefaultProcessors() error {
 	return nil
 }
 
+// ReloadProfiles 重新載入所有PDU處理器的型號描述檔
+func (m *ProcessorManager) ReloadProfiles() error {
+	m.processorMutex.RLock()
+	defer m.processorMutex.RUnlock()
+
+	for name, instance := range m.processors {
+		pduProc, ok := instance.Processor.(*PDUProcessor)
+		if !ok {
+			continue
+		}
+		if err := pduProc.ReloadProfiles(); err != nil {
+			m.logger.Error("重新載入PDU型號描述檔失敗",
+				zap.String("processor", name),
+				zap.Error(err))
+			return fmt.Errorf("處理器 %s 重新載入型號描述檔失敗: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// LatestPDUData 返回所有PDU處理器中各設備最近一次處理的數據
+func (m *ProcessorManager) LatestPDUData() []models.PDUData {
+	m.processorMutex.RLock()
+	defer m.processorMutex.RUnlock()
+
+	var result []models.PDUData
+	for _, instance := range m.processors {
+		if pduProc, ok := instance.Processor.(*PDUProcessor); ok {
+			result = append(result, pduProc.Latest()...)
+		}
+	}
+	return result
+}
+
+// FindPDUData 返回指定設備最近一次處理的數據，設備以 device 標籤、ip 標籤或名稱識別
+func (m *ProcessorManager) FindPDUData(device string) (models.PDUData, bool) {
+	m.processorMutex.RLock()
+	defer m.processorMutex.RUnlock()
+
+	for _, instance := range m.processors {
+		if pduProc, ok := instance.Processor.(*PDUProcessor); ok {
+			if pdu, ok := pduProc.LatestFor(device); ok {
+				return pdu, true
+			}
+		}
+	}
+	return models.PDUData{}, false
+}
+
+// FieldDiagnosticsReport 單個PDU處理器的字段診斷
+type FieldDiagnosticsReport struct {
+	Fields   []UnmatchedField `json:"fields"`
+	Overflow int64            `json:"overflow"`
+}
+
+// UnmatchedFields 返回各PDU處理器無法解析的字段
+func (m *ProcessorManager) UnmatchedFields() map[string]FieldDiagnosticsReport {
+	m.processorMutex.RLock()
+	defer m.processorMutex.RUnlock()
+
+	reports := make(map[string]FieldDiagnosticsReport)
+	for name, instance := range m.processors {
+		pduProc, ok := instance.Processor.(*PDUProcessor)
+		if !ok {
+			continue
+		}
+		fields, overflow := pduProc.UnmatchedFields()
+		reports[name] = FieldDiagnosticsReport{Fields: fields, Overflow: overflow}
+	}
+	return reports
+}
+
+// ResetFieldDiagnostics 清除所有PDU處理器的字段診斷記錄
+func (m *ProcessorManager) ResetFieldDiagnostics() {
+	m.processorMutex.RLock()
+	defer m.processorMutex.RUnlock()
+
+	for _, instance := range m.processors {
+		if pduProc, ok := instance.Processor.(*PDUProcessor); ok {
+			pduProc.ResetFieldDiagnostics()
+		}
+	}
+}
+
 // SetupOutputRouter 設置所有處理器的輸出路由器
+// 已載入處理管線時，所有處理器（包括非 ingest 階段創建的處理器）都輸出到管線，由管線的 output 階段交給輸出路由器
 func (m *ProcessorManager) SetupOutputRouter(router models.OutputRouter) error {
+	m.pipelineMutex.Lock()
+	m.router = router
+	pipeline := m.pipeline
+	if pipeline != nil {
+		pipeline.SetRouter(router)
+	}
+	m.pipelineMutex.Unlock()
+
+	m.processorMutex.RLock()
+	defer m.processorMutex.RUnlock()
+
 	for name, instance := range m.processors {
-		if pduProc, ok := interfaces.Processor.(*PDUProcessor); ok {
-			pduProc.SetOutputRouter(router)
+		if pduProc, ok := instance.Processor.(*PDUProcessor); ok {
+			if pipeline != nil {
+				pduProc.SetOutputRouter(pipeline)
+			} else {
+				pduProc.SetOutputRouter(router)
+			}
 			m.logger.Info("設置PDU處理器輸出路由器成功", zap.String("processor", name))
 		} else {
 			m.logger.Warn("處理器不支持設置輸出路由器", zap.String("processor", name))
@@ -158,3 +287,213 @@ func (m *ProcessorManager) SetupOutputRouter(router models.OutputRouter) error {
 
 	return nil
 }
+
+// Start 啟動所有處理器，之後由處理管線創建的處理器也會以此 context 啟動
+func (m *ProcessorManager) Start(ctx context.Context) error {
+	m.processorMutex.Lock()
+	defer m.processorMutex.Unlock()
+
+	m.ctx = ctx
+	for name, instance := range m.processors {
+		if err := instance.Processor.Start(ctx); err != nil {
+			return fmt.Errorf("啟動處理器 %s 失敗: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Stop 停止所有處理器
+func (m *ProcessorManager) Stop() error {
+	m.processorMutex.Lock()
+	defer m.processorMutex.Unlock()
+
+	m.ctx = nil
+	for name, instance := range m.processors {
+		if err := instance.Processor.Stop(); err != nil {
+			m.logger.Error("停止處理器失敗", zap.String("processor", name), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// LoadPipeline 載入處理管線配置文件，之後可呼叫 ReloadPipeline 重新載入
+func (m *ProcessorManager) LoadPipeline(path string) error {
+	m.pipelineMutex.Lock()
+	m.pipelineFile = path
+	m.pipelineMutex.Unlock()
+
+	return m.ReloadPipeline()
+}
+
+// ReloadPipeline 重新載入處理管線配置，新增、調整順序或停用階段不需重新啟動
+// 配置無效或任一階段創建失敗時保留原有管線
+func (m *ProcessorManager) ReloadPipeline() error {
+	m.pipelineMutex.Lock()
+	defer m.pipelineMutex.Unlock()
+
+	if m.pipelineFile == "" {
+		return fmt.Errorf("未設置處理管線配置文件")
+	}
+
+	config, err := LoadPipelineConfig(m.pipelineFile)
+	if err == nil {
+		if m.pipeline == nil {
+			m.pipeline = NewPipeline(m.logger)
+			m.pipeline.SetRouter(m.router)
+		}
+		err = m.pipeline.Apply(config)
+	}
+	if err != nil {
+		m.pipelineError = err.Error()
+		m.logger.Error("載入處理管線失敗，保留原有管線",
+			zap.String("file", m.pipelineFile),
+			zap.Error(err))
+		return err
+	}
+
+	m.applyIngestStages(config)
+	m.pipelineConfig = config
+	m.pipelineLoadedAt = time.Now()
+	m.pipelineError = ""
+	m.logger.Info("處理管線載入成功",
+		zap.String("file", m.pipelineFile),
+		zap.Int("stages", len(config.Stages)))
+	return nil
+}
+
+// applyIngestStages 依 ingest 階段創建、替換或移除 PDU 處理器，選項未變更的處理器保持運行
+// 其他已註冊的 PDU 處理器同樣改為輸出到管線
+func (m *ProcessorManager) applyIngestStages(config PipelineConfig) {
+	m.processorMutex.Lock()
+	defer m.processorMutex.Unlock()
+
+	for name, instance := range m.processors {
+		if m.pipelineProcessors[name] {
+			continue
+		}
+		if pduProc, ok := instance.Processor.(*PDUProcessor); ok {
+			pduProc.SetOutputRouter(m.pipeline)
+		}
+	}
+
+	wanted := make(map[string]StageConfig)
+	for _, stage := range config.Stages {
+		if stage.Type == StageIngest && stage.IsEnabled() {
+			wanted[stage.Name] = stage
+		}
+	}
+
+	for name := range m.pipelineProcessors {
+		if _, ok := wanted[name]; ok {
+			continue
+		}
+		m.stopProcessor(name)
+		delete(m.processors, name)
+		delete(m.pipelineProcessors, name)
+		m.logger.Info("已移除管線處理器", zap.String("name", name))
+	}
+
+	for name, stage := range wanted {
+		if instance, ok := m.processors[name]; ok {
+			if reflect.DeepEqual(instance.Config.Options, stage.Options) {
+				if pduProc, ok := instance.Processor.(*PDUProcessor); ok {
+					pduProc.SetOutputRouter(m.pipeline)
+				}
+				m.pipelineProcessors[name] = true
+				continue
+			}
+			m.stopProcessor(name)
+		}
+
+		processorConfig := models.ProcessorConfig{
+			Enabled:   true,
+			Type:      "pdu",
+			Interval:  5,
+			BatchSize: 100,
+			Options:   stage.Options,
+		}
+		pduProcessor := NewPDUProcessor(name, processorConfig, m.logger)
+		pduProcessor.SetOutputRouter(m.pipeline)
+		if m.ctx != nil {
+			if err := pduProcessor.Start(m.ctx); err != nil {
+				m.logger.Error("啟動管線處理器失敗", zap.String("name", name), zap.Error(err))
+			}
+		}
+
+		m.processors[name] = &ProcessorInstance{
+			Processor:   pduProcessor,
+			Config:      processorConfig,
+			Status:      models.ProcessorStatus{},
+			StartTime:   time.Now(),
+			LastUpdated: time.Now(),
+		}
+		m.pipelineProcessors[name] = true
+		m.logger.Info("已創建管線處理器", zap.String("name", name))
+	}
+}
+
+// stopProcessor 停止處理器，調用方須持有寫鎖
+func (m *ProcessorManager) stopProcessor(name string) {
+	instance, ok := m.processors[name]
+	if !ok || m.ctx == nil {
+		return
+	}
+	if err := instance.Processor.Stop(); err != nil {
+		m.logger.Error("停止處理器失敗", zap.String("processor", name), zap.Error(err))
+	}
+}
+
+// PipelineStatus 返回處理管線狀態，各階段依配置順序排列
+// ingest 階段的統計取自對應的處理器：Out 為處理數，Dropped 為隔離數
+func (m *ProcessorManager) PipelineStatus() PipelineStatus {
+	m.pipelineMutex.Lock()
+	status := PipelineStatus{
+		File:      m.pipelineFile,
+		LoadedAt:  m.pipelineLoadedAt,
+		LastError: m.pipelineError,
+	}
+	config := m.pipelineConfig
+	stats := make(map[string]StageMetrics)
+	if m.pipeline != nil {
+		for _, s := range m.pipeline.Stats() {
+			stats[s.Name] = s
+		}
+	}
+	m.pipelineMutex.Unlock()
+
+	m.processorMutex.RLock()
+	defer m.processorMutex.RUnlock()
+
+	for _, stage := range config.Stages {
+		if stage.Type != StageIngest {
+			status.Stages = append(status.Stages, stats[stage.Name])
+			continue
+		}
+
+		metrics := StageMetrics{Name: stage.Name, Type: stage.Type, Enabled: stage.IsEnabled()}
+		if instance, ok := m.processors[stage.Name]; ok {
+			if pduProc, ok := instance.Processor.(*PDUProcessor); ok {
+				procStatus := pduProc.GetStatus()
+				metrics.Out = procStatus.ProcessedCount
+				metrics.Dropped = procStatus.QuarantinedCount
+				metrics.Errors = procStatus.ErrorCount
+				metrics.LastError = procStatus.LastError
+				metrics.LastRun = pduProc.GetLastProcessTime()
+			}
+		}
+		status.Stages = append(status.Stages, metrics)
+	}
+	return status
+}
+
+// OutputStatus 返回輸出路由器各處理程序的交付統計，未設置輸出路由器或不是 OutputRouterImpl 時返回 false
+func (m *ProcessorManager) OutputStatus() (OutputRouterStatus, bool) {
+	m.pipelineMutex.Lock()
+	router, ok := m.router.(*OutputRouterImpl)
+	m.pipelineMutex.Unlock()
+
+	if !ok {
+		return OutputRouterStatus{}, false
+	}
+	return router.Status(), true
+}
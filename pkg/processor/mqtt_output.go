@@ -0,0 +1,434 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"viot/models"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+)
+
+const (
+	// MQTTPayloadJSON 訊息內容為 PDUData 的 JSON
+	MQTTPayloadJSON = "json"
+	// MQTTPayloadMetrics 訊息內容為類似 Sparkplug 的扁平指標列表
+	MQTTPayloadMetrics = "metrics"
+
+	// defaultMQTTTopic 默認主題模板
+	defaultMQTTTopic = "viot/{factory}/{room}/{name}"
+
+	// defaultMQTTBufferSize 默認斷線時緩存的訊息數
+	defaultMQTTBufferSize = 10000
+
+	// defaultMQTTTimeout 默認連線與發布逾時
+	defaultMQTTTimeout = 10 * time.Second
+)
+
+// MQTTOutputConfig MQTT 輸出設置
+type MQTTOutputConfig struct {
+	Broker     string        `json:"broker" yaml:"broker"` // 如 tcp://127.0.0.1:1883
+	ClientID   string        `json:"client_id" yaml:"client_id"`
+	Username   string        `json:"username" yaml:"username"`
+	Password   string        `json:"password" yaml:"password"`
+	Topic      string        `json:"topic" yaml:"topic"`             // 主題模板，默認 viot/{factory}/{room}/{name}
+	Payload    string        `json:"payload" yaml:"payload"`         // json（默認）或 metrics
+	QoS        byte          `json:"qos" yaml:"qos"`                 // 0、1 或 2
+	Retain     bool          `json:"retain" yaml:"retain"`           // 以保留訊息發布，新訂閱者立即收到最後的值
+	BufferSize int           `json:"buffer_size" yaml:"buffer_size"` // 斷線時緩存的訊息數，超過時丟棄最舊的訊息
+	Timeout    time.Duration `json:"timeout" yaml:"timeout"`         // 連線與發布逾時
+}
+
+// MQTTOutputStats MQTT 輸出統計
+type MQTTOutputStats struct {
+	Connected bool   `json:"connected"`
+	Published int64  `json:"published"` // 已發布的訊息數
+	Buffered  int    `json:"buffered"`  // 等待發布的緩存訊息數
+	Dropped   int64  `json:"dropped"`   // 緩存已滿而丟棄的訊息數
+	Skipped   int64  `json:"skipped"`   // 主題模板缺少標籤而略過的數據數
+	Errors    int64  `json:"errors"`    // 發布失敗的次數
+	LastError string `json:"last_error,omitempty"`
+}
+
+// mqttMessage 待發布的訊息
+type mqttMessage struct {
+	topic   string
+	payload []byte
+}
+
+// MQTTOutputHandler MQTT 輸出處理程序，每筆 PDU 數據發布為一則訊息
+// 未連線或發布失敗的訊息緩存在記憶體中，連線（含自動重連）成功後或下一次 HandlePDUData 時依序發布
+type MQTTOutputHandler struct {
+	config MQTTOutputConfig
+	topic  *topicTemplate
+	client paho.Client
+	logger *zap.Logger
+
+	buffer       []mqttMessage
+	warned       map[string]bool
+	stats        MQTTOutputStats
+	mutex        sync.Mutex
+	publishMutex sync.Mutex // 保持發布順序，重連後的緩存訊息先於新訊息發布
+}
+
+// NewMQTTOutputHandler 創建 MQTT 輸出處理程序並在背景連線
+// 代理伺服器無法連線時不返回錯誤，訊息緩存到連線成功後發布
+func NewMQTTOutputHandler(config MQTTOutputConfig, logger *zap.Logger) (*MQTTOutputHandler, error) {
+	if config.Broker == "" {
+		return nil, errors.New("未設置 MQTT 代理伺服器地址")
+	}
+	if config.QoS > 2 {
+		return nil, fmt.Errorf("無效的 QoS %d，可用值為 0、1 或 2", config.QoS)
+	}
+	switch config.Payload {
+	case "":
+		config.Payload = MQTTPayloadJSON
+	case MQTTPayloadJSON, MQTTPayloadMetrics:
+	default:
+		return nil, fmt.Errorf("無效的 payload %q，可用值為 json 或 metrics", config.Payload)
+	}
+	if config.Topic == "" {
+		config.Topic = defaultMQTTTopic
+	}
+	if config.ClientID == "" {
+		config.ClientID = fmt.Sprintf("viot-output-%d", time.Now().UnixNano())
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultMQTTBufferSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultMQTTTimeout
+	}
+
+	topic, err := parseTopicTemplate(config.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &MQTTOutputHandler{
+		config: config,
+		topic:  topic,
+		logger: logger.Named("mqtt-output"),
+		warned: make(map[string]bool),
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetConnectTimeout(config.Timeout).
+		SetWriteTimeout(config.Timeout).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(h.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			h.logger.Warn("MQTT 連線中斷，等待自動重連", zap.Error(err))
+		})
+	h.client = paho.NewClient(opts)
+	// 啟用 ConnectRetry 時 Connect 在背景重試，不需等待
+	h.client.Connect()
+	return h, nil
+}
+
+// HandlePDUData 發布 PDU 數據，連線時先發布之前緩存的訊息；未連線或發布失敗時緩存，
+// 緩存成功即返回 nil，由之後的呼叫或重連後發布
+func (h *MQTTOutputHandler) HandlePDUData(ctx context.Context, data []models.PDUData) error {
+	messages := make([]mqttMessage, 0, len(data))
+	for _, pdu := range data {
+		topic, ok := h.topic.render(pdu)
+		if !ok {
+			h.skip(pdu)
+			continue
+		}
+		payload, err := h.payload(pdu)
+		if err != nil {
+			return fmt.Errorf("編碼 MQTT 訊息失敗: %w", err)
+		}
+		messages = append(messages, mqttMessage{topic: topic, payload: payload})
+	}
+
+	h.publishMutex.Lock()
+	defer h.publishMutex.Unlock()
+
+	if !h.client.IsConnectionOpen() {
+		h.enqueue(messages...)
+		return nil
+	}
+	// 先發布之前未發布的緩存訊息以保持順序，仍未成功時新訊息排在其後
+	if err := h.drain(); err != nil {
+		h.enqueue(messages...)
+		return nil
+	}
+	for i, msg := range messages {
+		if err := h.publish(msg); err != nil {
+			h.recordError(err)
+			h.enqueue(messages[i:]...)
+			h.logger.Warn("發布 MQTT 訊息失敗，已緩存", zap.Int("count", len(messages)-i), zap.Error(err))
+			return nil
+		}
+	}
+	return nil
+}
+
+// publish 發布一則訊息並等待完成
+func (h *MQTTOutputHandler) publish(msg mqttMessage) error {
+	token := h.client.Publish(msg.topic, h.config.QoS, h.config.Retain, msg.payload)
+	if !token.WaitTimeout(h.config.Timeout) {
+		return fmt.Errorf("發布到 %s 超時", msg.topic)
+	}
+	if err := token.Error(); err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	h.stats.Published++
+	h.mutex.Unlock()
+	return nil
+}
+
+// enqueue 緩存訊息，超過緩存大小時丟棄最舊的訊息
+func (h *MQTTOutputHandler) enqueue(messages ...mqttMessage) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.buffer = append(h.buffer, messages...)
+	if overflow := len(h.buffer) - h.config.BufferSize; overflow > 0 {
+		h.buffer = append([]mqttMessage(nil), h.buffer[overflow:]...)
+		h.stats.Dropped += int64(overflow)
+	}
+}
+
+// onConnect 連線（含重連）成功後依序發布緩存的訊息
+func (h *MQTTOutputHandler) onConnect(_ paho.Client) {
+	h.logger.Info("已連接 MQTT 代理伺服器", zap.String("broker", h.config.Broker))
+
+	h.publishMutex.Lock()
+	defer h.publishMutex.Unlock()
+	h.drain()
+}
+
+// drain 依序發布緩存的訊息，失敗時放回未發布的訊息並返回錯誤，呼叫者須持有 publishMutex
+func (h *MQTTOutputHandler) drain() error {
+	h.mutex.Lock()
+	buffered := h.buffer
+	h.buffer = nil
+	h.mutex.Unlock()
+
+	for i, msg := range buffered {
+		if err := h.publish(msg); err != nil {
+			h.recordError(err)
+			// 放回未發布的訊息，之後收到的新訊息排在其後
+			h.mutex.Lock()
+			h.buffer = append(append([]mqttMessage(nil), buffered[i:]...), h.buffer...)
+			h.mutex.Unlock()
+			h.logger.Error("發布緩存的 MQTT 訊息失敗", zap.Int("remaining", len(buffered)-i), zap.Error(err))
+			return err
+		}
+	}
+	if len(buffered) > 0 {
+		h.logger.Info("已發布緩存的 MQTT 訊息", zap.Int("count", len(buffered)))
+	}
+	return nil
+}
+
+// recordError 記錄發布錯誤
+func (h *MQTTOutputHandler) recordError(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.stats.Errors++
+	h.stats.LastError = err.Error()
+}
+
+// skip 記錄主題模板缺少標籤而略過的數據，每個設備只警告一次
+func (h *MQTTOutputHandler) skip(pdu models.PDUData) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.stats.Skipped++
+	if device := energyDeviceKey(&pdu); !h.warned[device] {
+		h.warned[device] = true
+		h.logger.Warn("PDU缺少主題模板需要的標籤，不發布到 MQTT",
+			zap.String("device", device),
+			zap.String("topic", h.config.Topic))
+	}
+}
+
+// Stats 返回 MQTT 輸出統計
+func (h *MQTTOutputHandler) Stats() MQTTOutputStats {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	stats := h.stats
+	stats.Buffered = len(h.buffer)
+	stats.Connected = h.client.IsConnectionOpen()
+	return stats
+}
+
+// Close 斷開連線，未發布的緩存訊息會遺失
+func (h *MQTTOutputHandler) Close() error {
+	h.client.Disconnect(uint(h.config.Timeout / time.Millisecond))
+	if buffered := h.Stats().Buffered; buffered > 0 {
+		h.logger.Warn("MQTT 輸出關閉時仍有未發布的訊息", zap.Int("count", buffered))
+	}
+	return nil
+}
+
+// payload 依設置編碼訊息內容
+func (h *MQTTOutputHandler) payload(pdu models.PDUData) ([]byte, error) {
+	if h.config.Payload == MQTTPayloadMetrics {
+		return json.Marshal(pduMetrics(pdu))
+	}
+	return json.Marshal(pdu)
+}
+
+// mqttMetric 類似 Sparkplug 的單個指標
+type mqttMetric struct {
+	Name     string      `json:"name"`
+	DataType string      `json:"dataType"` // Double 或 String
+	Value    interface{} `json:"value"`
+}
+
+// mqttMetricsPayload 類似 Sparkplug 的訊息內容，時間戳為 Unix 毫秒
+type mqttMetricsPayload struct {
+	Timestamp int64             `json:"timestamp"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Metrics   []mqttMetric      `json:"metrics"`
+}
+
+// pduMetrics 將 PDU 數據展開為扁平指標，名稱以 / 分層：
+// 總體為物理量名稱，其餘為 phase/<id>/<quantity>、branch/<id>/<quantity>、outlet/<id>/<quantity>、env/<id>/<type>，
+// 插座與門磁狀態為 outlet/<id>/state、env/<id>/<type>/state，計算字段為 fields/<name>
+func pduMetrics(pdu models.PDUData) mqttMetricsPayload {
+	var metrics []mqttMetric
+	add := func(name string, value float64) {
+		metrics = append(metrics, mqttMetric{Name: name, DataType: "Double", Value: value})
+	}
+	addState := func(name, state string) {
+		if state != "" {
+			metrics = append(metrics, mqttMetric{Name: name, DataType: "String", Value: state})
+		}
+	}
+
+	add("current", pdu.Current)
+	add("voltage", pdu.Voltage)
+	add("power", pdu.Power)
+	add("energy", pdu.Energy)
+	add("energy_delta", pdu.EnergyDelta)
+	add("apparent_power", pdu.ApparentPower)
+	add("power_factor", pdu.PowerFactor)
+	add("current_imbalance", pdu.CurrentImbalance)
+	add("neutral_current", pdu.NeutralCurrent)
+
+	for _, p := range pdu.Phases {
+		prefix := "phase/" + p.ID + "/"
+		add(prefix+"current", p.Current)
+		add(prefix+"voltage", p.Voltage)
+		add(prefix+"power", p.Power)
+		add(prefix+"energy", p.Energy)
+		add(prefix+"energy_delta", p.EnergyDelta)
+		add(prefix+"apparent_power", p.ApparentPower)
+		add(prefix+"power_factor", p.PowerFactor)
+		add(prefix+"line_voltage", p.LineVoltage)
+	}
+	for _, b := range pdu.Branches {
+		prefix := "branch/" + b.ID + "/"
+		add(prefix+"current", b.Current)
+		add(prefix+"voltage", b.Voltage)
+		add(prefix+"power", b.Power)
+		add(prefix+"energy", b.Energy)
+		add(prefix+"energy_delta", b.EnergyDelta)
+	}
+	for _, o := range pdu.Outlets {
+		prefix := "outlet/" + o.ID + "/"
+		add(prefix+"current", o.Current)
+		add(prefix+"voltage", o.Voltage)
+		add(prefix+"power", o.Power)
+		add(prefix+"energy", o.Energy)
+		add(prefix+"energy_delta", o.EnergyDelta)
+		addState(prefix+"state", o.State)
+	}
+	for _, probe := range pdu.Environment {
+		name := "env/" + probe.ID + "/" + probe.Type
+		add(name, probe.Value)
+		addState(name+"/state", probe.State)
+	}
+
+	fields := make([]string, 0, len(pdu.Fields))
+	for field := range pdu.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		add("fields/"+field, pdu.Fields[field])
+	}
+
+	return mqttMetricsPayload{
+		Timestamp: pdu.Timestamp.UnixMilli(),
+		Tags:      pdu.Tags,
+		Metrics:   metrics,
+	}
+}
+
+// topicPlaceholder 主題模板中的 {標籤} 佔位符
+var topicPlaceholder = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// topicTemplate 已解析的主題模板
+type topicTemplate struct {
+	source string
+	keys   []string
+}
+
+// parseTopicTemplate 解析主題模板，模板不能包含 MQTT 萬用字元
+func parseTopicTemplate(source string) (*topicTemplate, error) {
+	if strings.ContainsAny(topicPlaceholder.ReplaceAllString(source, ""), "+#") {
+		return nil, fmt.Errorf("主題模板 %q 不能包含 + 或 #", source)
+	}
+	t := &topicTemplate{source: source}
+	for _, match := range topicPlaceholder.FindAllStringSubmatch(source, -1) {
+		t.keys = append(t.keys, match[1])
+	}
+	return t, nil
+}
+
+// render 以 PDU 標籤填入主題模板，任一佔位符沒有值時返回 false
+// {name} 為依位置標籤組成的 PDU 名稱（見 PDULocationName），位置標籤不完整時依序使用 name 標籤與設備識別；
+// {device} 為設備識別，{measurement} 為數據名稱，其他佔位符取同名標籤
+// 值中的 /、+、# 替換為 _，避免改變主題層級或形成萬用字元
+func (t *topicTemplate) render(pdu models.PDUData) (string, bool) {
+	values := make(map[string]string, len(t.keys))
+	for _, key := range t.keys {
+		var value string
+		switch key {
+		case "name":
+			if name, ok := PDULocationName(pdu.Tags); ok {
+				value = name
+			} else if name := pdu.Tags["name"]; name != "" {
+				value = name
+			} else {
+				value = energyDeviceKey(&pdu)
+			}
+		case "device":
+			value = energyDeviceKey(&pdu)
+		case "measurement":
+			value = pdu.Name
+		default:
+			value = pdu.Tags[key]
+		}
+		if value == "" {
+			return "", false
+		}
+		values[key] = strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(value)
+	}
+
+	return topicPlaceholder.ReplaceAllStringFunc(t.source, func(match string) string {
+		return values[match[1:len(match)-1]]
+	}), true
+}
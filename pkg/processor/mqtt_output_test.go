@@ -0,0 +1,155 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"viot/internal/mqtttest"
+	"viot/models"
+
+	"go.uber.org/zap"
+)
+
+func testMQTTPDU(current float64) models.PDUData {
+	return models.PDUData{
+		Name:      "pdu",
+		Timestamp: time.Unix(1700000000, 0),
+		Tags: map[string]string{
+			"factory": "F1", "phase": "P1", "datacenter": "DC1", "room": "R1", "rack": "A01", "side": "L",
+		},
+		Current:  current,
+		Branches: []models.Branch{{ID: "1", Current: 1, Power: 2}},
+	}
+}
+
+// firstMetric 返回 metrics 格式訊息的第一個指標值（總電流）
+func firstMetric(t *testing.T, msg mqtttest.Message) float64 {
+	t.Helper()
+	var payload mqttMetricsPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		t.Fatalf("解析訊息內容失敗: %v", err)
+	}
+	if len(payload.Metrics) == 0 {
+		t.Fatalf("訊息沒有指標: %s", msg.Payload)
+	}
+	value, _ := payload.Metrics[0].Value.(float64)
+	return value
+}
+
+func waitForCondition(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待條件成立超時")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestMQTTOutputPublishAndReconnect(t *testing.T) {
+	broker := mqtttest.Start(t, "")
+	addr := broker.Addr()
+
+	h, err := NewMQTTOutputHandler(MQTTOutputConfig{
+		Broker:  broker.URL(),
+		Payload: MQTTPayloadMetrics,
+		QoS:     1,
+		Retain:  true,
+		Timeout: 2 * time.Second,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("創建MQTT輸出處理程序失敗: %v", err)
+	}
+	defer h.Close()
+	waitForCondition(t, func() bool { return h.Stats().Connected })
+
+	// 缺少 factory 標籤的數據無法填入默認主題模板
+	data := []models.PDUData{testMQTTPDU(1), {Name: "pdu", Tags: map[string]string{"ip": "10.0.0.1"}}}
+	if err := h.HandlePDUData(context.Background(), data); err != nil {
+		t.Fatalf("發布失敗: %v", err)
+	}
+	waitForCondition(t, func() bool { return len(broker.Received()) == 1 })
+
+	msg := broker.Received()[0]
+	if msg.Topic != "viot/F1/R1/F1P1DC1R1A01PL" {
+		t.Errorf("主題應為 viot/F1/R1/F1P1DC1R1A01PL，實際為 %q", msg.Topic)
+	}
+	if msg.QoS != 1 || !msg.Retain {
+		t.Errorf("應以 QoS 1 保留訊息發布，實際為 qos=%d retain=%v", msg.QoS, msg.Retain)
+	}
+	if got := firstMetric(t, msg); got != 1 {
+		t.Errorf("總電流應為 1，實際為 %g", got)
+	}
+	if stats := h.Stats(); stats.Skipped != 1 {
+		t.Errorf("應略過 1 筆數據，實際為 %+v", stats)
+	}
+
+	// 代理伺服器停機期間的訊息緩存，重連後依序發布
+	broker.Stop()
+	waitForCondition(t, func() bool { return !h.Stats().Connected })
+	for current := 2; current <= 4; current++ {
+		if err := h.HandlePDUData(context.Background(), []models.PDUData{testMQTTPDU(float64(current))}); err != nil {
+			t.Fatalf("未連線時緩存訊息不應返回錯誤: %v", err)
+		}
+	}
+	if buffered := h.Stats().Buffered; buffered != 3 {
+		t.Fatalf("應緩存 3 則訊息，實際為 %d", buffered)
+	}
+
+	restarted := mqtttest.Start(t, addr)
+	waitForCondition(t, func() bool { return len(restarted.Received()) == 3 })
+	for i, msg := range restarted.Received() {
+		if got, want := firstMetric(t, msg), float64(i+2); got != want {
+			t.Errorf("第 %d 則訊息的總電流應為 %g，實際為 %g", i, want, got)
+		}
+	}
+	if buffered := h.Stats().Buffered; buffered != 0 {
+		t.Errorf("重連後緩存應為空，實際為 %d", buffered)
+	}
+}
+
+func TestMQTTOutputDrainsBufferWhileConnected(t *testing.T) {
+	broker := mqtttest.Start(t, "")
+
+	h, err := NewMQTTOutputHandler(MQTTOutputConfig{
+		Broker:  broker.URL(),
+		Payload: MQTTPayloadMetrics,
+		QoS:     1,
+		Timeout: 300 * time.Millisecond,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("創建MQTT輸出處理程序失敗: %v", err)
+	}
+	defer h.Close()
+	waitForCondition(t, func() bool { return h.Stats().Connected })
+
+	// 連線未斷但發布逾時，訊息緩存後返回 nil
+	broker.SetNoAck(true)
+	if err := h.HandlePDUData(context.Background(), []models.PDUData{testMQTTPDU(1)}); err != nil {
+		t.Fatalf("發布失敗並已緩存時不應返回錯誤: %v", err)
+	}
+	if stats := h.Stats(); stats.Buffered != 1 || stats.Errors != 1 {
+		t.Fatalf("應緩存 1 則訊息並記錄 1 次錯誤，實際為 %+v", stats)
+	}
+
+	// 沒有重連，下一次呼叫先發布緩存的訊息，再發布新訊息
+	broker.SetNoAck(false)
+	if err := h.HandlePDUData(context.Background(), []models.PDUData{testMQTTPDU(2)}); err != nil {
+		t.Fatalf("發布失敗: %v", err)
+	}
+	received := broker.Received()
+	if len(received) != 2 {
+		t.Fatalf("應收到 2 則訊息，實際為 %d", len(received))
+	}
+	for i, msg := range received {
+		if got, want := firstMetric(t, msg), float64(i+1); got != want {
+			t.Errorf("第 %d 則訊息的總電流應為 %g，實際為 %g", i, want, got)
+		}
+	}
+	if stats := h.Stats(); stats.Buffered != 0 || stats.Published != 2 {
+		t.Errorf("緩存應為空並已發布 2 則訊息，實際為 %+v", stats)
+	}
+}
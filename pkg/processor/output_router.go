@@ -2,50 +2,179 @@ package processor
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"viot/models"
 
 	"go.uber.org/zap"
 )
 
+// 輸出路由器默認參數
+const (
+	defaultOutputQueueSize        = 1000
+	defaultOutputFailureThreshold = 5
+	defaultOutputOpenTimeout      = 30 * time.Second
+	defaultOutputHandlerTimeout   = 30 * time.Second
+)
+
+// 斷路器狀態
+const (
+	BreakerClosed   = "closed"    // 正常交付
+	BreakerOpen     = "open"      // 連續失敗後暫停交付，數據直接丟棄
+	BreakerHalfOpen = "half_open" // 暫停時間結束，以一批數據試探處理程序是否恢復
+)
+
+// ErrOutputQueueFull 輸出處理程序的隊列已滿，數據未交給該處理程序
+var ErrOutputQueueFull = errors.New("輸出隊列已滿")
+
+// errDeliveryInFlight 上一次逾時的交付仍在執行，本批數據未交給處理程序
+var errDeliveryInFlight = errors.New("上一次逾時的交付仍在執行")
+
+// OutputRouterConfig 輸出路由器設置
+type OutputRouterConfig struct {
+	QueueSize        int           `json:"queue_size" yaml:"queue_size"`               // 每個處理程序隊列可容納的批次數
+	FailureThreshold int           `json:"failure_threshold" yaml:"failure_threshold"` // 連續失敗此次數後斷路
+	OpenTimeout      time.Duration `json:"open_timeout" yaml:"open_timeout"`           // 斷路後等待多久再以一批數據試探
+	HandlerTimeout   time.Duration `json:"handler_timeout" yaml:"handler_timeout"`     // 單次交付的逾時，逾時視為失敗
+}
+
+// OutputHandlerStatus 單個輸出處理程序的交付統計
+type OutputHandlerStatus struct {
+	Name                string        `json:"name"`
+	State               string        `json:"state"` // closed、open、half_open
+	QueueDepth          int           `json:"queue_depth"`
+	QueueCapacity       int           `json:"queue_capacity"`
+	Delivered           int64         `json:"delivered"`            // 交付成功的 PDU 數據數
+	Failed              int64         `json:"failed"`               // 交付失敗的批次數
+	Dropped             int64         `json:"dropped"`              // 隊列已滿而丟棄的 PDU 數據數
+	Rejected            int64         `json:"rejected"`             // 斷路期間丟棄的 PDU 數據數
+	ConsecutiveFailures int           `json:"consecutive_failures"` // 連續失敗次數
+	LastError           string        `json:"last_error,omitempty"`
+	LastErrorAt         time.Time     `json:"last_error_at"`
+	LastDelivered       time.Time     `json:"last_delivered"`
+	OpenedAt            time.Time     `json:"opened_at"` // 最近一次斷路的時間
+	AvgDuration         time.Duration `json:"avg_duration"`
+	MaxDuration         time.Duration `json:"max_duration"`
+
+	runs     int64
+	duration time.Duration
+}
+
+// OutputRouterStatus 輸出路由器狀態
+type OutputRouterStatus struct {
+	Config   OutputRouterConfig    `json:"config"`
+	Handlers []OutputHandlerStatus `json:"handlers"`
+}
+
+// outputWorker 單個輸出處理程序的隊列、工作協程與斷路器
+type outputWorker struct {
+	router  *OutputRouterImpl
+	handler models.OutputHandler
+	queue   chan []models.PDUData
+	status  OutputHandlerStatus
+	mutex   sync.Mutex
+
+	// inflight 逾時後仍在背景執行的交付，結束時關閉；只由工作協程存取
+	inflight chan struct{}
+}
+
 // OutputRouterImpl 實現OutputRouter接口
+// 每個處理程序有各自的有界隊列與工作協程，慢的處理程序不會阻塞其他處理程序；
+// 隊列已滿時丟棄該處理程序的數據，連續失敗達到門檻時斷路，暫停時間結束後以一批數據試探是否恢復
 type OutputRouterImpl struct {
-	handlers     []models.OutputHandler
+	config       OutputRouterConfig
+	workers      []*outputWorker
+	names        map[string]int // 同類型處理程序的數量，用於區分名稱
+	closed       bool
 	handlerMutex sync.RWMutex
+	wg           sync.WaitGroup
 	logger       *zap.Logger
+
+	now func() time.Time
 }
 
-// NewOutputRouter 創建新的輸出路由器
+// NewOutputRouter 以默認設置創建新的輸出路由器
 func NewOutputRouter(logger *zap.Logger) *OutputRouterImpl {
+	return NewOutputRouterWithConfig(OutputRouterConfig{}, logger)
+}
+
+// NewOutputRouterWithConfig 創建新的輸出路由器，未設置的參數使用默認值
+func NewOutputRouterWithConfig(config OutputRouterConfig, logger *zap.Logger) *OutputRouterImpl {
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultOutputQueueSize
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaultOutputFailureThreshold
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = defaultOutputOpenTimeout
+	}
+	if config.HandlerTimeout <= 0 {
+		config.HandlerTimeout = defaultOutputHandlerTimeout
+	}
+
 	return &OutputRouterImpl{
-		handlers: make([]models.OutputHandler, 0),
-		logger:   logger.Named("output-router"),
+		config: config,
+		names:  make(map[string]int),
+		logger: logger.Named("output-router"),
+		now:    time.Now,
 	}
 }
 
-// RegisterHandler 註冊輸出處理器
+// RegisterHandler 註冊輸出處理器並啟動其工作協程
 func (r *OutputRouterImpl) RegisterHandler(handler models.OutputHandler) error {
 	r.handlerMutex.Lock()
 	defer r.handlerMutex.Unlock()
 
-	r.handlers = append(r.handlers, handler)
+	if r.closed {
+		return errors.New("輸出路由器已關閉")
+	}
+
+	// 名稱為處理程序的類型，同類型的處理程序加上序號
+	name := fmt.Sprintf("%T", handler)
+	name = name[strings.LastIndex(name, ".")+1:]
+	r.names[name]++
+	if count := r.names[name]; count > 1 {
+		name = fmt.Sprintf("%s#%d", name, count)
+	}
+
+	w := &outputWorker{
+		router:  r,
+		handler: handler,
+		queue:   make(chan []models.PDUData, r.config.QueueSize),
+		status: OutputHandlerStatus{
+			Name:          name,
+			State:         BreakerClosed,
+			QueueCapacity: r.config.QueueSize,
+		},
+	}
+	r.workers = append(r.workers, w)
+
+	r.wg.Add(1)
+	go w.run()
+
 	r.logger.Info("註冊輸出處理程序",
-		zap.String("handler", fmt.Sprintf("%T", handler)))
+		zap.String("handler", name),
+		zap.Int("queue_size", r.config.QueueSize))
 	return nil
 }
 
-// RoutePDUData 路由PDU數據到適當的輸出處理器
+// RoutePDUData 將PDU數據放入每個處理程序的隊列後立即返回
+// 隊列中的數據由處理程序非同步讀取，調用方與處理程序都不應修改傳入的數據；
+// 任一處理程序的隊列已滿時返回 ErrOutputQueueFull，其他處理程序仍會收到數據
 func (r *OutputRouterImpl) RoutePDUData(ctx context.Context, data ...interface{}) error {
 	r.handlerMutex.RLock()
 	defer r.handlerMutex.RUnlock()
 
-	if len(r.handlers) == 0 {
+	if len(r.workers) == 0 || r.closed {
 		return nil
 	}
 
-	// 將interface{}轉換為PDUData類型
+	// 將interface{}轉換為PDUData類型，複製到新的切片，調用方之後替換元素不影響隊列中的數據
 	var pduData []models.PDUData
 	for _, item := range data {
 		switch v := item.(type) {
@@ -63,42 +192,190 @@ func (r *OutputRouterImpl) RoutePDUData(ctx context.Context, data ...interface{}
 		return nil
 	}
 
-	// 路由到所有處理程序
-	for _, handler := range r.handlers {
-		if err := handler.HandlePDUData(ctx, pduData); err != nil {
-			r.logger.Error("處理PDU數據失敗",
-				zap.String("handler", fmt.Sprintf("%T", handler)),
-				zap.Error(err))
+	var full []string
+	for _, w := range r.workers {
+		if !w.enqueue(pduData) {
+			full = append(full, w.status.Name)
 		}
 	}
+	if len(full) > 0 {
+		return fmt.Errorf("%w: %s", ErrOutputQueueFull, strings.Join(full, ", "))
+	}
+	return nil
+}
+
+// Status 依註冊順序返回各處理程序的交付統計
+func (r *OutputRouterImpl) Status() OutputRouterStatus {
+	r.handlerMutex.RLock()
+	defer r.handlerMutex.RUnlock()
+
+	status := OutputRouterStatus{
+		Config:   r.config,
+		Handlers: make([]OutputHandlerStatus, 0, len(r.workers)),
+	}
+	for _, w := range r.workers {
+		w.mutex.Lock()
+		handlerStatus := w.status
+		w.mutex.Unlock()
+		handlerStatus.QueueDepth = len(w.queue)
+		status.Handlers = append(status.Handlers, handlerStatus)
+	}
+	return status
+}
+
+// Close 停止接收數據，等待各處理程序交付已入隊的數據
+// 不關閉處理程序本身，處理程序的 Close 應在路由器關閉後調用
+func (r *OutputRouterImpl) Close() error {
+	r.handlerMutex.Lock()
+	if r.closed {
+		r.handlerMutex.Unlock()
+		return nil
+	}
+	r.closed = true
+	for _, w := range r.workers {
+		close(w.queue)
+	}
+	r.handlerMutex.Unlock()
 
+	r.wg.Wait()
+	r.logger.Info("輸出路由器已關閉")
 	return nil
 }
 
-// InfluxDBOutputHandler InfluxDB輸出處理程序
-type InfluxDBOutputHandler struct {
-	logger *zap.Logger
-	// TODO: 添加InfluxDB客戶端配置
+// enqueue 將數據放入隊列，斷路期間直接丟棄；隊列已滿時返回 false
+func (w *outputWorker) enqueue(data []models.PDUData) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// 斷路期間不佔用隊列；暫停時間結束後由工作協程決定是否試探
+	if w.status.State == BreakerOpen && w.router.now().Sub(w.status.OpenedAt) < w.router.config.OpenTimeout {
+		w.status.Rejected += int64(len(data))
+		return true
+	}
+
+	select {
+	case w.queue <- data:
+		return true
+	default:
+		w.status.Dropped += int64(len(data))
+		return false
+	}
 }
 
-// NewInfluxDBOutputHandler 創建InfluxDB輸出處理程序
-func NewInfluxDBOutputHandler(logger *zap.Logger) *InfluxDBOutputHandler {
-	return &InfluxDBOutputHandler{
-		logger: logger.Named("influxdb-output"),
+// run 依序交付隊列中的數據，隊列關閉後交付剩餘數據並退出
+func (w *outputWorker) run() {
+	defer w.router.wg.Done()
+
+	for data := range w.queue {
+		if !w.allow() {
+			continue
+		}
+
+		// 路由時的上下文可能已結束，交付使用獨立的逾時
+		ctx, cancel := context.WithTimeout(context.Background(), w.router.config.HandlerTimeout)
+		start := w.router.now()
+		err := w.deliver(ctx, data)
+		elapsed := w.router.now().Sub(start)
+		cancel()
+
+		w.record(len(data), elapsed, err)
 	}
 }
 
-// HandlePDUData 處理PDU數據
-func (h *InfluxDBOutputHandler) HandlePDUData(ctx context.Context, data []models.PDUData) error {
-	for _, pdu := range data {
-		h.logger.Debug("處理PDU數據",
-			zap.String("name", pdu.Name),
-			zap.Time("timestamp", pdu.Timestamp))
+// deliver 交付一批數據，逾時或處理程序 panic 時返回錯誤
+// 同一處理程序同時只執行一次交付：上一次逾時的交付仍在執行時，本批數據不交付並視為失敗
+func (w *outputWorker) deliver(ctx context.Context, data []models.PDUData) error {
+	if w.inflight != nil {
+		select {
+		case <-w.inflight:
+			w.inflight = nil
+		default:
+			return errDeliveryInFlight
+		}
+	}
+
+	result := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				result <- fmt.Errorf("處理程序 panic: %v", recovered)
+			}
+		}()
+		result <- w.handler.HandlePDUData(ctx, data)
+	}()
 
-		// TODO: 將PDU數據寫入InfluxDB
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		// 處理程序未遵守上下文時仍在背景執行，交付視為失敗，結束前不再調用處理程序
+		w.inflight = done
+		return fmt.Errorf("交付超過 %s: %w", w.router.config.HandlerTimeout, ctx.Err())
 	}
+}
 
-	return nil
+// allow 斷路器是否允許交付；暫停時間結束時轉為半開並允許一批數據試探
+func (w *outputWorker) allow() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.status.State != BreakerOpen {
+		return true
+	}
+	if w.router.now().Sub(w.status.OpenedAt) < w.router.config.OpenTimeout {
+		// 斷路前已入隊的數據
+		return false
+	}
+	w.status.State = BreakerHalfOpen
+	return true
+}
+
+// record 記錄交付結果並更新斷路器
+func (w *outputWorker) record(count int, elapsed time.Duration, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	s := &w.status
+	s.runs++
+	s.duration += elapsed
+	s.AvgDuration = s.duration / time.Duration(s.runs)
+	if elapsed > s.MaxDuration {
+		s.MaxDuration = elapsed
+	}
+
+	if err == nil {
+		if s.State == BreakerHalfOpen {
+			w.router.logger.Info("輸出處理程序已恢復，關閉斷路器", zap.String("handler", s.Name))
+		}
+		s.State = BreakerClosed
+		s.ConsecutiveFailures = 0
+		s.Delivered += int64(count)
+		s.LastDelivered = w.router.now()
+		return
+	}
+
+	s.Failed++
+	s.ConsecutiveFailures++
+	s.LastError = err.Error()
+	s.LastErrorAt = w.router.now()
+	w.router.logger.Error("處理PDU數據失敗",
+		zap.String("handler", s.Name),
+		zap.Int("count", count),
+		zap.Int("consecutive_failures", s.ConsecutiveFailures),
+		zap.Error(err))
+
+	if s.State == BreakerHalfOpen || s.ConsecutiveFailures >= w.router.config.FailureThreshold {
+		if s.State != BreakerOpen {
+			w.router.logger.Warn("輸出處理程序連續失敗，暫停交付",
+				zap.String("handler", s.Name),
+				zap.Int("consecutive_failures", s.ConsecutiveFailures),
+				zap.Duration("open_timeout", w.router.config.OpenTimeout))
+		}
+		s.State = BreakerOpen
+		s.OpenedAt = w.router.now()
+	}
 }
 
 // LoggingOutputHandler 日誌輸出處理程序
@@ -123,7 +400,9 @@ func (h *LoggingOutputHandler) HandlePDUData(ctx context.Context, data []models.
 			zap.Float64("voltage", pdu.Voltage),
 			zap.Float64("power", pdu.Power),
 			zap.Int("branches", len(pdu.Branches)),
-			zap.Int("phases", len(pdu.Phases)))
+			zap.Int("phases", len(pdu.Phases)),
+			zap.Int("outlets", len(pdu.Outlets)),
+			zap.Int("env_probes", len(pdu.Environment)))
 	}
 
 	return nil
@@ -2,9 +2,12 @@ package processor
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"viot/logger"
@@ -19,12 +22,34 @@ type PDUProcessor struct {
 	config       models.PDUProcessorConfig
 	scales       []models.PDUScale
 	handlers     map[string]map[string]models.PDUManufacturerHandler
+	profiles     []*ProfileHandler
+	profileDir   string
+	handlerMutex sync.RWMutex
 	outputRouter models.OutputRouter
+	energy       *EnergyCounterTracker
+	counterBits  int
+	assembler    *SnapshotAssembler
+	diagnostics  *FieldDiagnostics
+	validator    *Validator
+	validation   *models.PDUValidation
+	quarantine   QuarantineStore
+	registry     *RegistryEnricher
+	latest       map[string]models.PDUData
+	latestMutex  sync.RWMutex
+	cancel       context.CancelFunc
 }
 
 // NewPDUProcessor 創建 PDU 處理器
 func NewPDUProcessor(name string, config models.ProcessorConfig, logger logger.Logger) *PDUProcessor {
 	base := NewBaseProcessor(name, config, logger)
+	profileDir := ""
+	counterBits := defaultCounterBits
+	stateFile := ""
+	saveInterval := defaultEnergySaveInterval
+	var assembler *SnapshotAssembler
+	var validation *models.PDUValidation
+	var quarantine QuarantineStore
+	var registry *RegistryEnricher
 	pduConfig := models.PDUProcessorConfig{
 		Measurement: "pdu",
 	}
@@ -34,6 +59,9 @@ func NewPDUProcessor(name string, config models.ProcessorConfig, logger logger.L
 		if measurement, ok := options["measurement"].(string); ok {
 			pduConfig.Measurement = measurement
 		}
+		if dir, ok := options["profile_dir"].(string); ok {
+			profileDir = dir
+		}
 
 		// 解析Schema
 		if schemaOpts, ok := options["schema"].(map[string]interface{}); ok {
@@ -48,6 +76,50 @@ func NewPDUProcessor(name string, config models.ProcessorConfig, logger logger.L
 			}
 			// 其他字段解析...
 		}
+
+		// 解析能耗計數器設置
+		if energyOpts, ok := options["energy"].(map[string]interface{}); ok {
+			switch bits := energyOpts["counter_bits"].(type) {
+			case int:
+				counterBits = bits
+			case float64:
+				counterBits = int(bits)
+			}
+			if file, ok := energyOpts["state_file"].(string); ok {
+				stateFile = file
+			}
+			if interval, ok := energyOpts["save_interval"].(string); ok {
+				if d, err := time.ParseDuration(interval); err == nil {
+					saveInterval = d
+				}
+			}
+		}
+
+		// 解析快照組裝設置
+		if snapshotOpts, ok := options["snapshot"].(map[string]interface{}); ok {
+			if snapshotConfig := parseSnapshotConfig(snapshotOpts); snapshotConfig.Enabled {
+				assembler = NewSnapshotAssembler(snapshotConfig)
+			}
+		}
+
+		// 解析默認驗證規則與隔離區
+		if validationOpts, ok := options["validation"]; ok {
+			if opts, err := parseValidationOptions(validationOpts); err != nil {
+				base.GetLogger().Error("解析PDU驗證設置失敗", zap.Error(err))
+			} else {
+				validation = &opts.PDUValidation
+				if opts.QuarantineFile != "" {
+					quarantine = NewFileQuarantine(opts.QuarantineFile, opts.QuarantineMaxSize)
+				}
+			}
+		}
+
+		// 解析註冊表標籤補充設置
+		if registryOpts, ok := options["registry"].(map[string]interface{}); ok {
+			if registryConfig := parseRegistryConfig(registryOpts); registryConfig.File != "" {
+				registry = NewRegistryEnricher(registryConfig)
+			}
+		}
 	}
 
 	p := &PDUProcessor{
@@ -55,10 +127,43 @@ func NewPDUProcessor(name string, config models.ProcessorConfig, logger logger.L
 		config:        pduConfig,
 		scales:        []models.PDUScale{},
 		handlers:      make(map[string]map[string]models.PDUManufacturerHandler),
+		profileDir:    profileDir,
+		energy:        NewEnergyCounterTracker(stateFile, saveInterval),
+		counterBits:   counterBits,
+		assembler:     assembler,
+		diagnostics:   NewFieldDiagnostics(),
+		validator:     NewValidator(),
+		validation:    validation,
+		quarantine:    quarantine,
+		registry:      registry,
+		latest:        make(map[string]models.PDUData),
 	}
 
-	// 添加默認處理程序
-	p.registerDefaultHandlers()
+	// 載入型號描述檔，描述檔目錄無效時退回內建描述檔
+	if err := p.ReloadProfiles(); err != nil {
+		p.GetLogger().Error("載入PDU型號描述檔失敗，僅使用內建描述檔",
+			zap.String("profile_dir", p.profileDir),
+			zap.Error(err))
+		if builtin, err := LoadPDUProfiles(""); err == nil {
+			p.profiles = builtin
+		}
+	}
+
+	// 載入設備註冊表，失敗時在註冊表變更後的下一次檢查重新載入
+	if p.registry != nil {
+		if err := p.registry.Reload(); err != nil {
+			p.GetLogger().Error("載入設備註冊表失敗",
+				zap.String("file", registry.Stats().File),
+				zap.Error(err))
+		}
+	}
+
+	// 載入上次保存的能耗計數器狀態，失敗時從首次讀數重新開始計算增量
+	if err := p.energy.Load(); err != nil {
+		p.GetLogger().Error("載入能耗計數器狀態失敗",
+			zap.String("state_file", stateFile),
+			zap.Error(err))
+	}
 
 	return p
 }
@@ -68,16 +173,24 @@ func (p *PDUProcessor) SetOutputRouter(router models.OutputRouter) {
 	p.outputRouter = router
 }
 
+// SetQuarantineStore 設置隔離區存儲，未設置時未通過驗證的數據只記錄日誌
+func (p *PDUProcessor) SetQuarantineStore(store QuarantineStore) {
+	p.quarantine = store
+}
+
 // AddScale 添加比例因子
 func (p *PDUProcessor) AddScale(scale models.PDUScale) {
 	p.scales = append(p.scales, scale)
 }
 
-// RegisterHandler 註冊處理程序
+// RegisterHandler 註冊處理程序，用於無法以描述檔表達的特殊型號
 func (p *PDUProcessor) RegisterHandler(manufacturer, model string, handler models.PDUManufacturerHandler) {
 	manufacturer = strings.ToLower(manufacturer)
 	model = strings.ToLower(model)
 
+	p.handlerMutex.Lock()
+	defer p.handlerMutex.Unlock()
+
 	if _, ok := p.handlers[manufacturer]; !ok {
 		p.handlers[manufacturer] = make(map[string]models.PDUManufacturerHandler)
 	}
@@ -85,6 +198,39 @@ func (p *PDUProcessor) RegisterHandler(manufacturer, model string, handler model
 	p.handlers[manufacturer][model] = handler
 }
 
+// ReloadProfiles 重新載入內建與描述檔目錄中的型號描述檔，載入失敗時保留原有描述檔
+func (p *PDUProcessor) ReloadProfiles() error {
+	profiles, err := LoadPDUProfiles(p.profileDir)
+	if err != nil {
+		return err
+	}
+
+	p.handlerMutex.Lock()
+	p.profiles = profiles
+	p.handlerMutex.Unlock()
+
+	names := make([]string, 0, len(profiles))
+	for _, h := range profiles {
+		names = append(names, h.profile.Name)
+	}
+	p.GetLogger().Info("PDU型號描述檔已載入",
+		zap.String("profile_dir", p.profileDir),
+		zap.Strings("profiles", names))
+	return nil
+}
+
+// Profiles 返回目前載入的型號描述檔
+func (p *PDUProcessor) Profiles() []models.PDUProfile {
+	p.handlerMutex.RLock()
+	defer p.handlerMutex.RUnlock()
+
+	profiles := make([]models.PDUProfile, 0, len(p.profiles))
+	for _, h := range p.profiles {
+		profiles = append(profiles, h.Profile())
+	}
+	return profiles
+}
+
 // Process 處理PDU數據
 func (p *PDUProcessor) Process(data []models.DeviceData) error {
 	if len(data) == 0 {
@@ -131,8 +277,26 @@ func (p *PDUProcessor) ProcessPDUPoints(ctx context.Context, points []models.PDU
 		return nil, fmt.Errorf("沒有提供數據點")
 	}
 
+	// 表格行先組裝為設備快照，收集中的數據點在快照完成後才處理
+	if p.assembler != nil {
+		points = p.assembler.Add(points, time.Now())
+		if len(points) == 0 {
+			return nil, nil
+		}
+	}
+
+	return p.processPoints(ctx, points), nil
+}
+
+// processPoints 處理已組裝完成的數據點並發送到輸出路由
+func (p *PDUProcessor) processPoints(ctx context.Context, points []models.PDUPoint) []models.PDUData {
 	var results []models.PDUData
 
+	// 以設備註冊表補充位置、製造商與型號標籤，需在判斷處理程序之前
+	if p.registry != nil {
+		p.enrichPoints(points)
+	}
+
 	for _, point := range points {
 		// 檢查是否為PDU數據
 		if !p.isPDUData(point) {
@@ -140,6 +304,9 @@ func (p *PDUProcessor) ProcessPDUPoints(ctx context.Context, points []models.PDU
 		}
 
 		pduData, err := p.ProcessPDUPoint(ctx, point)
+		if errors.Is(err, ErrQuarantined) {
+			continue
+		}
 		if err != nil {
 			p.GetLogger().Error("處理PDU數據點失敗",
 				zap.String("name", point.Name),
@@ -153,6 +320,17 @@ func (p *PDUProcessor) ProcessPDUPoints(ctx context.Context, points []models.PDU
 	// 增加處理計數
 	p.IncrementProcessedCount(int64(len(results)))
 
+	// 記錄各設備最近一次的數據供 API 查詢
+	p.latestMutex.Lock()
+	for _, pdu := range results {
+		p.latest[energyDeviceKey(&pdu)] = pdu
+	}
+	p.latestMutex.Unlock()
+
+	if err := p.energy.SaveIfDue(); err != nil {
+		p.GetLogger().Error("保存能耗計數器狀態失敗", zap.Error(err))
+	}
+
 	// 發送到輸出路由
 	if p.outputRouter != nil && len(results) > 0 {
 		if err := p.outputRouter.RoutePDUData(ctx, results); err != nil {
@@ -160,7 +338,23 @@ func (p *PDUProcessor) ProcessPDUPoints(ctx context.Context, points []models.PDU
 		}
 	}
 
-	return results, nil
+	return results
+}
+
+// enrichPoints 註冊表變更時重新載入，並為數據點附加註冊表標籤
+func (p *PDUProcessor) enrichPoints(points []models.PDUPoint) {
+	reloaded, err := p.registry.Refresh(time.Now())
+	if err != nil {
+		p.GetLogger().Error("重新載入設備註冊表失敗，保留原有註冊表",
+			zap.String("file", p.registry.Stats().File),
+			zap.Error(err))
+	} else if reloaded {
+		p.GetLogger().Info("設備註冊表已重新載入",
+			zap.String("file", p.registry.Stats().File),
+			zap.Int("entries", p.registry.Stats().Entries))
+	}
+
+	p.registry.Enrich(points)
 }
 
 // ProcessPDUPoint 處理單個PDU數據點
@@ -190,27 +384,11 @@ func (p *PDUProcessor) ProcessPDUPoint(ctx context.Context, point models.PDUPoin
 	if mdl, ok := point.Tags["model"]; ok {
 		model = strings.ToLower(mdl)
 	} else {
-		model = p.detectPDUTypeFromFields(point)
+		model = p.detectPDUTypeFromFields(manufacturer, point)
 	}
 
 	// 獲取處理器
-	var handler models.PDUManufacturerHandler
-
-	// 嘗試獲取指定製造商和型號的處理程序
-	if manufHandlers, ok := p.handlers[manufacturer]; ok {
-		if h, ok := manufHandlers[model]; ok {
-			handler = h
-		} else if h, ok := manufHandlers["default"]; ok {
-			handler = h
-		}
-	}
-
-	// 如果沒有找到，使用默認處理程序
-	if handler == nil {
-		handler = &DefaultPDUHandler{
-			scale: p.getScaleForManufacturer(manufacturer),
-		}
-	}
+	handler := p.resolveHandler(manufacturer, model)
 
 	// 處理字段
 	processedFields, err := handler.ProcessFields(point)
@@ -224,24 +402,23 @@ func (p *PDUProcessor) ProcessPDUPoint(ctx context.Context, point models.PDUPoin
 
 	scale := handler.GetScaleFactor()
 
-	// 處理總體字段
-	p.processTotalFields(point, &pduData, scale, processedFields)
+	// 將字段歸入總體、分支、相位與插座
+	assigned := p.assignFields(&pduData, handler, scale, processedFields, manufacturer, model)
 
-	// 處理分支字段
-	p.processBranchFields(point, &pduData, scale, processedFields)
-
-	// 處理相位字段
-	p.processPhaseFields(point, &pduData, scale, processedFields)
+	// 驗證數據，未通過時寫入隔離區
+	if err := p.validate(&pduData, handler, assigned, manufacturer, model); err != nil {
+		return pduData, err
+	}
 
-	// 發送到輸出路由
-	if p.outputRouter != nil {
-		if err := p.outputRouter.RoutePDUData(ctx, pduData); err != nil {
-			p.GetLogger().Warn("PDU數據路由失敗",
-				zap.String("name", point.Name),
-				zap.Error(err))
-		}
+	// 計算能耗增量，已標記未通過驗證的讀數不參與，避免異常計數器值成為增量基準
+	if pduData.Tags[ValidationTag] != "failed" {
+		p.computeEnergyDeltas(&pduData, handler, scale)
 	}
 
+	// 計算視在功率、功率因數、不平衡度等衍生指標
+	computeDerivedMetrics(&pduData)
+
+	// 數據由 processPoints 整批發送到輸出路由，避免同一讀數經過輸出路由或處理管線兩次
 	return pduData, nil
 }
 
@@ -260,6 +437,7 @@ func (p *PDUProcessor) isPDUData(point models.PDUPoint) bool {
 	// 根據字段判斷
 	hasCurrentField := false
 	hasVoltageField := false
+	hasEnvField := false
 
 	for field := range point.Fields {
 		switch {
@@ -267,160 +445,400 @@ func (p *PDUProcessor) isPDUData(point models.PDUPoint) bool {
 			hasCurrentField = true
 		case strings.Contains(field, "voltage"):
 			hasVoltageField = true
+		case strings.Contains(strings.ToLower(field), "temperature"),
+			strings.Contains(strings.ToLower(field), "humidity"),
+			strings.Contains(strings.ToLower(field), "door"):
+			hasEnvField = true
 		}
 	}
 
-	return hasCurrentField && hasVoltageField
-}
-
-// 處理總體字段
-func (p *PDUProcessor) processTotalFields(point models.PDUPoint, pdu *models.PDUData, scale models.PDUScale, processedFields map[string]float64) {
-	// 處理電流
-	if current, ok := getFieldValue(processedFields, p.config.Schema.TotalCurrentField, "current"); ok {
-		pdu.Current = current * scale.Current
+	if hasCurrentField && hasVoltageField {
+		return true
 	}
 
-	// 處理電壓
-	if voltage, ok := getFieldValue(processedFields, "", "voltage"); ok {
-		pdu.Voltage = voltage * scale.Voltage
+	// 只有環境探頭字段的數據點（如獨立採集的探頭表格），需有描述檔匹配其製造商與型號
+	if hasEnvField {
+		handler := p.resolveHandler(strings.ToLower(point.Tags["manufacturer"]), strings.ToLower(point.Tags["model"]))
+		_, ok := handler.(*ProfileHandler)
+		return ok
 	}
+	return false
+}
 
-	// 處理功率
-	if power, ok := getFieldValue(processedFields, p.config.Schema.TotalPowerField, "power"); ok {
-		pdu.Power = power * scale.Power
+// assignFields 以字段語法將字段歸入總體、分支、相位、插座與環境探頭並套用比例因子
+// 無法解析的字段記錄到字段診斷，不以字段名片段猜測歸類
+func (p *PDUProcessor) assignFields(pdu *models.PDUData, handler models.PDUManufacturerHandler, scale models.PDUScale, fields map[string]float64, manufacturer, model string) []assignedField {
+	grammar := defaultFieldGrammar
+	profile := ""
+	outletStates := defaultOutletStates
+	doorStates := defaultDoorStates
+	envUnits := defaultEnvUnits
+	if h, ok := handler.(*ProfileHandler); ok {
+		grammar = h.grammar
+		profile = h.profile.Name
+		if len(h.profile.OutletStates) > 0 {
+			outletStates = h.profile.OutletStates
+		}
+		if len(h.profile.DoorStates) > 0 {
+			doorStates = h.profile.DoorStates
+		}
+		if len(h.profile.EnvUnits) > 0 {
+			envUnits = h.profile.EnvUnits
+		}
 	}
 
-	// 處理能耗
-	if energy, ok := getFieldValue(processedFields, p.config.Schema.TotalEnergyField, "energy"); ok {
-		pdu.Energy = energy * scale.Energy
+	// 配置中指定的總體字段優先
+	schemaTotals := make(map[string]string)
+	for field, quantity := range map[string]string{
+		p.config.Schema.TotalCurrentField: "current",
+		p.config.Schema.TotalPowerField:   "power",
+		p.config.Schema.TotalEnergyField:  "energy",
+	} {
+		if field != "" {
+			schemaTotals[field] = quantity
+		}
 	}
-}
 
-// 處理分支字段
-func (p *PDUProcessor) processBranchFields(point models.PDUPoint, pdu *models.PDUData, scale models.PDUScale, processedFields map[string]float64) {
 	branchMap := make(map[string]*models.Branch)
+	phaseMap := make(map[string]*models.Phase)
+	outletMap := make(map[string]*models.Outlet)
+	var assigned []assignedField
 
-	// 尋找分支相關字段
-	for field, value := range processedFields {
-		if !strings.Contains(field, "branch") {
+	for field, value := range fields {
+		if isDerivedField(field) {
 			continue
 		}
 
-		// 解析分支ID
-		branchID := extractIDFromField(field, "branch")
-		if branchID == "" {
+		name, ok := grammar.Parse(field)
+		if quantity, exists := schemaTotals[field]; exists {
+			name, ok = FieldName{Scope: ScopeTotal, Quantity: quantity}, true
+		}
+		if !ok {
+			p.recordUnmatched(pdu, field, ReasonUnmatched, manufacturer, model, profile)
 			continue
 		}
 
-		// 獲取或創建分支
-		branch, ok := branchMap[branchID]
-		if !ok {
-			branch = &models.Branch{ID: branchID}
-			branchMap[branchID] = branch
+		// 開關狀態只存在於插座
+		if name.Quantity == "state" && name.Scope != ScopeOutlet {
+			p.recordUnmatched(pdu, field, ReasonUnsupportedScope, manufacturer, model, profile)
+			continue
 		}
 
-		// 根據字段類型更新分支數據
-		switch {
-		case strings.Contains(field, "current"):
-			branch.Current = value * scale.Current
-		case strings.Contains(field, "voltage"):
-			branch.Voltage = value * scale.Voltage
-		case strings.Contains(field, "power"):
-			branch.Power = value * scale.Power
-		case strings.Contains(field, "energy"):
-			branch.Energy = value * scale.Energy
+		value *= scaleForQuantity(scale, name.Quantity)
+		assigned = append(assigned, assignedField{Name: name, Value: value})
+
+		switch name.Scope {
+		case ScopeTotal:
+			assignQuantity(name.Quantity, value, &pdu.Current, &pdu.Voltage, &pdu.Power, &pdu.Energy)
+		case ScopeBranch:
+			branch, ok := branchMap[name.ID]
+			if !ok {
+				branch = &models.Branch{ID: name.ID}
+				branchMap[name.ID] = branch
+			}
+			assignQuantity(name.Quantity, value, &branch.Current, &branch.Voltage, &branch.Power, &branch.Energy)
+		case ScopePhase:
+			phase, ok := phaseMap[name.ID]
+			if !ok {
+				phase = &models.Phase{ID: name.ID}
+				phaseMap[name.ID] = phase
+			}
+			assignQuantity(name.Quantity, value, &phase.Current, &phase.Voltage, &phase.Power, &phase.Energy)
+		case ScopeOutlet:
+			outlet, ok := outletMap[name.ID]
+			if !ok {
+				outlet = &models.Outlet{ID: name.ID}
+				outletMap[name.ID] = outlet
+			}
+			if name.Quantity == "state" {
+				outlet.State = mapState(outletStates, value)
+			} else {
+				assignQuantity(name.Quantity, value, &outlet.Current, &outlet.Voltage, &outlet.Power, &outlet.Energy)
+			}
+		case ScopeEnv:
+			probe := models.EnvProbe{ID: name.ID, Type: name.Quantity, Value: value}
+			if unit, ok := envUnits[name.Quantity]; ok {
+				probe.Unit = unit
+			} else {
+				probe.Unit = defaultEnvUnits[name.Quantity]
+			}
+			if name.Quantity == "door" {
+				probe.State = mapState(doorStates, value)
+			}
+			pdu.Environment = append(pdu.Environment, probe)
+		default:
+			p.recordUnmatched(pdu, field, ReasonUnsupportedScope, manufacturer, model, profile)
 		}
 	}
 
-	// 將分支添加到PDU數據
 	for _, branch := range branchMap {
 		pdu.Branches = append(pdu.Branches, *branch)
 	}
-}
+	sort.Slice(pdu.Branches, func(i, j int) bool {
+		return lessID(pdu.Branches[i].ID, pdu.Branches[j].ID)
+	})
 
-// 處理相位字段
-func (p *PDUProcessor) processPhaseFields(point models.PDUPoint, pdu *models.PDUData, scale models.PDUScale, processedFields map[string]float64) {
-	phaseMap := make(map[string]*models.Phase)
+	for _, phase := range phaseMap {
+		pdu.Phases = append(pdu.Phases, *phase)
+	}
+	sort.Slice(pdu.Phases, func(i, j int) bool {
+		return lessID(pdu.Phases[i].ID, pdu.Phases[j].ID)
+	})
 
-	// 尋找相位相關字段
-	for field, value := range processedFields {
-		phaseID := ""
+	for _, outlet := range outletMap {
+		pdu.Outlets = append(pdu.Outlets, *outlet)
+	}
+	sort.Slice(pdu.Outlets, func(i, j int) bool {
+		return lessID(pdu.Outlets[i].ID, pdu.Outlets[j].ID)
+	})
 
-		// 檢查是否包含phase或L1/L2/L3
-		if strings.Contains(field, "phase") {
-			phaseID = extractIDFromField(field, "phase")
-		} else if strings.Contains(field, "L1") {
-			phaseID = "L1"
-		} else if strings.Contains(field, "L2") {
-			phaseID = "L2"
-		} else if strings.Contains(field, "L3") {
-			phaseID = "L3"
+	sort.Slice(pdu.Environment, func(i, j int) bool {
+		if pdu.Environment[i].ID != pdu.Environment[j].ID {
+			return lessID(pdu.Environment[i].ID, pdu.Environment[j].ID)
 		}
+		return pdu.Environment[i].Type < pdu.Environment[j].Type
+	})
+	return assigned
+}
 
-		if phaseID == "" {
-			continue
-		}
+// defaultOutletStates 默認插座狀態映射
+var defaultOutletStates = map[string]string{
+	"0": "off",
+	"1": "on",
+}
 
-		// 獲取或創建相位
-		phase, ok := phaseMap[phaseID]
-		if !ok {
-			phase = &models.Phase{ID: phaseID}
-			phaseMap[phaseID] = phase
+// defaultDoorStates 默認門磁狀態映射
+var defaultDoorStates = map[string]string{
+	"0": "closed",
+	"1": "open",
+}
+
+// defaultEnvUnits 環境探頭默認單位，門磁沒有單位
+var defaultEnvUnits = map[string]string{
+	"temperature": "C",
+	"humidity":    "%RH",
+}
+
+// mapState 依映射將狀態原始值轉換為 on/off、open/closed 等名稱，無法對應時返回原始值
+func mapState(states map[string]string, value float64) string {
+	raw := strconv.FormatFloat(value, 'f', -1, 64)
+	if state, ok := states[raw]; ok {
+		return state
+	}
+	return raw
+}
+
+// lessID 比較 ID，兩者皆為數字時依數值排序，否則依字串排序
+func lessID(a, b string) bool {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return x < y
+	}
+	return a < b
+}
+
+// validate 以型號描述檔或處理器的驗證規則檢查數據
+// 未通過驗證的數據寫入隔離區；drop 時返回 ErrQuarantined，flag 時加上 validation=failed 標籤後繼續處理
+func (p *PDUProcessor) validate(pdu *models.PDUData, handler models.PDUManufacturerHandler, fields []assignedField, manufacturer, model string) error {
+	rules := p.validation
+	profile := ""
+	if h, ok := handler.(*ProfileHandler); ok {
+		profile = h.profile.Name
+		if h.profile.Validation != nil {
+			rules = h.profile.Validation
 		}
+	}
+	if rules == nil {
+		return nil
+	}
 
-		// 根據字段類型更新相位數據
-		switch {
-		case strings.Contains(field, "current"):
-			phase.Current = value * scale.Current
-		case strings.Contains(field, "voltage"):
-			phase.Voltage = value * scale.Voltage
-		case strings.Contains(field, "power"):
-			phase.Power = value * scale.Power
-		case strings.Contains(field, "energy"):
-			phase.Energy = value * scale.Energy
+	device := energyDeviceKey(pdu)
+	violations := p.validator.Validate(device, pdu.Timestamp, fields, rules)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	action := ValidationDrop
+	if rules.Action == ValidationFlag {
+		action = ValidationFlag
+		pdu.Tags[ValidationTag] = "failed"
+	}
+	reason := violationSummary(violations)
+
+	p.GetLogger().Warn("PDU數據未通過驗證",
+		zap.String("device", device),
+		zap.String("profile", profile),
+		zap.String("action", action),
+		zap.String("reason", reason))
+
+	if p.quarantine != nil {
+		record := QuarantineRecord{
+			Time:         time.Now(),
+			Processor:    p.Name(),
+			Device:       device,
+			Manufacturer: manufacturer,
+			Model:        model,
+			Profile:      profile,
+			Action:       action,
+			Reason:       reason,
+			Violations:   violations,
+			Data:         *pdu,
+		}
+		if err := p.quarantine.Write(record); err != nil {
+			p.GetLogger().Error("寫入隔離區失敗", zap.String("device", device), zap.Error(err))
 		}
 	}
+	if action == ValidationFlag {
+		p.IncrementFlaggedCount(1)
+		return nil
+	}
+	p.IncrementQuarantinedCount(1)
+	return ErrQuarantined
+}
 
-	// 將相位添加到PDU數據
-	for _, phase := range phaseMap {
-		pdu.Phases = append(pdu.Phases, *phase)
+// recordUnmatched 記錄未能解析的字段，首次出現時記錄警告日誌
+func (p *PDUProcessor) recordUnmatched(pdu *models.PDUData, field, reason, manufacturer, model, profile string) {
+	if p.diagnostics.Record(field, reason, manufacturer, model, profile, energyDeviceKey(pdu)) {
+		p.GetLogger().Warn("無法解析PDU字段",
+			zap.String("field", field),
+			zap.String("reason", reason),
+			zap.String("manufacturer", manufacturer),
+			zap.String("model", model),
+			zap.String("profile", profile))
 	}
 }
 
-// getFieldValue 獲取字段值，先嘗試指定的字段名，再試通用名稱
-func getFieldValue(fields map[string]float64, specificField, genericName string) (float64, bool) {
-	if specificField != "" {
-		if value, ok := fields[specificField]; ok {
-			return value, true
-		}
+// UnmatchedFields 返回無法解析的字段及因超過上限未記錄的次數
+func (p *PDUProcessor) UnmatchedFields() ([]UnmatchedField, int64) {
+	return p.diagnostics.List()
+}
+
+// ResetFieldDiagnostics 清除字段診斷記錄
+func (p *PDUProcessor) ResetFieldDiagnostics() {
+	p.diagnostics.Reset()
+}
+
+// assignQuantity 將數值寫入對應物理量
+func assignQuantity(quantity string, value float64, current, voltage, power, energy *float64) {
+	switch quantity {
+	case "current":
+		*current = value
+	case "voltage":
+		*voltage = value
+	case "power":
+		*power = value
+	case "energy":
+		*energy = value
 	}
+}
 
-	for field, value := range fields {
-		if strings.Contains(field, genericName) && !strings.Contains(field, "branch") && !strings.Contains(field, "phase") {
-			return value, true
+// scaleForQuantity 返回物理量對應的比例因子
+func scaleForQuantity(scale models.PDUScale, quantity string) float64 {
+	switch quantity {
+	case "current":
+		return scale.Current
+	case "voltage":
+		return scale.Voltage
+	case "power":
+		return scale.Power
+	case "energy":
+		return scale.Energy
+	case "temperature":
+		return scaleOrOne(scale.Temperature)
+	case "humidity":
+		return scaleOrOne(scale.Humidity)
+	}
+	return 1.0
+}
+
+// computeEnergyDeltas 以各能耗計數器的上次讀數計算總體、分支、相位與插座的能耗增量
+func (p *PDUProcessor) computeEnergyDeltas(pdu *models.PDUData, handler models.PDUManufacturerHandler, scale models.PDUScale) {
+	bits := p.counterBits
+	if h, ok := handler.(interface{ CounterBits() int }); ok && h.CounterBits() > 0 {
+		bits = h.CounterBits()
+	}
+	modulus := counterModulus(bits, scale.Energy)
+	device := energyDeviceKey(pdu)
+
+	delta := func(scope string, value float64) float64 {
+		// 沒有讀數的計數器不參與計算
+		if value == 0 {
+			return 0
 		}
+		d, result := p.energy.Delta(device+"/"+scope, value, pdu.Timestamp, modulus)
+		switch result {
+		case CounterWrapped:
+			p.GetLogger().Info("能耗計數器溢位",
+				zap.String("device", device),
+				zap.String("scope", scope),
+				zap.Float64("value", value))
+		case CounterReset:
+			p.GetLogger().Warn("能耗計數器已重置",
+				zap.String("device", device),
+				zap.String("scope", scope),
+				zap.Float64("value", value))
+		case CounterStale:
+			p.GetLogger().Debug("忽略過時的能耗讀數",
+				zap.String("device", device),
+				zap.String("scope", scope),
+				zap.Time("timestamp", pdu.Timestamp))
+		}
+		return d
 	}
 
-	return 0, false
+	pdu.EnergyDelta = delta("total", pdu.Energy)
+	for i := range pdu.Branches {
+		pdu.Branches[i].EnergyDelta = delta("branch/"+pdu.Branches[i].ID, pdu.Branches[i].Energy)
+	}
+	for i := range pdu.Phases {
+		pdu.Phases[i].EnergyDelta = delta("phase/"+pdu.Phases[i].ID, pdu.Phases[i].Energy)
+	}
+	for i := range pdu.Outlets {
+		pdu.Outlets[i].EnergyDelta = delta("outlet/"+pdu.Outlets[i].ID, pdu.Outlets[i].Energy)
+	}
 }
 
-// extractIDFromField 從字段名提取ID
-func extractIDFromField(fieldName, prefix string) string {
-	prefixPattern := prefix + "_"
-	if !strings.Contains(fieldName, prefixPattern) {
-		prefixPattern = prefix
+// energyDeviceKey 能耗計數器的設備識別：優先使用 device 標籤，其次為 ip 標籤，最後為名稱
+func energyDeviceKey(pdu *models.PDUData) string {
+	if device := pdu.Tags["device"]; device != "" {
+		return device
 	}
+	if ip := pdu.Tags["ip"]; ip != "" {
+		return ip
+	}
+	return pdu.Name
+}
 
-	parts := strings.Split(fieldName, prefixPattern)
-	if len(parts) <= 1 {
-		return ""
+// Latest 返回各設備最近一次處理的數據，依設備排序
+func (p *PDUProcessor) Latest() []models.PDUData {
+	p.latestMutex.RLock()
+	defer p.latestMutex.RUnlock()
+
+	devices := make([]string, 0, len(p.latest))
+	for device := range p.latest {
+		devices = append(devices, device)
 	}
+	sort.Strings(devices)
 
-	idPart := parts[1]
-	if idx := strings.Index(idPart, "_"); idx > 0 {
-		return idPart[:idx]
+	result := make([]models.PDUData, 0, len(devices))
+	for _, device := range devices {
+		result = append(result, p.latest[device])
 	}
-	return idPart
+	return result
+}
+
+// LatestFor 返回指定設備最近一次處理的數據
+func (p *PDUProcessor) LatestFor(device string) (models.PDUData, bool) {
+	p.latestMutex.RLock()
+	defer p.latestMutex.RUnlock()
+	pdu, ok := p.latest[device]
+	return pdu, ok
+}
+
+// EnergyStats 返回能耗計數器統計
+func (p *PDUProcessor) EnergyStats() EnergyCounterStats {
+	return p.energy.Stats()
 }
 
 // getScaleForManufacturer 獲取製造商對應的比例因子
@@ -439,85 +857,55 @@ func (p *PDUProcessor) getScaleForManufacturer(manufacturer string) models.PDUSc
 	}
 }
 
-// detectPDUTypeFromFields 嘗試從字段檢測PDU型號
-func (p *PDUProcessor) detectPDUTypeFromFields(point models.PDUPoint) string {
-	// 根據字段模式檢測型號
-	hasL1 := false
-	hasL2 := false
-	hasL3 := false
-	hasBranch := false
+// detectPDUTypeFromFields 無型號標籤時以描述檔的 detect 條件檢測型號，條件較多的描述檔優先
+func (p *PDUProcessor) detectPDUTypeFromFields(manufacturer string, point models.PDUPoint) string {
+	p.handlerMutex.RLock()
+	defer p.handlerMutex.RUnlock()
 
-	for field := range point.Fields {
-		if strings.Contains(field, "L1") {
-			hasL1 = true
-		}
-		if strings.Contains(field, "L2") {
-			hasL2 = true
-		}
-		if strings.Contains(field, "L3") {
-			hasL3 = true
+	var detected *ProfileHandler
+	for _, h := range p.profiles {
+		if !h.Detect(manufacturer, point.Fields) {
+			continue
 		}
-		if strings.Contains(field, "branch") {
-			hasBranch = true
+		if detected == nil || len(h.profile.Match.Detect) > len(detected.profile.Match.Detect) {
+			detected = h
 		}
 	}
-
-	// 基於字段特性推斷型號
-	if hasBranch && hasL1 && hasL2 && hasL3 {
-		return "pdue428" // Delta PDU E428
-	} else if hasL1 && hasL2 && hasL3 {
-		return "pdu1315" // Delta PDU 1315
+	if detected == nil {
+		return "unknown"
 	}
-
-	return "unknown"
+	return detected.DetectedModel()
 }
 
-// registerDefaultHandlers 註冊默認處理程序
-func (p *PDUProcessor) registerDefaultHandlers() {
-	// 註冊Delta處理程序
-	deltaScale := models.PDUScale{
-		Manufacturer: "delta",
-		Current:      0.1,   // 10分之1安培
-		Voltage:      0.1,   // 10分之1伏特
-		Power:        1.0,   // 瓦特
-		Energy:       0.001, // 千瓦時
-	}
-
-	// Delta PDU4425 (Modbus)
-	p.RegisterHandler("delta", "pdu4425", &DeltaPDUHandler{
-		scale:     deltaScale,
-		modelType: "PDU4425",
-		slaveID:   1,
-	})
-
-	// Delta PDU1315 (Modbus)
-	p.RegisterHandler("delta", "pdu1315", &DeltaPDUHandler{
-		scale:     deltaScale,
-		modelType: "PDU1315",
-		slaveID:   1,
-	})
+// resolveHandler 選擇處理程序：匹配程度最高的描述檔優先，其次為程式註冊的處理程序，最後為默認處理程序
+func (p *PDUProcessor) resolveHandler(manufacturer, model string) models.PDUManufacturerHandler {
+	p.handlerMutex.RLock()
+	defer p.handlerMutex.RUnlock()
 
-	// Delta PDUE428 (SNMP)
-	p.RegisterHandler("delta", "pdue428", &DeltaPDUHandler{
-		scale:     deltaScale,
-		modelType: "PDUE428",
-		slaveID:   0,
-	})
+	var best *ProfileHandler
+	bestScore := 0
+	for _, h := range p.profiles {
+		if score := h.matchScore(manufacturer, model); score > bestScore {
+			best, bestScore = h, score
+		}
+	}
+	if best != nil {
+		return best
+	}
 
-	// 註冊Vertiv處理程序
-	vertivScale := models.PDUScale{
-		Manufacturer: "vertiv",
-		Current:      0.1,   // 10分之1安培
-		Voltage:      0.1,   // 10分之1伏特
-		Power:        1.0,   // 瓦特
-		Energy:       0.001, // 千瓦時
+	// 嘗試獲取指定製造商和型號的處理程序
+	if manufHandlers, ok := p.handlers[manufacturer]; ok {
+		if h, ok := manufHandlers[model]; ok {
+			return h
+		} else if h, ok := manufHandlers["default"]; ok {
+			return h
+		}
 	}
 
-	// Vertiv 6PS56 (SNMP)
-	p.RegisterHandler("vertiv", "6ps56", &VertivPDUHandler{
-		scale:     vertivScale,
-		modelType: "6PS56",
-	})
+	// 如果沒有找到，使用默認處理程序
+	return &DefaultPDUHandler{
+		scale: p.getScaleForManufacturer(manufacturer),
+	}
 }
 
 // DefaultPDUHandler 默認PDU處理程序
@@ -541,108 +929,6 @@ func (h *DefaultPDUHandler) GetScaleFactor() models.PDUScale {
 	return h.scale
 }
 
-// DeltaPDUHandler Delta PDU處理程序
-type DeltaPDUHandler struct {
-	scale     models.PDUScale
-	modelType string
-	slaveID   int
-}
-
-// CanHandle 檢查是否可以處理
-func (h *DeltaPDUHandler) CanHandle(manufacturer, model string) bool {
-	return strings.EqualFold(manufacturer, "delta")
-}
-
-// ProcessFields 處理Delta PDU字段
-func (h *DeltaPDUHandler) ProcessFields(point models.PDUPoint) (map[string]float64, error) {
-	fields := convertToFloat64Map(point.Fields)
-
-	// 檢查slave_id是否匹配（如果有設置）
-	if h.slaveID != 0 {
-		if slaveIDStr, exists := point.Tags["slave_id"]; exists {
-			slaveID, err := strconv.Atoi(slaveIDStr)
-			if err == nil && slaveID != h.slaveID {
-				return fields, fmt.Errorf("slave_id不匹配: 期望 %d, 實際 %d", h.slaveID, slaveID)
-			}
-		}
-	}
-
-	// 根據不同型號進行特殊處理
-	switch h.modelType {
-	case "PDU4425":
-		requiredFields := []string{
-			"current_L1", "current_L2", "current_L3",
-			"voltage_L1", "voltage_L2", "voltage_L3",
-			"power_L1", "power_L2", "power_L3",
-		}
-		if !checkRequiredFields(fields, requiredFields) {
-			return fields, fmt.Errorf("delta pdu4425 缺少必需字段")
-		}
-
-	case "PDU1315":
-		requiredFields := []string{
-			"current_L1", "current_L2", "current_L3",
-			"voltage_L1", "voltage_L2", "voltage_L3",
-		}
-		if !checkRequiredFields(fields, requiredFields) {
-			return fields, fmt.Errorf("delta pdu1315 缺少必需字段")
-		}
-
-	case "PDUE428":
-		requiredFields := []string{
-			"current_L1", "current_L2", "current_L3",
-			"voltage_L1", "voltage_L2", "voltage_L3",
-			"power_L1", "power_L2", "power_L3",
-		}
-		if !checkRequiredFields(fields, requiredFields) {
-			return fields, fmt.Errorf("delta pdue428 缺少必需字段")
-		}
-	}
-
-	return fields, nil
-}
-
-// GetScaleFactor 獲取比例因子
-func (h *DeltaPDUHandler) GetScaleFactor() models.PDUScale {
-	return h.scale
-}
-
-// VertivPDUHandler Vertiv PDU處理程序
-type VertivPDUHandler struct {
-	scale     models.PDUScale
-	modelType string
-}
-
-// CanHandle 檢查是否可以處理
-func (h *VertivPDUHandler) CanHandle(manufacturer, model string) bool {
-	return strings.EqualFold(manufacturer, "vertiv")
-}
-
-// ProcessFields 處理Vertiv PDU字段
-func (h *VertivPDUHandler) ProcessFields(point models.PDUPoint) (map[string]float64, error) {
-	fields := convertToFloat64Map(point.Fields)
-
-	switch h.modelType {
-	case "6PS56":
-		requiredFields := []string{
-			"current_L1", "current_L2", "current_L3",
-			"voltage_L1", "voltage_L2", "voltage_L3",
-			"power_L1", "power_L2", "power_L3",
-			"energy_L1", "energy_L2", "energy_L3",
-		}
-		if !checkRequiredFields(fields, requiredFields) {
-			return fields, fmt.Errorf("vertiv 6ps56 缺少必需字段")
-		}
-	}
-
-	return fields, nil
-}
-
-// GetScaleFactor 獲取比例因子
-func (h *VertivPDUHandler) GetScaleFactor() models.PDUScale {
-	return h.scale
-}
-
 // 將interface{}類型的map轉換為float64類型的map
 func convertToFloat64Map(fields map[string]interface{}) map[string]float64 {
 	result := make(map[string]float64)
@@ -665,24 +951,16 @@ func convertToFloat64Map(fields map[string]interface{}) map[string]float64 {
 	return result
 }
 
-// 檢查是否包含所有必需字段
-func checkRequiredFields(fields map[string]float64, requiredFields []string) bool {
-	for _, field := range requiredFields {
-		if _, ok := fields[field]; !ok {
-			return false
-		}
-	}
-	return true
-}
-
 // GetStatus 獲取處理器狀態
 func (p *PDUProcessor) GetStatus() models.ProcessorStatus {
 	return models.ProcessorStatus{
-		Running:        p.IsRunning(),
-		StartTime:      p.GetLastProcessTime(),
-		ProcessedCount: p.GetProcessedCount(),
-		ErrorCount:     p.GetErrorCount(),
-		LastError:      p.GetLastError(),
+		Running:          p.IsRunning(),
+		StartTime:        p.GetLastProcessTime(),
+		ProcessedCount:   p.GetProcessedCount(),
+		ErrorCount:       p.GetErrorCount(),
+		LastError:        p.GetLastError(),
+		QuarantinedCount: p.GetQuarantinedCount(),
+		FlaggedCount:     p.GetFlaggedCount(),
 	}
 }
 
@@ -732,6 +1010,14 @@ func (p *PDUProcessor) HandlePDUData(ctx context.Context, data []models.PDUData)
 		device.Fields["voltage"] = pdu.Voltage
 		device.Fields["power"] = pdu.Power
 		device.Fields["energy"] = pdu.Energy
+		device.Fields["energy_delta"] = pdu.EnergyDelta
+		device.Fields["apparent_power"] = pdu.ApparentPower
+		device.Fields["power_factor"] = pdu.PowerFactor
+		device.Fields["current_imbalance"] = pdu.CurrentImbalance
+		device.Fields["neutral_current"] = pdu.NeutralCurrent
+		for field, value := range pdu.Fields {
+			device.Fields[field] = value
+		}
 
 		// 添加分支數據
 		for _, branch := range pdu.Branches {
@@ -740,6 +1026,7 @@ func (p *PDUProcessor) HandlePDUData(ctx context.Context, data []models.PDUData)
 			device.Fields[prefix+"voltage"] = branch.Voltage
 			device.Fields[prefix+"power"] = branch.Power
 			device.Fields[prefix+"energy"] = branch.Energy
+			device.Fields[prefix+"energy_delta"] = branch.EnergyDelta
 		}
 
 		// 添加相位數據
@@ -749,6 +1036,31 @@ func (p *PDUProcessor) HandlePDUData(ctx context.Context, data []models.PDUData)
 			device.Fields[prefix+"voltage"] = phase.Voltage
 			device.Fields[prefix+"power"] = phase.Power
 			device.Fields[prefix+"energy"] = phase.Energy
+			device.Fields[prefix+"energy_delta"] = phase.EnergyDelta
+			device.Fields[prefix+"apparent_power"] = phase.ApparentPower
+			device.Fields[prefix+"power_factor"] = phase.PowerFactor
+			device.Fields[prefix+"line_voltage"] = phase.LineVoltage
+		}
+
+		// 添加插座數據
+		for _, outlet := range pdu.Outlets {
+			prefix := fmt.Sprintf("outlet_%s_", outlet.ID)
+			device.Fields[prefix+"current"] = outlet.Current
+			device.Fields[prefix+"voltage"] = outlet.Voltage
+			device.Fields[prefix+"power"] = outlet.Power
+			device.Fields[prefix+"energy"] = outlet.Energy
+			device.Fields[prefix+"energy_delta"] = outlet.EnergyDelta
+			switch outlet.State {
+			case "on":
+				device.Fields[prefix+"state"] = 1
+			case "off":
+				device.Fields[prefix+"state"] = 0
+			}
+		}
+
+		// 添加環境探頭數據
+		for _, probe := range pdu.Environment {
+			device.Fields[fmt.Sprintf("env_%s_%s", probe.ID, probe.Type)] = probe.Value
 		}
 
 		deviceData = append(deviceData, device)
@@ -765,5 +1077,60 @@ var _ models.Processor = (*PDUProcessor)(nil)
 func (p *PDUProcessor) Start(ctx context.Context) error {
 	p.BaseProcessor.SetRunning(true)
 	p.BaseProcessor.SetLastProcessTime(time.Now())
+
+	if p.assembler != nil {
+		ctx, p.cancel = context.WithCancel(ctx)
+		go p.flushSnapshots(ctx)
+	}
 	return nil
 }
+
+// flushSnapshots 定期處理收集窗口已結束的快照
+func (p *PDUProcessor) flushSnapshots(ctx context.Context) {
+	ticker := time.NewTicker(p.assembler.Window() / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if points := p.assembler.Expired(now); len(points) > 0 {
+				p.processPoints(ctx, points)
+			}
+		}
+	}
+}
+
+// SnapshotStats 返回快照組裝統計，未啟用快照組裝時返回 false
+func (p *PDUProcessor) SnapshotStats() (SnapshotStats, bool) {
+	if p.assembler == nil {
+		return SnapshotStats{}, false
+	}
+	return p.assembler.Stats(), true
+}
+
+// RegistryStats 返回註冊表標籤補充統計，未設置註冊表時返回 false
+func (p *PDUProcessor) RegistryStats() (RegistryStats, bool) {
+	if p.registry == nil {
+		return RegistryStats{}, false
+	}
+	return p.registry.Stats(), true
+}
+
+// Stop 停止處理器，處理收集中的快照並保存能耗計數器狀態
+func (p *PDUProcessor) Stop() error {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	if p.assembler != nil {
+		if points := p.assembler.Flush(); len(points) > 0 {
+			p.processPoints(context.Background(), points)
+		}
+	}
+
+	if err := p.energy.Save(); err != nil {
+		p.GetLogger().Error("保存能耗計數器狀態失敗", zap.Error(err))
+	}
+	return p.BaseProcessor.Stop()
+}
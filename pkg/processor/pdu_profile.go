@@ -0,0 +1,334 @@
+package processor
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"viot/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultProfiles 內建的 PDU 型號描述檔，可被描述檔目錄中的同名描述檔覆蓋
+//
+//go:embed profiles/*.yaml
+var defaultProfiles embed.FS
+
+// pduQuantities 命名模式中 {quantity} 可匹配的物理量及其標準名稱
+var pduQuantities = map[string]string{
+	"current": "current",
+	"voltage": "voltage",
+	"power":   "power",
+	"watt":    "power",
+	"energy":  "energy",
+	"state":   "state",
+
+	"temperature": "temperature",
+	"temp":        "temperature",
+	"humidity":    "humidity",
+	"door":        "door",
+}
+
+// envQuantities 環境探頭的物理量
+var envQuantities = map[string]bool{
+	"temperature": true,
+	"humidity":    true,
+	"door":        true,
+}
+
+// ProfileHandler 由 YAML 描述檔驅動的 PDU 處理程序
+// 依描述檔更名字段、檢查必需字段，並以字段語法將總體、相位、分支、插座與環境探頭字段轉換為標準名稱
+// (current、phase_<id>_<quantity>、branch_<id>_<quantity>、outlet_<id>_<quantity>、env_<id>_<quantity>)
+type ProfileHandler struct {
+	profile models.PDUProfile
+	source  string
+	scale   models.PDUScale
+	grammar *FieldGrammar
+}
+
+// NewProfileHandler 根據描述檔創建處理程序
+func NewProfileHandler(profile models.PDUProfile, source string) (*ProfileHandler, error) {
+	if profile.Match.Manufacturer == "" {
+		return nil, fmt.Errorf("描述檔 %s 缺少 match.manufacturer", profile.Name)
+	}
+
+	h := &ProfileHandler{
+		profile: profile,
+		source:  source,
+		scale: models.PDUScale{
+			Manufacturer: strings.ToLower(profile.Match.Manufacturer),
+			Current:      scaleOrOne(profile.Scale.Current),
+			Voltage:      scaleOrOne(profile.Scale.Voltage),
+			Power:        scaleOrOne(profile.Scale.Power),
+			Energy:       scaleOrOne(profile.Scale.Energy),
+			Temperature:  scaleOrOne(profile.Scale.Temperature),
+			Humidity:     scaleOrOne(profile.Scale.Humidity),
+		},
+	}
+
+	grammar, err := NewFieldGrammar(profileFieldRules(profile))
+	if err != nil {
+		return nil, fmt.Errorf("描述檔 %s 的字段規則無效: %w", profile.Name, err)
+	}
+	h.grammar = grammar
+
+	return h, nil
+}
+
+// profileFieldRules 依序組合描述檔的 fields、totals、branches、phases、outlets 與 env 為字段規則
+func profileFieldRules(profile models.PDUProfile) []models.PDUFieldRule {
+	rules := append([]models.PDUFieldRule{}, profile.Fields...)
+
+	quantities := make([]string, 0, len(profile.Totals))
+	for quantity := range profile.Totals {
+		quantities = append(quantities, quantity)
+	}
+	sort.Strings(quantities)
+	for _, quantity := range quantities {
+		rules = append(rules, models.PDUFieldRule{
+			Scope:    string(ScopeTotal),
+			Regex:    "^" + regexp.QuoteMeta(profile.Totals[quantity]) + "$",
+			Quantity: quantity,
+		})
+	}
+
+	if profile.Branches != "" {
+		rules = append(rules, models.PDUFieldRule{Scope: string(ScopeBranch), Pattern: profile.Branches})
+	}
+	if profile.Phases != "" {
+		rules = append(rules, models.PDUFieldRule{Scope: string(ScopePhase), Pattern: profile.Phases})
+	}
+	if profile.Outlets != "" {
+		rules = append(rules, models.PDUFieldRule{Scope: string(ScopeOutlet), Pattern: profile.Outlets})
+	}
+	if profile.Env != "" {
+		rules = append(rules, models.PDUFieldRule{Scope: string(ScopeEnv), Pattern: profile.Env})
+	}
+	return rules
+}
+
+// Profile 返回描述檔內容
+func (h *ProfileHandler) Profile() models.PDUProfile {
+	return h.profile
+}
+
+// Source 返回描述檔來源
+func (h *ProfileHandler) Source() string {
+	return h.source
+}
+
+// CanHandle 檢查是否可以處理
+func (h *ProfileHandler) CanHandle(manufacturer, model string) bool {
+	return h.matchScore(manufacturer, model) > 0
+}
+
+// matchScore 計算匹配程度：型號完全匹配為 3，萬用字元匹配為 2，未限制型號為 1，不匹配為 0
+func (h *ProfileHandler) matchScore(manufacturer, model string) int {
+	if !matchPattern(h.profile.Match.Manufacturer, manufacturer) {
+		return 0
+	}
+	if len(h.profile.Match.Models) == 0 {
+		return 1
+	}
+
+	score := 0
+	for _, pattern := range h.profile.Match.Models {
+		switch {
+		case strings.EqualFold(pattern, model):
+			return 3
+		case matchPattern(pattern, model):
+			score = 2
+		}
+	}
+	return score
+}
+
+// Detect 無型號標籤時，以字段名片段判斷是否為此型號
+// 製造商標籤缺失（為空或 "unknown"）時只依字段名片段判斷
+func (h *ProfileHandler) Detect(manufacturer string, fields map[string]interface{}) bool {
+	if len(h.profile.Match.Detect) == 0 {
+		return false
+	}
+	if manufacturer != "" && !strings.EqualFold(manufacturer, "unknown") &&
+		!matchPattern(h.profile.Match.Manufacturer, manufacturer) {
+		return false
+	}
+
+	for _, fragment := range h.profile.Match.Detect {
+		found := false
+		for field := range fields {
+			if strings.Contains(field, fragment) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// DetectedModel 識別成功時回報的型號
+func (h *ProfileHandler) DetectedModel() string {
+	if len(h.profile.Match.Models) > 0 {
+		return strings.ToLower(h.profile.Match.Models[0])
+	}
+	return strings.ToLower(h.profile.Name)
+}
+
+// ProcessFields 依描述檔處理字段
+func (h *ProfileHandler) ProcessFields(point models.PDUPoint) (map[string]float64, error) {
+	fields := convertToFloat64Map(point.Fields)
+
+	// 檢查slave_id是否匹配（如果有設置）
+	if h.profile.SlaveID != 0 {
+		if slaveIDStr, exists := point.Tags["slave_id"]; exists {
+			slaveID, err := strconv.Atoi(slaveIDStr)
+			if err == nil && slaveID != h.profile.SlaveID {
+				return fields, fmt.Errorf("slave_id不匹配: 期望 %d, 實際 %d", h.profile.SlaveID, slaveID)
+			}
+		}
+	}
+
+	for from, to := range h.profile.Rename {
+		if value, ok := fields[from]; ok {
+			delete(fields, from)
+			fields[to] = value
+		}
+	}
+
+	var missing []string
+	for _, field := range h.profile.RequiredFields {
+		if _, ok := fields[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+
+	result := h.normalize(fields)
+	if len(missing) > 0 {
+		return result, fmt.Errorf("%s 缺少必需字段: %s", h.profile.Name, strings.Join(missing, ", "))
+	}
+	return result, nil
+}
+
+// normalize 將符合字段語法的字段轉換為標準名稱，其餘字段保持不變
+func (h *ProfileHandler) normalize(fields map[string]float64) map[string]float64 {
+	result := make(map[string]float64, len(fields))
+	for field, value := range fields {
+		if name, ok := h.grammar.Parse(field); ok {
+			result[name.Canonical()] = value
+			continue
+		}
+		result[field] = value
+	}
+	return result
+}
+
+// FieldGrammar 返回描述檔的字段語法
+func (h *ProfileHandler) FieldGrammar() *FieldGrammar {
+	return h.grammar
+}
+
+// GetScaleFactor 獲取比例因子
+func (h *ProfileHandler) GetScaleFactor() models.PDUScale {
+	return h.scale
+}
+
+// CounterBits 能耗計數器位寬，0 表示使用處理器設置
+func (h *ProfileHandler) CounterBits() int {
+	return h.profile.CounterBits
+}
+
+// matchPattern 不區分大小寫的萬用字元匹配
+func matchPattern(pattern, value string) bool {
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return err == nil && ok
+}
+
+// scaleOrOne 未設置的比例因子視為 1
+func scaleOrOne(scale float64) float64 {
+	if scale == 0 {
+		return 1.0
+	}
+	return scale
+}
+
+// LoadPDUProfiles 載入內建描述檔，再以 dir 中的描述檔覆蓋同名描述檔；dir 為空時只載入內建描述檔
+func LoadPDUProfiles(dir string) ([]*ProfileHandler, error) {
+	profiles := make(map[string]*ProfileHandler)
+	var order []string
+
+	add := func(handlers []*ProfileHandler) {
+		for _, h := range handlers {
+			if _, exists := profiles[h.profile.Name]; !exists {
+				order = append(order, h.profile.Name)
+			}
+			profiles[h.profile.Name] = h
+		}
+	}
+
+	builtin, err := loadProfilesFS(defaultProfiles, "profiles", "builtin:")
+	if err != nil {
+		return nil, err
+	}
+	add(builtin)
+
+	if dir != "" {
+		custom, err := loadProfilesFS(os.DirFS(dir), ".", dir+string(filepath.Separator))
+		if err != nil {
+			return nil, err
+		}
+		add(custom)
+	}
+
+	handlers := make([]*ProfileHandler, 0, len(order))
+	for _, name := range order {
+		handlers = append(handlers, profiles[name])
+	}
+	return handlers, nil
+}
+
+// loadProfilesFS 讀取目錄中所有 .yaml/.yml 描述檔，描述檔名稱未設置時使用文件名
+func loadProfilesFS(fsys fs.FS, dir, prefix string) ([]*ProfileHandler, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("讀取描述檔目錄失敗: %w", err)
+	}
+
+	var handlers []*ProfileHandler
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("讀取描述檔 %s 失敗: %w", entry.Name(), err)
+		}
+
+		var profile models.PDUProfile
+		if err := yaml.Unmarshal(data, &profile); err != nil {
+			return nil, fmt.Errorf("解析描述檔 %s 失敗: %w", entry.Name(), err)
+		}
+		if profile.Name == "" {
+			profile.Name = strings.TrimSuffix(entry.Name(), ext)
+		}
+
+		h, err := NewProfileHandler(profile, prefix+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, h)
+	}
+	return handlers, nil
+}
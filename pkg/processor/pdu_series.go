@@ -0,0 +1,129 @@
+package processor
+
+import (
+	"time"
+
+	"viot/models"
+)
+
+// PDUSeries 寫入時序資料庫的單個數據點
+type PDUSeries struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+// SplitPDUData 將 PDU 數據拆分為總體、相位、分支、插座與環境探頭序列
+// 總體寫入 measurement，其餘分別寫入 <measurement>_phase、<measurement>_branch、<measurement>_outlet，並以 phase_id、branch、outlet 標籤區分
+// （phase 為設備註冊表附加的位置標籤，相位以 phase_id 區分，與 Prometheus 輸出相同）；
+// 環境探頭寫入 <measurement>_env，以 probe、type、unit 標籤區分
+func SplitPDUData(pdu models.PDUData, measurement string) []PDUSeries {
+	series := make([]PDUSeries, 0, 1+len(pdu.Phases)+len(pdu.Branches)+len(pdu.Outlets)+len(pdu.Environment))
+
+	series = append(series, PDUSeries{
+		Measurement: measurement,
+		Tags:        seriesTags(pdu.Tags, "", ""),
+		Fields: map[string]interface{}{
+			"current":           pdu.Current,
+			"voltage":           pdu.Voltage,
+			"power":             pdu.Power,
+			"energy":            pdu.Energy,
+			"energy_delta":      pdu.EnergyDelta,
+			"apparent_power":    pdu.ApparentPower,
+			"power_factor":      pdu.PowerFactor,
+			"current_imbalance": pdu.CurrentImbalance,
+			"neutral_current":   pdu.NeutralCurrent,
+		},
+		Time: pdu.Timestamp,
+	})
+	for field, value := range pdu.Fields {
+		series[0].Fields[field] = value
+	}
+
+	for _, phase := range pdu.Phases {
+		series = append(series, PDUSeries{
+			Measurement: measurement + "_phase",
+			Tags:        seriesTags(pdu.Tags, "phase_id", phase.ID),
+			Fields: map[string]interface{}{
+				"current":        phase.Current,
+				"voltage":        phase.Voltage,
+				"power":          phase.Power,
+				"energy":         phase.Energy,
+				"energy_delta":   phase.EnergyDelta,
+				"apparent_power": phase.ApparentPower,
+				"power_factor":   phase.PowerFactor,
+				"line_voltage":   phase.LineVoltage,
+			},
+			Time: pdu.Timestamp,
+		})
+	}
+
+	for _, branch := range pdu.Branches {
+		series = append(series, PDUSeries{
+			Measurement: measurement + "_branch",
+			Tags:        seriesTags(pdu.Tags, "branch", branch.ID),
+			Fields: map[string]interface{}{
+				"current":      branch.Current,
+				"voltage":      branch.Voltage,
+				"power":        branch.Power,
+				"energy":       branch.Energy,
+				"energy_delta": branch.EnergyDelta,
+			},
+			Time: pdu.Timestamp,
+		})
+	}
+
+	for _, outlet := range pdu.Outlets {
+		fields := map[string]interface{}{
+			"current":      outlet.Current,
+			"voltage":      outlet.Voltage,
+			"power":        outlet.Power,
+			"energy":       outlet.Energy,
+			"energy_delta": outlet.EnergyDelta,
+		}
+		if outlet.State != "" {
+			fields["state"] = outlet.State
+		}
+		series = append(series, PDUSeries{
+			Measurement: measurement + "_outlet",
+			Tags:        seriesTags(pdu.Tags, "outlet", outlet.ID),
+			Fields:      fields,
+			Time:        pdu.Timestamp,
+		})
+	}
+
+	for _, probe := range pdu.Environment {
+		tags := seriesTags(pdu.Tags, "probe", probe.ID)
+		tags["type"] = probe.Type
+		if probe.Unit != "" {
+			tags["unit"] = probe.Unit
+		}
+		fields := map[string]interface{}{
+			"value": probe.Value,
+		}
+		if probe.State != "" {
+			fields["state"] = probe.State
+		}
+		series = append(series, PDUSeries{
+			Measurement: measurement + "_env",
+			Tags:        tags,
+			Fields:      fields,
+			Time:        pdu.Timestamp,
+		})
+	}
+
+	return series
+}
+
+// seriesTags 複製 PDU 標籤並加上層級標籤
+func seriesTags(tags map[string]string, key, value string) map[string]string {
+	result := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		result[k] = v
+	}
+	if key != "" {
+		result[key] = value
+	}
+	return result
+}
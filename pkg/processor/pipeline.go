@@ -0,0 +1,377 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"viot/logger"
+	"viot/models"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// StageIngest 接收階段類型，由 PDU 處理器將原始數據點轉換為 PDU 數據，由處理器管理器創建
+const StageIngest = "ingest"
+
+// 管線階段的執行順序，配置中的階段須依此順序排列，同一順序的階段可以有多個
+const (
+	phaseIngest = iota
+	phaseEnrich
+	phaseValidate
+	phaseTransform
+	phaseAggregate
+	phaseOutput
+)
+
+// stagePhases 內建階段類型的順序；未列出的類型（如 cel 與自行註冊的類型）可位於 ingest 與 output 之間的任何位置
+var stagePhases = map[string]int{
+	StageIngest: phaseIngest,
+	"enrich":    phaseEnrich,
+	"tags":      phaseEnrich,
+	"validate":  phaseValidate,
+	"transform": phaseTransform,
+	"aggregate": phaseAggregate,
+	"output":    phaseOutput,
+}
+
+// PipelineConfig 處理管線配置，階段依列出的順序執行
+type PipelineConfig struct {
+	Stages []StageConfig `yaml:"stages" json:"stages"`
+}
+
+// StageConfig 管線階段配置
+type StageConfig struct {
+	Name    string                 `yaml:"name" json:"name"`
+	Type    string                 `yaml:"type" json:"type"`
+	Enabled *bool                  `yaml:"enabled" json:"enabled,omitempty"` // 未設置時啟用
+	Options map[string]interface{} `yaml:"options" json:"options,omitempty"`
+}
+
+// IsEnabled 階段是否啟用
+func (c StageConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// LoadPipelineConfig 讀取並檢查管線配置文件
+func LoadPipelineConfig(path string) (PipelineConfig, error) {
+	var config PipelineConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("讀取管線配置失敗: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("解析管線配置失敗: %w", err)
+	}
+
+	names := make(map[string]struct{}, len(config.Stages))
+	for i, stage := range config.Stages {
+		if stage.Name == "" {
+			return config, fmt.Errorf("第 %d 個階段缺少名稱", i+1)
+		}
+		if _, exists := names[stage.Name]; exists {
+			return config, fmt.Errorf("階段名稱 %s 重複", stage.Name)
+		}
+		names[stage.Name] = struct{}{}
+
+		if stage.Type == StageIngest {
+			continue
+		}
+		if _, ok := lookupStageType(stage.Type); !ok {
+			return config, fmt.Errorf("階段 %s 的類型 %q 未註冊", stage.Name, stage.Type)
+		}
+	}
+	if err := checkStageOrder(config.Stages); err != nil {
+		return config, err
+	}
+	if !hasOutputStage(config.Stages) {
+		return config, errors.New("管線沒有啟用的 output 階段，所有數據都不會輸出")
+	}
+	return config, nil
+}
+
+// hasOutputStage 檢查是否有啟用的 output 階段
+func hasOutputStage(stages []StageConfig) bool {
+	for _, stage := range stages {
+		if stage.Type == "output" && stage.IsEnabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStageOrder 檢查階段依 ingest → enrich → validate → transform → aggregate → output 的順序排列
+// ingest 階段的位置不影響執行（處理器的輸出總是從第一個階段開始），因此 ingest 須位於所有其他階段之前
+func checkStageOrder(stages []StageConfig) error {
+	last := phaseIngest
+	var previous StageConfig
+	for _, stage := range stages {
+		phase, ok := stagePhases[stage.Type]
+		if !ok {
+			// 未列出順序的類型至少位於 enrich，之後不能再出現 ingest
+			phase = last
+			if phase < phaseEnrich {
+				phase = phaseEnrich
+			}
+		}
+		if phase < last || (!ok && last == phaseOutput) {
+			return fmt.Errorf("階段 %s (%s) 不能位於階段 %s (%s) 之後，階段順序須為 ingest → enrich → validate → transform → aggregate → output",
+				stage.Name, stage.Type, previous.Name, previous.Type)
+		}
+		last = phase
+		previous = stage
+	}
+	return nil
+}
+
+// Stage 管線階段，處理一批 PDU 數據並返回交給下一階段的數據
+// 返回的數據可以少於輸入（如驗證丟棄、聚合），返回錯誤時整批數據停止傳遞
+type Stage interface {
+	Process(ctx context.Context, data []models.PDUData) ([]models.PDUData, error)
+}
+
+// evalErrorCounter 可選介面，階段對單筆數據處理失敗但不返回錯誤時實現，用於管線狀態
+type evalErrorCounter interface {
+	EvalErrors() int64
+}
+
+// StageFactory 根據階段配置創建階段
+type StageFactory func(config StageConfig, pipeline *Pipeline) (Stage, error)
+
+var (
+	stageTypes     = make(map[string]StageFactory)
+	stageTypeMutex sync.RWMutex
+)
+
+// RegisterStageType 註冊階段類型，配置中的 type 以此名稱創建階段
+func RegisterStageType(name string, factory StageFactory) {
+	stageTypeMutex.Lock()
+	defer stageTypeMutex.Unlock()
+	stageTypes[name] = factory
+}
+
+// lookupStageType 查找已註冊的階段類型
+func lookupStageType(name string) (StageFactory, bool) {
+	stageTypeMutex.RLock()
+	defer stageTypeMutex.RUnlock()
+	factory, ok := stageTypes[name]
+	return factory, ok
+}
+
+// StageMetrics 階段統計
+type StageMetrics struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Enabled     bool          `json:"enabled"`
+	In          int64         `json:"in"`      // 輸入的數據數
+	Out         int64         `json:"out"`     // 交給下一階段的數據數
+	Dropped     int64         `json:"dropped"` // 被丟棄或合併的數據數
+	Errors      int64         `json:"errors"`
+	EvalErrors  int64         `json:"eval_errors,omitempty"` // 單筆數據處理失敗但未中止整批的次數，如 CEL 表達式執行失敗
+	LastError   string        `json:"last_error,omitempty"`
+	LastRun     time.Time     `json:"last_run"`
+	AvgDuration time.Duration `json:"avg_duration"`
+
+	runs     int64
+	duration time.Duration
+}
+
+// record 記錄一次執行
+func (m *StageMetrics) record(in, out int, elapsed time.Duration, err error) {
+	m.runs++
+	m.duration += elapsed
+	m.AvgDuration = m.duration / time.Duration(m.runs)
+	m.LastRun = time.Now()
+	m.In += int64(in)
+	if err != nil {
+		m.Errors++
+		m.LastError = err.Error()
+		return
+	}
+	m.Out += int64(out)
+	if out < in {
+		m.Dropped += int64(in - out)
+	}
+}
+
+// pipelineStage 已創建的階段
+type pipelineStage struct {
+	config  StageConfig
+	stage   Stage
+	metrics *StageMetrics
+}
+
+// Pipeline 處理管線，PDU 處理器輸出的數據依序經過各階段，由 output 階段交給輸出路由器
+// Pipeline 實現 OutputRouter 介面，可直接設置為 PDU 處理器的輸出路由器
+type Pipeline struct {
+	stages  []*pipelineStage
+	metrics map[string]*StageMetrics
+	router  models.OutputRouter
+	mutex   sync.RWMutex
+	logger  logger.Logger
+}
+
+// NewPipeline 創建處理管線
+func NewPipeline(logger logger.Logger) *Pipeline {
+	return &Pipeline{
+		metrics: make(map[string]*StageMetrics),
+		logger:  logger.Named("pipeline"),
+	}
+}
+
+// Apply 依配置重建階段；任一階段創建失敗時保留原有階段
+// 名稱與類型不變的階段保留統計
+func (p *Pipeline) Apply(config PipelineConfig) error {
+	var stages []*pipelineStage
+	for _, stageConfig := range config.Stages {
+		if stageConfig.Type == StageIngest {
+			continue
+		}
+
+		built := &pipelineStage{config: stageConfig}
+		if stageConfig.IsEnabled() {
+			factory, ok := lookupStageType(stageConfig.Type)
+			if !ok {
+				return fmt.Errorf("階段 %s 的類型 %q 未註冊", stageConfig.Name, stageConfig.Type)
+			}
+			stage, err := factory(stageConfig, p)
+			if err != nil {
+				return fmt.Errorf("創建階段 %s 失敗: %w", stageConfig.Name, err)
+			}
+			built.stage = stage
+		}
+		stages = append(stages, built)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	metrics := make(map[string]*StageMetrics, len(stages))
+	for _, stage := range stages {
+		m, ok := p.metrics[stage.config.Name]
+		if !ok || m.Type != stage.config.Type {
+			m = &StageMetrics{Name: stage.config.Name, Type: stage.config.Type}
+		}
+		m.Enabled = stage.stage != nil
+		stage.metrics = m
+		metrics[stage.config.Name] = m
+	}
+
+	p.stages = stages
+	p.metrics = metrics
+	p.logger.Info("處理管線已套用", zap.Int("stages", len(stages)))
+	return nil
+}
+
+// SetRouter 設置 output 階段使用的輸出路由器
+func (p *Pipeline) SetRouter(router models.OutputRouter) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.router = router
+}
+
+// RegisterHandler 將輸出處理程序註冊到下游輸出路由器
+func (p *Pipeline) RegisterHandler(handler models.OutputHandler) error {
+	p.mutex.RLock()
+	router := p.router
+	p.mutex.RUnlock()
+
+	if router == nil {
+		return errors.New("處理管線尚未設置輸出路由器")
+	}
+	return router.RegisterHandler(handler)
+}
+
+// RoutePDUData 讓數據依序經過所有啟用的階段
+func (p *Pipeline) RoutePDUData(ctx context.Context, data ...interface{}) error {
+	var batch []models.PDUData
+	for _, item := range data {
+		switch v := item.(type) {
+		case models.PDUData:
+			batch = append(batch, v)
+		case []models.PDUData:
+			batch = append(batch, v...)
+		default:
+			p.logger.Warn("無法處理的PDU數據類型",
+				zap.String("type", fmt.Sprintf("%T", v)))
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	p.mutex.RLock()
+	stages := p.stages
+	p.mutex.RUnlock()
+
+	for _, stage := range stages {
+		if stage.stage == nil || len(batch) == 0 {
+			continue
+		}
+
+		start := time.Now()
+		out, err := stage.stage.Process(ctx, batch)
+
+		p.mutex.Lock()
+		stage.metrics.record(len(batch), len(out), time.Since(start), err)
+		p.mutex.Unlock()
+
+		if err != nil {
+			p.logger.Error("管線階段處理失敗",
+				zap.String("stage", stage.config.Name),
+				zap.String("type", stage.config.Type),
+				zap.Error(err))
+			return fmt.Errorf("階段 %s: %w", stage.config.Name, err)
+		}
+		batch = out
+	}
+	return nil
+}
+
+// route 將數據交給輸出路由器，供 output 階段使用
+func (p *Pipeline) route(ctx context.Context, data []models.PDUData) error {
+	p.mutex.RLock()
+	router := p.router
+	p.mutex.RUnlock()
+
+	if router == nil {
+		return errors.New("處理管線尚未設置輸出路由器")
+	}
+	return router.RoutePDUData(ctx, data)
+}
+
+// Stats 依執行順序返回各階段統計
+func (p *Pipeline) Stats() []StageMetrics {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	result := make([]StageMetrics, 0, len(p.stages))
+	for _, stage := range p.stages {
+		metrics := *stage.metrics
+		if counter, ok := stage.stage.(evalErrorCounter); ok {
+			metrics.EvalErrors = counter.EvalErrors()
+		}
+		result = append(result, metrics)
+	}
+	return result
+}
+
+// stageOptions 將階段選項以 yaml 轉換為結構
+func stageOptions(options map[string]interface{}, out interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+	data, err := yaml.Marshal(options)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("解析階段選項失敗: %w", err)
+	}
+	return nil
+}
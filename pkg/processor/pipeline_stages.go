@@ -0,0 +1,403 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"viot/models"
+
+	"go.uber.org/zap"
+)
+
+func init() {
+	RegisterStageType("tags", newTagsStage)
+	RegisterStageType("enrich", newTagsStage)
+	RegisterStageType("validate", newValidateStage)
+	RegisterStageType("transform", newTransformStage)
+	RegisterStageType("aggregate", newAggregateStage)
+	RegisterStageType("output", newOutputStage)
+}
+
+// copyTags 複製標籤，避免修改其他階段或最近讀數共用的標籤
+func copyTags(tags map[string]string) map[string]string {
+	result := make(map[string]string, len(tags))
+	for k, v := range tags {
+		result[k] = v
+	}
+	return result
+}
+
+// tagsStage 加上固定標籤，類型名稱為 tags 或 enrich
+type tagsStage struct {
+	Tags      map[string]string `yaml:"tags"`
+	Overwrite bool              `yaml:"overwrite"` // 是否覆蓋已存在的標籤
+}
+
+func newTagsStage(config StageConfig, _ *Pipeline) (Stage, error) {
+	s := &tagsStage{}
+	if err := stageOptions(config.Options, s); err != nil {
+		return nil, err
+	}
+	if len(s.Tags) == 0 {
+		return nil, fmt.Errorf("未設置 tags")
+	}
+	return s, nil
+}
+
+// Process 加上固定標籤
+func (s *tagsStage) Process(_ context.Context, data []models.PDUData) ([]models.PDUData, error) {
+	for i := range data {
+		tags := copyTags(data[i].Tags)
+		for k, v := range s.Tags {
+			if _, exists := tags[k]; exists && !s.Overwrite {
+				continue
+			}
+			tags[k] = v
+		}
+		data[i].Tags = tags
+	}
+	return data, nil
+}
+
+// validateStage 以驗證規則檢查 PDU 數據，規則與處理器選項 pdu.validation 相同
+type validateStage struct {
+	name       string
+	rules      models.PDUValidation
+	validator  *Validator
+	quarantine QuarantineStore
+	pipeline   *Pipeline
+}
+
+func newValidateStage(config StageConfig, pipeline *Pipeline) (Stage, error) {
+	opts, err := parseValidationOptions(config.Options)
+	if err != nil {
+		return nil, err
+	}
+	s := &validateStage{
+		name:      config.Name,
+		rules:     opts.PDUValidation,
+		validator: NewValidator(),
+		pipeline:  pipeline,
+	}
+	if opts.QuarantineFile != "" {
+		s.quarantine = NewFileQuarantine(opts.QuarantineFile, opts.QuarantineMaxSize)
+	}
+	return s, nil
+}
+
+// Process 丟棄或標記未通過驗證的數據
+func (s *validateStage) Process(_ context.Context, data []models.PDUData) ([]models.PDUData, error) {
+	action := s.rules.Action
+	if action == "" {
+		action = ValidationDrop
+	}
+
+	result := data[:0]
+	for _, pdu := range data {
+		device := energyDeviceKey(&pdu)
+		violations := s.validator.Validate(device, pdu.Timestamp, pduFields(pdu), &s.rules)
+		if len(violations) == 0 {
+			result = append(result, pdu)
+			continue
+		}
+
+		if s.quarantine != nil {
+			record := QuarantineRecord{
+				Time:         time.Now(),
+				Processor:    s.name,
+				Device:       device,
+				Manufacturer: pdu.Tags["manufacturer"],
+				Model:        pdu.Tags["model"],
+				Action:       action,
+				Reason:       violationSummary(violations),
+				Violations:   violations,
+				Data:         pdu,
+			}
+			if err := s.quarantine.Write(record); err != nil {
+				s.pipeline.logger.Error("寫入隔離區失敗",
+					zap.String("stage", s.name),
+					zap.Error(err))
+			}
+		}
+
+		if action == ValidationFlag {
+			pdu.Tags = copyTags(pdu.Tags)
+			pdu.Tags[ValidationTag] = "failed"
+			result = append(result, pdu)
+		}
+	}
+	return result, nil
+}
+
+// pduFields 將 PDU 數據展開為驗證使用的字段
+// PDUData 不記錄字段是否存在，與 JSON 輸出的 omitempty 相同，數值為 0 的字段視為不存在，
+// 只驗證存在的字段，避免設備沒有的物理量被判為低於下限或觸發 required 以外的違規；
+// 需要檢查讀數為 0 的情況時使用處理器的 pdu.validation，以原始字段驗證
+func pduFields(pdu models.PDUData) []assignedField {
+	var fields []assignedField
+	add := func(scope FieldScope, id string, current, voltage, power, energy float64) {
+		for _, f := range []struct {
+			quantity string
+			value    float64
+		}{
+			{"current", current},
+			{"voltage", voltage},
+			{"power", power},
+			{"energy", energy},
+		} {
+			if f.value == 0 {
+				continue
+			}
+			fields = append(fields, assignedField{Name: FieldName{Scope: scope, ID: id, Quantity: f.quantity}, Value: f.value})
+		}
+	}
+
+	add(ScopeTotal, "", pdu.Current, pdu.Voltage, pdu.Power, pdu.Energy)
+	for _, phase := range pdu.Phases {
+		add(ScopePhase, phase.ID, phase.Current, phase.Voltage, phase.Power, phase.Energy)
+	}
+	for _, branch := range pdu.Branches {
+		add(ScopeBranch, branch.ID, branch.Current, branch.Voltage, branch.Power, branch.Energy)
+	}
+	for _, outlet := range pdu.Outlets {
+		add(ScopeOutlet, outlet.ID, outlet.Current, outlet.Voltage, outlet.Power, outlet.Energy)
+	}
+	for _, probe := range pdu.Environment {
+		fields = append(fields, assignedField{Name: FieldName{Scope: ScopeEnv, ID: probe.ID, Quantity: probe.Type}, Value: probe.Value})
+	}
+	return fields
+}
+
+// transformStage 調整數據名稱、標籤與數值精度
+type transformStage struct {
+	Name       string            `yaml:"name"`        // 覆蓋數據名稱
+	RenameTags map[string]string `yaml:"rename_tags"` // 原標籤名 -> 新標籤名
+	DropTags   []string          `yaml:"drop_tags"`
+	Round      *int              `yaml:"round"` // 數值保留的小數位數
+}
+
+func newTransformStage(config StageConfig, _ *Pipeline) (Stage, error) {
+	s := &transformStage{}
+	if err := stageOptions(config.Options, s); err != nil {
+		return nil, err
+	}
+	if s.Round != nil && *s.Round < 0 {
+		return nil, fmt.Errorf("round 不能為負數")
+	}
+	return s, nil
+}
+
+// Process 套用名稱、標籤與精度設置
+func (s *transformStage) Process(_ context.Context, data []models.PDUData) ([]models.PDUData, error) {
+	for i := range data {
+		pdu := &data[i]
+		if s.Name != "" {
+			pdu.Name = s.Name
+		}
+
+		if len(s.RenameTags) > 0 || len(s.DropTags) > 0 {
+			tags := copyTags(pdu.Tags)
+			for from, to := range s.RenameTags {
+				if value, ok := tags[from]; ok {
+					delete(tags, from)
+					tags[to] = value
+				}
+			}
+			for _, tag := range s.DropTags {
+				delete(tags, tag)
+			}
+			pdu.Tags = tags
+		}
+
+		if s.Round != nil {
+			roundPDUData(pdu, *s.Round)
+		}
+	}
+	return data, nil
+}
+
+// roundPDUData 將 PDU 數據的所有數值四捨五入到指定小數位數
+func roundPDUData(pdu *models.PDUData, digits int) {
+	factor := math.Pow(10, float64(digits))
+	round := func(values ...*float64) {
+		for _, v := range values {
+			*v = math.Round(*v*factor) / factor
+		}
+	}
+
+	round(&pdu.Current, &pdu.Voltage, &pdu.Power, &pdu.Energy, &pdu.EnergyDelta,
+		&pdu.ApparentPower, &pdu.PowerFactor, &pdu.CurrentImbalance, &pdu.NeutralCurrent)
+
+	pdu.Phases = append([]models.Phase(nil), pdu.Phases...)
+	for i := range pdu.Phases {
+		p := &pdu.Phases[i]
+		round(&p.Current, &p.Voltage, &p.Power, &p.Energy, &p.EnergyDelta, &p.ApparentPower, &p.PowerFactor, &p.LineVoltage)
+	}
+	pdu.Branches = append([]models.Branch(nil), pdu.Branches...)
+	for i := range pdu.Branches {
+		b := &pdu.Branches[i]
+		round(&b.Current, &b.Voltage, &b.Power, &b.Energy, &b.EnergyDelta)
+	}
+	pdu.Outlets = append([]models.Outlet(nil), pdu.Outlets...)
+	for i := range pdu.Outlets {
+		o := &pdu.Outlets[i]
+		round(&o.Current, &o.Voltage, &o.Power, &o.Energy, &o.EnergyDelta)
+	}
+	pdu.Environment = append([]models.EnvProbe(nil), pdu.Environment...)
+	for i := range pdu.Environment {
+		round(&pdu.Environment[i].Value)
+	}
+}
+
+// aggregateStateTTL 設備聚合狀態的最短保留時間，實際為窗口的 10 倍與此值中較長者
+const aggregateStateTTL = time.Hour
+
+// aggregateStage 降低輸出頻率：每個設備在每個窗口只輸出第一筆讀數
+// 被略過讀數的能耗增量累加到該設備下一筆輸出的讀數，報表加總增量時不會遺漏
+// 長時間未出現的設備狀態會被移除，其尚未輸出的累計增量隨之捨棄
+type aggregateStage struct {
+	window  time.Duration
+	ttl     time.Duration
+	devices map[string]*aggregateState
+	pruned  time.Time
+	mutex   sync.Mutex
+}
+
+// aggregateState 設備的聚合狀態
+type aggregateState struct {
+	seen     time.Time // 最後收到讀數的時間（本機時間）
+	emitted  time.Time
+	total    float64
+	phases   map[string]float64
+	branches map[string]float64
+	outlets  map[string]float64
+}
+
+func newAggregateStage(config StageConfig, _ *Pipeline) (Stage, error) {
+	var opts struct {
+		Window string `yaml:"window"`
+	}
+	if err := stageOptions(config.Options, &opts); err != nil {
+		return nil, err
+	}
+	window, err := time.ParseDuration(opts.Window)
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("無效的 window %q", opts.Window)
+	}
+	ttl := 10 * window
+	if ttl < aggregateStateTTL {
+		ttl = aggregateStateTTL
+	}
+	return &aggregateStage{
+		window:  window,
+		ttl:     ttl,
+		devices: make(map[string]*aggregateState),
+	}, nil
+}
+
+// Process 略過窗口內的後續讀數並累計其能耗增量
+func (s *aggregateStage) Process(_ context.Context, data []models.PDUData) ([]models.PDUData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+
+	result := data[:0]
+	for _, pdu := range data {
+		key := energyDeviceKey(&pdu)
+		state, ok := s.devices[key]
+		if !ok {
+			state = &aggregateState{}
+			s.devices[key] = state
+		}
+		state.seen = now
+
+		if !state.emitted.IsZero() && pdu.Timestamp.Sub(state.emitted) < s.window {
+			state.accumulate(pdu)
+			continue
+		}
+
+		state.apply(&pdu)
+		state.emitted = pdu.Timestamp
+		result = append(result, pdu)
+	}
+	return result, nil
+}
+
+// prune 每個窗口最多一次移除超過保留時間未出現的設備狀態，調用方須持有鎖
+func (s *aggregateStage) prune(now time.Time) {
+	if now.Sub(s.pruned) < s.window {
+		return
+	}
+	s.pruned = now
+
+	for key, state := range s.devices {
+		if now.Sub(state.seen) > s.ttl {
+			delete(s.devices, key)
+		}
+	}
+}
+
+// accumulate 累計被略過讀數的能耗增量
+func (s *aggregateState) accumulate(pdu models.PDUData) {
+	if s.phases == nil {
+		s.phases = make(map[string]float64)
+		s.branches = make(map[string]float64)
+		s.outlets = make(map[string]float64)
+	}
+	s.total += pdu.EnergyDelta
+	for _, phase := range pdu.Phases {
+		s.phases[phase.ID] += phase.EnergyDelta
+	}
+	for _, branch := range pdu.Branches {
+		s.branches[branch.ID] += branch.EnergyDelta
+	}
+	for _, outlet := range pdu.Outlets {
+		s.outlets[outlet.ID] += outlet.EnergyDelta
+	}
+}
+
+// apply 將累計的能耗增量加到輸出的讀數並清除累計
+func (s *aggregateState) apply(pdu *models.PDUData) {
+	if s.phases == nil {
+		return
+	}
+
+	pdu.EnergyDelta += s.total
+	pdu.Phases = append([]models.Phase(nil), pdu.Phases...)
+	for i := range pdu.Phases {
+		pdu.Phases[i].EnergyDelta += s.phases[pdu.Phases[i].ID]
+	}
+	pdu.Branches = append([]models.Branch(nil), pdu.Branches...)
+	for i := range pdu.Branches {
+		pdu.Branches[i].EnergyDelta += s.branches[pdu.Branches[i].ID]
+	}
+	pdu.Outlets = append([]models.Outlet(nil), pdu.Outlets...)
+	for i := range pdu.Outlets {
+		pdu.Outlets[i].EnergyDelta += s.outlets[pdu.Outlets[i].ID]
+	}
+
+	s.total = 0
+	s.phases, s.branches, s.outlets = nil, nil, nil
+}
+
+// outputStage 將數據交給輸出路由器，並原樣傳給後續的 output 階段
+type outputStage struct {
+	pipeline *Pipeline
+}
+
+func newOutputStage(_ StageConfig, pipeline *Pipeline) (Stage, error) {
+	return &outputStage{pipeline: pipeline}, nil
+}
+
+// Process 路由數據到輸出處理程序
+func (s *outputStage) Process(ctx context.Context, data []models.PDUData) ([]models.PDUData, error) {
+	if err := s.pipeline.route(ctx, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
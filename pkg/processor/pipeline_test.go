@@ -0,0 +1,87 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"viot/logger"
+	"viot/models"
+)
+
+func writePipelineConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pipeline.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("寫入管線配置失敗: %v", err)
+	}
+	return path
+}
+
+func TestLoadPipelineConfigRequiresOutputStage(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{"沒有 output 階段", "stages:\n  - name: site\n    type: enrich\n    options:\n      tags: { site: tpe1 }\n", true},
+		{"output 階段已停用", "stages:\n  - name: out\n    type: output\n    enabled: false\n", true},
+		{"有 output 階段", "stages:\n  - name: out\n    type: output\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadPipelineConfig(writePipelineConfig(t, tt.config))
+			if tt.wantErr && (err == nil || !strings.Contains(err.Error(), "output")) {
+				t.Fatalf("應返回缺少 output 階段的錯誤，實際為 %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("載入管線配置失敗: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateStageChecksPresentFieldsOnly(t *testing.T) {
+	minVoltage, minCurrent := 180.0, 0.5
+	stage := &validateStage{
+		name: "bounds",
+		rules: models.PDUValidation{
+			Bounds: map[string]models.PDUBound{
+				"phase.voltage": {Min: &minVoltage},
+				"current":       {Min: &minCurrent},
+			},
+		},
+		validator: NewValidator(),
+		pipeline:  NewPipeline(logger.DefaultLogger),
+	}
+
+	// 只回報相位電流的 PDU 沒有相電壓與總電流，不應被判為低於下限
+	pdu := models.PDUData{
+		Name:      "pdu",
+		Timestamp: time.Unix(1700000000, 0),
+		Tags:      map[string]string{"device": "pdu-01"},
+		Phases:    []models.Phase{{ID: "L1", Current: 4.5}},
+	}
+	out, err := stage.Process(context.Background(), []models.PDUData{pdu})
+	if err != nil {
+		t.Fatalf("驗證失敗: %v", err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("沒有相電壓的數據不應被丟棄")
+	}
+
+	// 存在的字段仍須通過驗證
+	pdu.Phases = []models.Phase{{ID: "L1", Current: 4.5, Voltage: 120}}
+	pdu.Timestamp = pdu.Timestamp.Add(time.Second)
+	out, err = stage.Process(context.Background(), []models.PDUData{pdu})
+	if err != nil {
+		t.Fatalf("驗證失敗: %v", err)
+	}
+	if len(out) != 0 {
+		t.Errorf("相電壓低於下限的數據應被丟棄")
+	}
+}
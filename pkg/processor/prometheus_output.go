@@ -0,0 +1,312 @@
+package processor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"viot/models"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultPrometheusMaxAge 默認設備超過此時間沒有新數據時移除其序列
+	defaultPrometheusMaxAge = 5 * time.Minute
+
+	// prometheusContentType Prometheus 文本格式
+	prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// defaultPrometheusLabels 默認從標籤複製的位置標籤
+var defaultPrometheusLabels = []string{"factory", "phase", "datacenter", "room", "rack", "side"}
+
+// PrometheusOutputConfig Prometheus 輸出設置
+type PrometheusOutputConfig struct {
+	MaxAge time.Duration `json:"max_age" yaml:"max_age"` // 設備超過此時間沒有新數據時移除其序列
+	Labels []string      `json:"labels" yaml:"labels"`   // 從數據標籤複製的標籤，默認為位置標籤
+}
+
+// PrometheusOutputStats Prometheus 輸出統計
+type PrometheusOutputStats struct {
+	Devices  int       `json:"devices"`   // 目前輸出的設備數
+	Expired  int64     `json:"expired"`   // 因過期而移除的設備數
+	Scrapes  int64     `json:"scrapes"`   // 被抓取的次數
+	LastSeen time.Time `json:"last_seen"` // 最近一次收到數據的時間
+}
+
+// prometheusEntry 設備最近一次的數據與收到的時間
+type prometheusEntry struct {
+	pdu  models.PDUData
+	seen time.Time
+}
+
+// PrometheusOutputHandler Prometheus 輸出處理程序
+// 保留各設備最近一次處理的數據，以 Prometheus 文本格式輸出總體、相位與分支的電流、電壓、功率與能耗；
+// 設備超過 max_age 沒有新數據時移除其序列，停止回報的 PDU 不會一直顯示最後的讀數
+type PrometheusOutputHandler struct {
+	config PrometheusOutputConfig
+	labels []promLabel
+	logger *zap.Logger
+
+	entries map[string]prometheusEntry
+	stats   PrometheusOutputStats
+	mutex   sync.Mutex
+
+	now func() time.Time
+}
+
+// promLabel 從數據標籤複製的 Prometheus 標籤
+type promLabel struct {
+	tag  string
+	name string // 轉換為合法名稱的標籤名
+}
+
+// prometheusLabelName 標籤名中不合法的字元
+var prometheusLabelName = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// prometheusReservedLabels 由處理程序設置的標籤，不從數據標籤複製
+var prometheusReservedLabels = map[string]bool{"device": true, "name": true, "phase_id": true, "branch": true}
+
+// NewPrometheusOutputHandler 創建Prometheus輸出處理程序
+func NewPrometheusOutputHandler(config PrometheusOutputConfig, logger *zap.Logger) *PrometheusOutputHandler {
+	if config.MaxAge <= 0 {
+		config.MaxAge = defaultPrometheusMaxAge
+	}
+	if len(config.Labels) == 0 {
+		config.Labels = defaultPrometheusLabels
+	}
+
+	var labels []promLabel
+	seen := make(map[string]bool)
+	for _, tag := range config.Labels {
+		name := prometheusLabelName.ReplaceAllString(tag, "_")
+		if name == "" || (name[0] >= '0' && name[0] <= '9') || prometheusReservedLabels[name] || seen[name] {
+			logger.Warn("忽略無效或重複的Prometheus標籤", zap.String("tag", tag))
+			continue
+		}
+		seen[name] = true
+		labels = append(labels, promLabel{tag: tag, name: name})
+	}
+
+	return &PrometheusOutputHandler{
+		config:  config,
+		labels:  labels,
+		logger:  logger.Named("prometheus-output"),
+		entries: make(map[string]prometheusEntry),
+		now:     time.Now,
+	}
+}
+
+// HandlePDUData 保留各設備最近一次的數據
+func (h *PrometheusOutputHandler) HandlePDUData(ctx context.Context, data []models.PDUData) error {
+	now := h.now()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, pdu := range data {
+		device := energyDeviceKey(&pdu)
+		// 亂序到達的較舊讀數不覆蓋較新的讀數
+		if entry, ok := h.entries[device]; ok && pdu.Timestamp.Before(entry.pdu.Timestamp) {
+			continue
+		}
+		h.entries[device] = prometheusEntry{pdu: pdu, seen: now}
+	}
+	if len(data) > 0 {
+		h.stats.LastSeen = now
+	}
+	return nil
+}
+
+// expire 移除超過 max_age 沒有新數據的設備，需持有鎖
+func (h *PrometheusOutputHandler) expire(now time.Time) {
+	for device, entry := range h.entries {
+		if now.Sub(entry.seen) > h.config.MaxAge {
+			delete(h.entries, device)
+			h.stats.Expired++
+			h.logger.Info("PDU超過最長時間沒有新數據，移除其指標",
+				zap.String("device", device),
+				zap.Time("last_seen", entry.seen))
+		}
+	}
+}
+
+// snapshot 移除過期的設備並返回依設備排序的數據
+func (h *PrometheusOutputHandler) snapshot() ([]string, []models.PDUData) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.expire(h.now())
+	h.stats.Scrapes++
+
+	devices := make([]string, 0, len(h.entries))
+	for device := range h.entries {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	data := make([]models.PDUData, len(devices))
+	for i, device := range devices {
+		data[i] = h.entries[device].pdu
+	}
+	return devices, data
+}
+
+// promSample 單個樣本，labels 為設備標籤之後的額外標籤
+type promSample struct {
+	labels []string // 名稱、值交替
+	value  float64
+}
+
+// promFamily 一組同名指標
+type promFamily struct {
+	name    string
+	help    string
+	samples func(pdu models.PDUData) []promSample
+}
+
+// pduFamily 總體指標
+func pduFamily(name, help string, value func(pdu models.PDUData) float64) promFamily {
+	return promFamily{name: name, help: help, samples: func(pdu models.PDUData) []promSample {
+		return []promSample{{value: value(pdu)}}
+	}}
+}
+
+// phaseFamily 相位指標，相位以 phase_id 標籤區分（phase 為位置標籤）
+func phaseFamily(name, help string, value func(phase models.Phase) float64) promFamily {
+	return promFamily{name: name, help: help, samples: func(pdu models.PDUData) []promSample {
+		samples := make([]promSample, 0, len(pdu.Phases))
+		for _, phase := range pdu.Phases {
+			samples = append(samples, promSample{labels: []string{"phase_id", phase.ID}, value: value(phase)})
+		}
+		return samples
+	}}
+}
+
+// branchFamily 分支指標，分支以 branch 標籤區分
+func branchFamily(name, help string, value func(branch models.Branch) float64) promFamily {
+	return promFamily{name: name, help: help, samples: func(pdu models.PDUData) []promSample {
+		samples := make([]promSample, 0, len(pdu.Branches))
+		for _, branch := range pdu.Branches {
+			samples = append(samples, promSample{labels: []string{"branch", branch.ID}, value: value(branch)})
+		}
+		return samples
+	}}
+}
+
+// prometheusFamilies 輸出的指標，能耗的單位依型號描述檔的比例因子
+var prometheusFamilies = []promFamily{
+	pduFamily("pdu_current_amperes", "PDU 總電流", func(p models.PDUData) float64 { return p.Current }),
+	pduFamily("pdu_voltage_volts", "PDU 電壓", func(p models.PDUData) float64 { return p.Voltage }),
+	pduFamily("pdu_power_watts", "PDU 總功率", func(p models.PDUData) float64 { return p.Power }),
+	pduFamily("pdu_energy", "PDU 累計能耗計數器", func(p models.PDUData) float64 { return p.Energy }),
+	phaseFamily("pdu_phase_current_amperes", "PDU 相電流", func(p models.Phase) float64 { return p.Current }),
+	phaseFamily("pdu_phase_voltage_volts", "PDU 相電壓", func(p models.Phase) float64 { return p.Voltage }),
+	phaseFamily("pdu_phase_power_watts", "PDU 相功率", func(p models.Phase) float64 { return p.Power }),
+	phaseFamily("pdu_phase_energy", "PDU 相累計能耗計數器", func(p models.Phase) float64 { return p.Energy }),
+	branchFamily("pdu_branch_current_amperes", "PDU 分支電流", func(b models.Branch) float64 { return b.Current }),
+	branchFamily("pdu_branch_voltage_volts", "PDU 分支電壓", func(b models.Branch) float64 { return b.Voltage }),
+	branchFamily("pdu_branch_power_watts", "PDU 分支功率", func(b models.Branch) float64 { return b.Power }),
+	branchFamily("pdu_branch_energy", "PDU 分支累計能耗計數器", func(b models.Branch) float64 { return b.Energy }),
+	pduFamily("pdu_last_reading_timestamp_seconds", "PDU 最近一次讀數的時間", func(p models.PDUData) float64 {
+		return float64(p.Timestamp.UnixNano()) / float64(time.Second)
+	}),
+}
+
+// WriteMetrics 以 Prometheus 文本格式寫出所有未過期設備的指標
+// 每個序列帶有 device（設備識別）、name（位置名稱，見 PDULocationName）與設置的標籤
+func (h *PrometheusOutputHandler) WriteMetrics(w io.Writer) error {
+	devices, data := h.snapshot()
+
+	// 各設備的標籤只組合一次
+	deviceLabels := make([]string, len(data))
+	for i, pdu := range data {
+		name, ok := PDULocationName(pdu.Tags)
+		if !ok {
+			name = pdu.Tags["name"]
+		}
+		pairs := []string{"device", devices[i], "name", name}
+		for _, label := range h.labels {
+			pairs = append(pairs, label.name, pdu.Tags[label.tag])
+		}
+		deviceLabels[i] = formatPromLabels(pairs)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, family := range prometheusFamilies {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n", family.name, family.help, family.name)
+		for i, pdu := range data {
+			for _, sample := range family.samples(pdu) {
+				labels := deviceLabels[i]
+				if len(sample.labels) > 0 {
+					labels += "," + formatPromLabels(sample.labels)
+				}
+				fmt.Fprintf(bw, "%s{%s} %s\n", family.name, labels, formatPromValue(sample.value))
+			}
+		}
+	}
+
+	h.mutex.Lock()
+	expired := h.stats.Expired
+	h.mutex.Unlock()
+	fmt.Fprintf(bw, "# HELP pdu_exporter_devices 目前輸出指標的 PDU 數\n# TYPE pdu_exporter_devices gauge\npdu_exporter_devices %d\n", len(data))
+	fmt.Fprintf(bw, "# HELP pdu_exporter_expired_total 因過期而移除的 PDU 數\n# TYPE pdu_exporter_expired_total counter\npdu_exporter_expired_total %d\n", expired)
+	return bw.Flush()
+}
+
+// ServeHTTP 以 Prometheus 文本格式返回指標
+func (h *PrometheusOutputHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+	if err := h.WriteMetrics(w); err != nil {
+		h.logger.Warn("寫出Prometheus指標失敗", zap.Error(err))
+	}
+}
+
+// Stats 返回Prometheus輸出統計
+func (h *PrometheusOutputHandler) Stats() PrometheusOutputStats {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	stats := h.stats
+	stats.Devices = len(h.entries)
+	return stats
+}
+
+// formatPromLabels 將名稱、值交替的列表格式化為 a="1",b="2"
+func formatPromLabels(pairs []string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(promLabelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+// promLabelEscaper 轉義標籤值中的反斜線、雙引號與換行
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatPromValue 格式化樣本值
+func formatPromValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
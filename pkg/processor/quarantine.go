@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"viot/models"
+)
+
+// defaultQuarantineMaxSize 隔離文件輪替大小
+const defaultQuarantineMaxSize = 50 * 1024 * 1024
+
+// QuarantineRecord 隔離記錄
+type QuarantineRecord struct {
+	Time         time.Time      `json:"time"`
+	Processor    string         `json:"processor"`
+	Device       string         `json:"device"`
+	Manufacturer string         `json:"manufacturer"`
+	Model        string         `json:"model"`
+	Profile      string         `json:"profile,omitempty"`
+	Action       string         `json:"action"`
+	Reason       string         `json:"reason"`
+	Violations   []Violation    `json:"violations"`
+	Data         models.PDUData `json:"data"`
+}
+
+// QuarantineStore 隔離區存儲
+type QuarantineStore interface {
+	Write(record QuarantineRecord) error
+}
+
+// FileQuarantine 以 JSON Lines 格式追加寫入隔離文件，超過大小上限時將現有文件更名為 .1 後重新開始
+type FileQuarantine struct {
+	path    string
+	maxSize int64
+	mutex   sync.Mutex
+}
+
+// NewFileQuarantine 創建文件隔離區
+func NewFileQuarantine(path string, maxSize int64) *FileQuarantine {
+	if maxSize <= 0 {
+		maxSize = defaultQuarantineMaxSize
+	}
+	return &FileQuarantine{
+		path:    path,
+		maxSize: maxSize,
+	}
+}
+
+// Write 寫入一筆隔離記錄
+func (q *FileQuarantine) Write(record QuarantineRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("序列化隔離記錄失敗: %w", err)
+	}
+	data = append(data, '\n')
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return fmt.Errorf("創建隔離目錄失敗: %w", err)
+	}
+
+	if info, err := os.Stat(q.path); err == nil && info.Size()+int64(len(data)) > q.maxSize {
+		if err := os.Rename(q.path, q.path+".1"); err != nil {
+			return fmt.Errorf("輪替隔離文件失敗: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(q.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("開啟隔離文件失敗: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("寫入隔離文件失敗: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package processor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"viot/models"
+	"viot/models/webservice"
+)
+
+// defaultRegistryCheckInterval 默認檢查註冊表文件是否變更的間隔
+const defaultRegistryCheckInterval = 30 * time.Second
+
+// defaultRegistryIPTags 默認 IP 標籤，依序取第一個存在的標籤
+var defaultRegistryIPTags = []string{"ip", "agent_host", "source"}
+
+// defaultRegistrySerialTags 默認序號標籤，依序取第一個存在的標籤
+var defaultRegistrySerialTags = []string{"serial_number", "serial"}
+
+// RegistryConfig 註冊表標籤補充設置
+type RegistryConfig struct {
+	// File 註冊表 CSV 文件，如 data/registry.csv
+	File string
+	// CheckInterval 檢查文件是否變更的間隔，文件修改時間或大小改變時重新載入
+	CheckInterval time.Duration
+	// Overwrite 覆蓋數據點已有的標籤，否則只補充缺少的標籤
+	Overwrite bool
+	// IPTags 查找註冊記錄使用的 IP 標籤
+	IPTags []string
+	// SerialTags 查找註冊記錄使用的序號標籤
+	SerialTags []string
+}
+
+// parseRegistryConfig 從處理器選項解析註冊表設置
+func parseRegistryConfig(options map[string]interface{}) RegistryConfig {
+	config := RegistryConfig{
+		CheckInterval: defaultRegistryCheckInterval,
+		IPTags:        defaultRegistryIPTags,
+		SerialTags:    defaultRegistrySerialTags,
+	}
+
+	if file, ok := options["file"].(string); ok {
+		config.File = file
+	}
+	if interval, ok := options["check_interval"].(string); ok {
+		if d, err := time.ParseDuration(interval); err == nil && d > 0 {
+			config.CheckInterval = d
+		}
+	}
+	if overwrite, ok := options["overwrite"].(bool); ok {
+		config.Overwrite = overwrite
+	}
+	if tags := toStringSlice(options["ip_tags"]); len(tags) > 0 {
+		config.IPTags = tags
+	}
+	if tags := toStringSlice(options["serial_tags"]); len(tags) > 0 {
+		config.SerialTags = tags
+	}
+	return config
+}
+
+// RegistryStats 註冊表標籤補充統計
+type RegistryStats struct {
+	File      string    `json:"file"`
+	Entries   int       `json:"entries"`
+	LoadedAt  time.Time `json:"loaded_at"`
+	LastError string    `json:"last_error,omitempty"`
+	Matched   int64     `json:"matched"`
+	Unmatched int64     `json:"unmatched"`
+}
+
+// RegistryEnricher 依 IP 或序號在設備註冊表 (PDURegistry/DeviceRegistry) 查找數據點，
+// 附加工廠、廠區、機房、房間、機櫃、側別等位置標籤與製造商、型號標籤
+// 註冊表以記憶體索引查找，文件變更後在下一次檢查時重新載入；載入失敗時保留原有索引
+type RegistryEnricher struct {
+	config   RegistryConfig
+	byIP     map[string]map[string]string
+	bySerial map[string]map[string]string
+	modTime  time.Time
+	size     int64
+	checked  time.Time
+	stats    RegistryStats
+	mutex    sync.RWMutex
+}
+
+// NewRegistryEnricher 創建註冊表標籤補充器，需呼叫 Reload 載入註冊表
+func NewRegistryEnricher(config RegistryConfig) *RegistryEnricher {
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = defaultRegistryCheckInterval
+	}
+	if len(config.IPTags) == 0 {
+		config.IPTags = defaultRegistryIPTags
+	}
+	if len(config.SerialTags) == 0 {
+		config.SerialTags = defaultRegistrySerialTags
+	}
+	return &RegistryEnricher{
+		config:   config,
+		byIP:     make(map[string]map[string]string),
+		bySerial: make(map[string]map[string]string),
+		stats:    RegistryStats{File: config.File},
+	}
+}
+
+// Reload 重新讀取註冊表並重建索引，失敗時保留原有索引
+func (e *RegistryEnricher) Reload() error {
+	info, err := os.Stat(e.config.File)
+	if err == nil {
+		err = e.load(info)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.checked = time.Now()
+	if err != nil {
+		e.stats.LastError = err.Error()
+		return err
+	}
+	return nil
+}
+
+// Refresh 距上次檢查已超過檢查間隔且文件已變更時重新載入，返回是否重新載入
+func (e *RegistryEnricher) Refresh(now time.Time) (bool, error) {
+	e.mutex.Lock()
+	if now.Sub(e.checked) < e.config.CheckInterval {
+		e.mutex.Unlock()
+		return false, nil
+	}
+	e.checked = now
+	modTime, size := e.modTime, e.size
+	e.mutex.Unlock()
+
+	info, err := os.Stat(e.config.File)
+	if err != nil {
+		e.setError(err)
+		return false, err
+	}
+	if info.ModTime().Equal(modTime) && info.Size() == size {
+		return false, nil
+	}
+	if err := e.load(info); err != nil {
+		e.setError(err)
+		return false, err
+	}
+	return true, nil
+}
+
+// setError 記錄最近一次載入錯誤
+func (e *RegistryEnricher) setError(err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.stats.LastError = err.Error()
+}
+
+// load 讀取註冊表文件並替換索引
+func (e *RegistryEnricher) load(info os.FileInfo) error {
+	records, err := readRegistry(e.config.File)
+	if err != nil {
+		return err
+	}
+
+	byIP := make(map[string]map[string]string)
+	bySerial := make(map[string]map[string]string)
+	for _, record := range records {
+		tags := registryRecordTags(record)
+		if ip := normalizeRegistryIP(record.IP); ip != "" {
+			byIP[ip] = tags
+		}
+		if serial := normalizeRegistrySerial(record.SerialNumber); serial != "" {
+			bySerial[serial] = tags
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.byIP = byIP
+	e.bySerial = bySerial
+	e.modTime = info.ModTime()
+	e.size = info.Size()
+	e.stats.Entries = len(records)
+	e.stats.LoadedAt = time.Now()
+	e.stats.LastError = ""
+	return nil
+}
+
+// Enrich 為數據點附加註冊表標籤，返回找到註冊記錄的數據點數
+// 數據點的標籤會複製後再修改，不影響呼叫方共用的標籤
+func (e *RegistryEnricher) Enrich(points []models.PDUPoint) int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	matched := 0
+	for i := range points {
+		tags := e.lookup(points[i].Tags)
+		if tags == nil {
+			continue
+		}
+		matched++
+
+		enriched := copyTags(points[i].Tags)
+		for k, v := range tags {
+			if _, exists := enriched[k]; exists && !e.config.Overwrite {
+				continue
+			}
+			enriched[k] = v
+		}
+		points[i].Tags = enriched
+	}
+
+	e.stats.Matched += int64(matched)
+	e.stats.Unmatched += int64(len(points) - matched)
+	return matched
+}
+
+// lookup 依 IP 標籤查找註冊記錄，找不到時再以序號查找
+func (e *RegistryEnricher) lookup(tags map[string]string) map[string]string {
+	for _, tag := range e.config.IPTags {
+		if ip := normalizeRegistryIP(tags[tag]); ip != "" {
+			if found, ok := e.byIP[ip]; ok {
+				return found
+			}
+			break
+		}
+	}
+	for _, tag := range e.config.SerialTags {
+		if serial := normalizeRegistrySerial(tags[tag]); serial != "" {
+			return e.bySerial[serial]
+		}
+	}
+	return nil
+}
+
+// Stats 返回註冊表標籤補充統計
+func (e *RegistryEnricher) Stats() RegistryStats {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.stats
+}
+
+// registryRecordTags 註冊記錄附加的標籤，空值不附加
+func registryRecordTags(record webservice.PDURegistry) map[string]string {
+	tags := make(map[string]string)
+	for k, v := range map[string]string{
+		"factory":      record.Factory,
+		"phase":        record.Phase,
+		"datacenter":   record.Datacenter,
+		"room":         record.Room,
+		"rack":         record.Rack,
+		"side":         record.Side,
+		"manufacturer": record.Manufacturer,
+		"model":        record.Model,
+	} {
+		if v = strings.TrimSpace(v); v != "" {
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
+// normalizeRegistryIP 移除協議前綴與端口，如 udp://10.0.0.1:161 -> 10.0.0.1
+func normalizeRegistryIP(value string) string {
+	value = strings.TrimSpace(value)
+	if i := strings.Index(value, "://"); i >= 0 {
+		value = value[i+3:]
+	}
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	return value
+}
+
+// normalizeRegistrySerial 序號不區分大小寫
+func normalizeRegistrySerial(value string) string {
+	return strings.ToUpper(strings.TrimSpace(value))
+}
+
+// readRegistry 讀取註冊表 CSV，依標題行的列名 (csv 標籤) 解析 PDURegistry 與 DeviceRegistry 記錄
+// 未知的列會被忽略，DeviceRegistry 沒有序號列，只能以 IP 查找
+func readRegistry(path string) ([]webservice.PDURegistry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打開註冊表文件時出錯: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("讀取註冊表標題行時出錯: %w", err)
+	}
+
+	headerMap := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		headerMap[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	_, hasIP := headerMap["ip"]
+	_, hasSerial := headerMap["serial_number"]
+	if !hasIP && !hasSerial {
+		return nil, fmt.Errorf("註冊表缺少 ip 或 serial_number 列")
+	}
+
+	var records []webservice.PDURegistry
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("讀取註冊表記錄時出錯: %w", err)
+		}
+
+		column := func(name string) string {
+			if i, ok := headerMap[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		records = append(records, webservice.PDURegistry{
+			Name:         column("name"),
+			IP:           column("ip"),
+			Factory:      column("factory"),
+			Phase:        column("phase"),
+			Datacenter:   column("datacenter"),
+			Room:         column("room"),
+			Rack:         column("rack"),
+			Side:         column("side"),
+			Type:         column("type"),
+			Manufacturer: column("manufacturer"),
+			Model:        column("model"),
+			MAC:          column("mac"),
+			Version:      column("version"),
+			SerialNumber: column("serial_number"),
+		})
+	}
+	return records, nil
+}
@@ -0,0 +1,362 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"viot/models"
+)
+
+const (
+	// defaultSnapshotWindow 默認收集窗口
+	defaultSnapshotWindow = 10 * time.Second
+
+	// minSnapshotWindow 最小收集窗口，過小的窗口會使逾時檢查過於頻繁
+	minSnapshotWindow = time.Second
+
+	// snapshotExpectedTTL 設備超過此時間未輸出快照時忘記其行數，避免已移除設備的記錄無限增長
+	snapshotExpectedTTL = time.Hour
+
+	// SnapshotPartialTag 不完整快照的標籤
+	SnapshotPartialTag = "snapshot"
+)
+
+// defaultSnapshotIndexTags 默認索引標籤及其對應的表格類型
+// phase 是註冊表附加的位置標籤（廠區期別，如 P3），不是相位索引，需要時在 index_tags 中明確設置
+var defaultSnapshotIndexTags = map[string]string{
+	"branch":       "branch",
+	"branch_index": "branch",
+	"phase_index":  "phase",
+}
+
+// defaultSnapshotDeviceTags 默認設備識別標籤，依序取第一個存在的標籤
+var defaultSnapshotDeviceTags = []string{"device", "ip", "agent_host", "source"}
+
+// SnapshotConfig 快照組裝設置
+type SnapshotConfig struct {
+	Enabled bool
+	// Window 快照從收到第一個數據點起的收集窗口，逾時未完成即以現有數據輸出
+	Window time.Duration
+	// IndexTags 索引標籤到表格類型 (branch/phase) 的映射
+	IndexTags map[string]string
+	// DeviceTags 設備識別標籤，依序取第一個存在的標籤
+	DeviceTags []string
+	// Measurements 無索引標籤但需併入快照的指標名稱，如 SNMP 的純量字段
+	Measurements []string
+	// DropPartial 丟棄不完整的快照，否則加上 snapshot=partial 標籤後輸出
+	DropPartial bool
+}
+
+// parseSnapshotConfig 從處理器選項解析快照組裝設置
+func parseSnapshotConfig(options map[string]interface{}) SnapshotConfig {
+	config := SnapshotConfig{
+		Window:     defaultSnapshotWindow,
+		IndexTags:  defaultSnapshotIndexTags,
+		DeviceTags: defaultSnapshotDeviceTags,
+	}
+
+	if enabled, ok := options["enabled"].(bool); ok {
+		config.Enabled = enabled
+	}
+	if window, ok := options["window"].(string); ok {
+		if d, err := time.ParseDuration(window); err == nil && d > 0 {
+			config.Window = d
+		}
+	}
+	if tags, ok := options["index_tags"].(map[string]interface{}); ok {
+		config.IndexTags = make(map[string]string, len(tags))
+		for tag, kind := range tags {
+			if k, ok := kind.(string); ok {
+				config.IndexTags[tag] = k
+			}
+		}
+	}
+	if tags := toStringSlice(options["device_tags"]); len(tags) > 0 {
+		config.DeviceTags = tags
+	}
+	config.Measurements = toStringSlice(options["measurements"])
+	if drop, ok := options["drop_partial"].(bool); ok {
+		config.DropPartial = drop
+	}
+	return config
+}
+
+// toStringSlice 將選項中的字串列表轉換為 []string
+func toStringSlice(value interface{}) []string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	result := make([]string, 0, len(list))
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// expectedRows 設備上一個快照的行數
+type expectedRows struct {
+	rows     int
+	finished time.Time
+}
+
+// snapshot 收集中的設備快照
+type snapshot struct {
+	point   models.PDUPoint
+	rows    map[string]struct{}
+	fields  map[string]struct{}
+	started time.Time
+}
+
+// SnapshotStats 快照組裝統計
+type SnapshotStats struct {
+	Pending  int   `json:"pending"`
+	Complete int64 `json:"complete"`
+	Partial  int64 `json:"partial"`
+	Dropped  int64 `json:"dropped"`
+}
+
+// SnapshotAssembler 將同一設備在收集窗口內的表格行（每個分支或相位一個數據點）合併為單個 PDU 數據點
+// 表格行的字段依索引標籤改名為 branch_<id>_<field> 或 phase_<id>_<field>
+// 同一字段再次出現表示新一輪採集開始，此時輸出前一個快照；逾時未完成的快照以現有數據輸出
+type SnapshotAssembler struct {
+	config       SnapshotConfig
+	pending      map[string]*snapshot
+	expected     map[string]expectedRows
+	indexOrder   []string
+	mutex        sync.Mutex
+	complete     int64
+	partial      int64
+	dropped      int64
+	measurements map[string]struct{}
+}
+
+// NewSnapshotAssembler 創建快照組裝器
+func NewSnapshotAssembler(config SnapshotConfig) *SnapshotAssembler {
+	if config.Window <= 0 {
+		config.Window = defaultSnapshotWindow
+	}
+	if config.Window < minSnapshotWindow {
+		config.Window = minSnapshotWindow
+	}
+	// 數據點帶有多個索引標籤時依標籤名排序取第一個，結果不受 map 迭代順序影響
+	indexOrder := make([]string, 0, len(config.IndexTags))
+	for tag := range config.IndexTags {
+		indexOrder = append(indexOrder, tag)
+	}
+	sort.Strings(indexOrder)
+	measurements := make(map[string]struct{}, len(config.Measurements))
+	for _, name := range config.Measurements {
+		measurements[name] = struct{}{}
+	}
+	return &SnapshotAssembler{
+		config:       config,
+		pending:      make(map[string]*snapshot),
+		expected:     make(map[string]expectedRows),
+		indexOrder:   indexOrder,
+		measurements: measurements,
+	}
+}
+
+// Window 返回收集窗口
+func (a *SnapshotAssembler) Window() time.Duration {
+	return a.config.Window
+}
+
+// Add 加入數據點，返回不需組裝的數據點與已完成的快照
+func (a *SnapshotAssembler) Add(points []models.PDUPoint, now time.Time) []models.PDUPoint {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var ready []models.PDUPoint
+	for _, point := range points {
+		kind, id, indexed := a.rowIndex(point)
+		if !indexed {
+			if _, ok := a.measurements[point.Name]; !ok {
+				ready = append(ready, point)
+				continue
+			}
+		}
+
+		device := a.deviceKey(point)
+		if device == "" {
+			ready = append(ready, point)
+			continue
+		}
+
+		row := "scalar"
+		if indexed {
+			row = kind + "/" + id
+		}
+		fields := make(map[string]interface{}, len(point.Fields))
+		for field, value := range point.Fields {
+			fields[rowFieldName(kind, id, field)] = value
+		}
+
+		// 同一字段再次出現表示新一輪採集開始
+		s, ok := a.pending[device]
+		if ok && s.hasAny(fields) {
+			if flushed, ok := a.finish(device, s, now); ok {
+				ready = append(ready, flushed)
+			}
+			s = nil
+		}
+		if s == nil {
+			s = &snapshot{
+				point: models.PDUPoint{
+					Name:   point.Name,
+					Tags:   make(map[string]string),
+					Fields: make(map[string]interface{}),
+				},
+				rows:    make(map[string]struct{}),
+				fields:  make(map[string]struct{}),
+				started: now,
+			}
+			a.pending[device] = s
+		}
+
+		s.merge(point, fields, row, a.config.IndexTags)
+	}
+	return ready
+}
+
+// Expired 輸出收集窗口已結束的快照，並忘記長時間未輸出快照的設備行數
+func (a *SnapshotAssembler) Expired(now time.Time) []models.PDUPoint {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for device, expected := range a.expected {
+		if now.Sub(expected.finished) > snapshotExpectedTTL {
+			delete(a.expected, device)
+		}
+	}
+
+	var ready []models.PDUPoint
+	for device, s := range a.pending {
+		if now.Sub(s.started) < a.config.Window {
+			continue
+		}
+		if flushed, ok := a.finish(device, s, now); ok {
+			ready = append(ready, flushed)
+		}
+	}
+	return ready
+}
+
+// Flush 輸出所有收集中的快照，用於停止處理器時
+func (a *SnapshotAssembler) Flush() []models.PDUPoint {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	var ready []models.PDUPoint
+	for device, s := range a.pending {
+		if flushed, ok := a.finish(device, s, now); ok {
+			ready = append(ready, flushed)
+		}
+	}
+	return ready
+}
+
+// Stats 返回快照組裝統計
+func (a *SnapshotAssembler) Stats() SnapshotStats {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return SnapshotStats{
+		Pending:  len(a.pending),
+		Complete: a.complete,
+		Partial:  a.partial,
+		Dropped:  a.dropped,
+	}
+}
+
+// finish 結束快照；行數少於該設備上一個快照時視為不完整
+// 呼叫者須持有鎖
+func (a *SnapshotAssembler) finish(device string, s *snapshot, now time.Time) (models.PDUPoint, bool) {
+	delete(a.pending, device)
+
+	rows := len(s.rows)
+	expected := a.expected[device].rows
+	a.expected[device] = expectedRows{rows: rows, finished: now}
+
+	if rows < expected {
+		a.partial++
+		if a.config.DropPartial {
+			a.dropped++
+			return models.PDUPoint{}, false
+		}
+		s.point.Tags[SnapshotPartialTag] = "partial"
+		return s.point, true
+	}
+
+	a.complete++
+	return s.point, true
+}
+
+// rowIndex 從索引標籤取得表格類型與行 ID，依標籤名順序取第一個存在的索引標籤
+func (a *SnapshotAssembler) rowIndex(point models.PDUPoint) (string, string, bool) {
+	for _, tag := range a.indexOrder {
+		if id := point.Tags[tag]; id != "" {
+			return a.config.IndexTags[tag], id, true
+		}
+	}
+	return "", "", false
+}
+
+// deviceKey 以設備識別標籤取得設備鍵
+func (a *SnapshotAssembler) deviceKey(point models.PDUPoint) string {
+	for _, tag := range a.config.DeviceTags {
+		if value := point.Tags[tag]; value != "" {
+			return tag + "=" + value
+		}
+	}
+	return ""
+}
+
+// rowFieldName 表格行字段的快照字段名，已帶有類型前綴的字段只補上 ID
+func rowFieldName(kind, id, field string) string {
+	if kind == "" {
+		return field
+	}
+	if rest, ok := strings.CutPrefix(field, kind+"_"); ok {
+		return fmt.Sprintf("%s_%s_%s", kind, id, rest)
+	}
+	return fmt.Sprintf("%s_%s_%s", kind, id, field)
+}
+
+// hasAny 檢查快照是否已包含任一字段
+func (s *snapshot) hasAny(fields map[string]interface{}) bool {
+	for field := range fields {
+		if _, ok := s.fields[field]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// merge 將表格行併入快照：標籤取聯集（索引標籤除外），時間戳取最新，名稱優先使用純量數據點的名稱
+func (s *snapshot) merge(point models.PDUPoint, fields map[string]interface{}, row string, indexTags map[string]string) {
+	if row == "scalar" {
+		s.point.Name = point.Name
+	}
+	for k, v := range point.Tags {
+		if _, ok := indexTags[k]; ok {
+			continue
+		}
+		s.point.Tags[k] = v
+	}
+	for field, value := range fields {
+		s.point.Fields[field] = value
+		s.fields[field] = struct{}{}
+	}
+	s.rows[row] = struct{}{}
+	if point.Timestamp.After(s.point.Timestamp) {
+		s.point.Timestamp = point.Timestamp
+	}
+}
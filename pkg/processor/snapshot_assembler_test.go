@@ -0,0 +1,49 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"viot/models"
+)
+
+func TestSnapshotAssemblerKeepsLocationPhaseTag(t *testing.T) {
+	assembler := NewSnapshotAssembler(parseSnapshotConfig(map[string]interface{}{
+		"measurements": []interface{}{"pdu"},
+	}))
+	now := time.Unix(1700000000, 0)
+	tags := func(extra map[string]string) map[string]string {
+		result := map[string]string{"device": "pdu-01", "phase": "P3"}
+		for k, v := range extra {
+			result[k] = v
+		}
+		return result
+	}
+
+	// 位置標籤 phase 不是默認索引標籤，純量數據點不應被視為 phase 表格行
+	ready := assembler.Add([]models.PDUPoint{
+		{Name: "pdu", Tags: tags(nil), Fields: map[string]interface{}{"voltage": 220.0}, Timestamp: now},
+		{Name: "branch", Tags: tags(map[string]string{"branch_index": "1"}), Fields: map[string]interface{}{"current": 1.5}, Timestamp: now},
+		{Name: "phase", Tags: tags(map[string]string{"phase_index": "L1"}), Fields: map[string]interface{}{"current": 4.5}, Timestamp: now},
+	}, now)
+	if len(ready) != 0 {
+		t.Fatalf("所有數據點都應併入快照，實際直接輸出 %+v", ready)
+	}
+
+	snapshots := assembler.Flush()
+	if len(snapshots) != 1 {
+		t.Fatalf("應輸出 1 個快照，實際為 %d", len(snapshots))
+	}
+	snapshot := snapshots[0]
+	if snapshot.Tags["phase"] != "P3" {
+		t.Errorf("快照應保留位置標籤 phase=P3，實際標籤為 %v", snapshot.Tags)
+	}
+	if _, ok := snapshot.Tags["phase_index"]; ok {
+		t.Errorf("快照不應保留索引標籤，實際標籤為 %v", snapshot.Tags)
+	}
+	for _, field := range []string{"voltage", "branch_1_current", "phase_L1_current"} {
+		if _, ok := snapshot.Fields[field]; !ok {
+			t.Errorf("快照應包含字段 %s，實際字段為 %v", field, snapshot.Fields)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sqlDialect SQL 方言，處理識別符引用、參數佔位符與更新插入語句
+type sqlDialect interface {
+	// quote 引用識別符，表名可包含結構描述，如 dbo.Table
+	quote(ident string) string
+	// upsert 以 keys 為鍵更新或插入一行，參數依 keys、values 的順序
+	upsert(table string, keys, values []string) string
+	// createTable 建立快照表（已存在時不處理），鍵列為主鍵
+	createTable(table string, columns SQLColumns) string
+}
+
+// sqlDialects 依 database/sql 驅動名稱選擇方言
+var sqlDialects = map[string]sqlDialect{
+	"sqlserver": sqlServerDialect{},
+	"sqlite3":   sqliteDialect{},
+}
+
+// quoteParts 以 open、close 引用以 . 分隔的每個部分
+func quoteParts(ident, open, close string) string {
+	parts := strings.Split(ident, ".")
+	for i, part := range parts {
+		parts[i] = open + strings.ReplaceAll(part, close, close+close) + close
+	}
+	return strings.Join(parts, ".")
+}
+
+// sqlServerDialect SQL Server 方言，以 MERGE 更新插入
+type sqlServerDialect struct{}
+
+func (sqlServerDialect) quote(ident string) string {
+	return quoteParts(ident, "[", "]")
+}
+
+func (d sqlServerDialect) upsert(table string, keys, values []string) string {
+	var source, on, set, insert, insertValues []string
+	for i, column := range append(append([]string{}, keys...), values...) {
+		source = append(source, fmt.Sprintf("@p%d AS %s", i+1, d.quote(column)))
+		insert = append(insert, d.quote(column))
+		insertValues = append(insertValues, "s."+d.quote(column))
+	}
+	for _, key := range keys {
+		on = append(on, fmt.Sprintf("t.%s = s.%s", d.quote(key), d.quote(key)))
+	}
+	for _, value := range values {
+		set = append(set, fmt.Sprintf("t.%s = s.%s", d.quote(value), d.quote(value)))
+	}
+
+	return fmt.Sprintf("MERGE INTO %s WITH (HOLDLOCK) AS t USING (SELECT %s) AS s ON %s "+
+		"WHEN MATCHED THEN UPDATE SET %s "+
+		"WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s);",
+		d.quote(table), strings.Join(source, ", "), strings.Join(on, " AND "),
+		strings.Join(set, ", "), strings.Join(insert, ", "), strings.Join(insertValues, ", "))
+}
+
+func (d sqlServerDialect) createTable(table string, c SQLColumns) string {
+	return fmt.Sprintf("IF OBJECT_ID(N'%s', N'U') IS NULL CREATE TABLE %s ("+
+		"%s NVARCHAR(128) NOT NULL, %s NVARCHAR(32) NOT NULL, %s NVARCHAR(64) NOT NULL, %s FLOAT NULL, %s BIGINT NULL, "+
+		"PRIMARY KEY (%s, %s, %s))",
+		strings.ReplaceAll(table, "'", "''"), d.quote(table),
+		d.quote(c.Name), d.quote(c.Bank), d.quote(c.Type), d.quote(c.Value), d.quote(c.Timestamp),
+		d.quote(c.Name), d.quote(c.Bank), d.quote(c.Type))
+}
+
+// sqliteDialect SQLite 方言，以 ON CONFLICT 更新插入，需要鍵列上的唯一約束（見 createTable）
+type sqliteDialect struct{}
+
+func (sqliteDialect) quote(ident string) string {
+	return quoteParts(ident, `"`, `"`)
+}
+
+func (d sqliteDialect) upsert(table string, keys, values []string) string {
+	var columns, placeholders, conflict, set []string
+	for _, column := range append(append([]string{}, keys...), values...) {
+		columns = append(columns, d.quote(column))
+		placeholders = append(placeholders, "?")
+	}
+	for _, key := range keys {
+		conflict = append(conflict, d.quote(key))
+	}
+	for _, value := range values {
+		set = append(set, fmt.Sprintf("%s = excluded.%s", d.quote(value), d.quote(value)))
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s",
+		d.quote(table), strings.Join(columns, ", "), strings.Join(placeholders, ", "),
+		strings.Join(conflict, ", "), strings.Join(set, ", "))
+}
+
+func (d sqliteDialect) createTable(table string, c SQLColumns) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"%s TEXT NOT NULL, %s TEXT NOT NULL, %s TEXT NOT NULL, %s REAL, %s INTEGER, "+
+		"PRIMARY KEY (%s, %s, %s))",
+		d.quote(table),
+		d.quote(c.Name), d.quote(c.Bank), d.quote(c.Type), d.quote(c.Value), d.quote(c.Timestamp),
+		d.quote(c.Name), d.quote(c.Bank), d.quote(c.Type))
+}
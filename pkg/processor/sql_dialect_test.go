@@ -0,0 +1,70 @@
+package processor
+
+import "testing"
+
+func TestSQLDialectStatements(t *testing.T) {
+	columns := defaultSQLColumns
+	keys := []string{columns.Name, columns.Bank, columns.Type}
+	values := []string{columns.Value, columns.Timestamp}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{
+			"SQL Server 更新插入",
+			sqlServerDialect{}.upsert("dbo.PowerCollectorValue_RawData_PDU", keys, values),
+			"MERGE INTO [dbo].[PowerCollectorValue_RawData_PDU] WITH (HOLDLOCK) AS t USING " +
+				"(SELECT @p1 AS [PDU_NAME], @p2 AS [BANK], @p3 AS [TYPE], @p4 AS [VALUE], @p5 AS [TIME_STAMP]) AS s " +
+				"ON t.[PDU_NAME] = s.[PDU_NAME] AND t.[BANK] = s.[BANK] AND t.[TYPE] = s.[TYPE] " +
+				"WHEN MATCHED THEN UPDATE SET t.[VALUE] = s.[VALUE], t.[TIME_STAMP] = s.[TIME_STAMP] " +
+				"WHEN NOT MATCHED THEN INSERT ([PDU_NAME], [BANK], [TYPE], [VALUE], [TIME_STAMP]) " +
+				"VALUES (s.[PDU_NAME], s.[BANK], s.[TYPE], s.[VALUE], s.[TIME_STAMP]);",
+		},
+		{
+			"SQL Server 建表",
+			sqlServerDialect{}.createTable("dbo.O'Brien", columns),
+			"IF OBJECT_ID(N'dbo.O''Brien', N'U') IS NULL CREATE TABLE [dbo].[O'Brien] (" +
+				"[PDU_NAME] NVARCHAR(128) NOT NULL, [BANK] NVARCHAR(32) NOT NULL, [TYPE] NVARCHAR(64) NOT NULL, " +
+				"[VALUE] FLOAT NULL, [TIME_STAMP] BIGINT NULL, PRIMARY KEY ([PDU_NAME], [BANK], [TYPE]))",
+		},
+		{
+			"SQLite 更新插入",
+			sqliteDialect{}.upsert("snapshot", keys, values),
+			`INSERT INTO "snapshot" ("PDU_NAME", "BANK", "TYPE", "VALUE", "TIME_STAMP") VALUES (?, ?, ?, ?, ?) ` +
+				`ON CONFLICT ("PDU_NAME", "BANK", "TYPE") DO UPDATE SET "VALUE" = excluded."VALUE", "TIME_STAMP" = excluded."TIME_STAMP"`,
+		},
+		{
+			"SQLite 建表",
+			sqliteDialect{}.createTable("snapshot", columns),
+			`CREATE TABLE IF NOT EXISTS "snapshot" ("PDU_NAME" TEXT NOT NULL, "BANK" TEXT NOT NULL, "TYPE" TEXT NOT NULL, ` +
+				`"VALUE" REAL, "TIME_STAMP" INTEGER, PRIMARY KEY ("PDU_NAME", "BANK", "TYPE"))`,
+		},
+		{"SQL Server 引用", sqlServerDialect{}.quote("a]b"), "[a]]b]"},
+		{"SQLite 引用", sqliteDialect{}.quote(`main.a"b`), `"main"."a""b"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("語句不正確\n實際: %s\n應為: %s", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDULocationName(t *testing.T) {
+	tags := map[string]string{"factory": "F12", "phase": "P3", "datacenter": "DC1", "room": "R3", "rack": "R07", "side": "A"}
+	if name, ok := PDULocationName(tags); !ok || name != "F12P3DC1R3R07PA" {
+		t.Errorf("名稱應為 F12P3DC1R3R07PA，實際為 %q, %v", name, ok)
+	}
+
+	for _, missing := range append(append([]string{}, pduNameTags...), "side") {
+		partial := copyTags(tags)
+		delete(partial, missing)
+		if name, ok := PDULocationName(partial); ok {
+			t.Errorf("缺少 %s 標籤時不應組成名稱，實際為 %q", missing, name)
+		}
+	}
+}
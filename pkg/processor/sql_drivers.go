@@ -0,0 +1,7 @@
+package processor
+
+// SQL 快照輸出使用的 database/sql 驅動
+// sqlite3 驅動需要 cgo，只在以 -tags sqlite 建置時導入（見 sql_drivers_sqlite.go）
+import (
+	_ "github.com/microsoft/go-mssqldb"
+)
@@ -0,0 +1,8 @@
+//go:build sqlite
+
+package processor
+
+// SQLite 驅動（需要 cgo），用於本地測試快照輸出
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
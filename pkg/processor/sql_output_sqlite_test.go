@@ -0,0 +1,158 @@
+//go:build sqlite
+
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"viot/models"
+
+	"go.uber.org/zap"
+)
+
+// testSQLPDU 帶有完整位置標籤與兩個分支的 PDU 數據
+func testSQLPDU(seconds int64, current float64) models.PDUData {
+	return models.PDUData{
+		Name:      "pdu",
+		Timestamp: time.Unix(seconds, 0),
+		Tags:      map[string]string{"factory": "F12", "phase": "P3", "datacenter": "DC1", "room": "R3", "rack": "R07", "side": "A"},
+		Branches: []models.Branch{
+			{ID: "1", Current: current, Energy: 100, Power: 220},
+			{ID: "2", Current: current + 1, Energy: 200, Power: 440},
+		},
+	}
+}
+
+// sqlSnapshotRows 讀取快照表，返回 名稱/分支/類型 -> 數值
+func sqlSnapshotRows(t *testing.T, db *sql.DB) map[string]float64 {
+	t.Helper()
+	rows, err := db.Query(`SELECT "PDU_NAME", "BANK", "TYPE", "VALUE" FROM "snapshot"`)
+	if err != nil {
+		t.Fatalf("讀取快照表失敗: %v", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]float64)
+	for rows.Next() {
+		var name, bank, kind string
+		var value float64
+		if err := rows.Scan(&name, &bank, &kind, &value); err != nil {
+			t.Fatalf("讀取行失敗: %v", err)
+		}
+		result[name+"/"+bank+"/"+kind] = value
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("讀取快照表失敗: %v", err)
+	}
+	return result
+}
+
+func TestSQLOutputSQLiteUpsert(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "snapshot.db")
+	h, err := NewSQLOutputHandler(SQLOutputConfig{
+		Driver:      "sqlite3",
+		DSN:         dsn,
+		Table:       "snapshot",
+		Interval:    time.Hour,
+		CreateTable: true,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("創建SQL輸出處理程序失敗: %v", err)
+	}
+	defer h.Close()
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("打開資料庫失敗: %v", err)
+	}
+	defer db.Close()
+
+	// 缺少位置標籤的數據無法組成名稱，不寫入快照表
+	unnamed := testSQLPDU(100, 1)
+	delete(unnamed.Tags, "side")
+	ctx := context.Background()
+	if err := h.HandlePDUData(ctx, []models.PDUData{testSQLPDU(100, 1), unnamed}); err != nil {
+		t.Fatalf("處理數據失敗: %v", err)
+	}
+	if err := h.Flush(ctx); err != nil {
+		t.Fatalf("寫入快照表失敗: %v", err)
+	}
+	rows := sqlSnapshotRows(t, db)
+	if len(rows) != 6 || rows["F12P3DC1R3R07PA/1/branch_current"] != 1 || rows["F12P3DC1R3R07PA/2/branch_watt"] != 440 {
+		t.Fatalf("快照表應有 2 個分支各 3 個類型的行，實際為 %v", rows)
+	}
+	if stats := h.Stats(); stats.Skipped != 1 || stats.Rows != 6 {
+		t.Errorf("統計不正確: %+v", stats)
+	}
+
+	// 同一名稱、分支與類型只保留一行，數值更新為最新讀數
+	if err := h.HandlePDUData(ctx, []models.PDUData{testSQLPDU(200, 5)}); err != nil {
+		t.Fatalf("處理數據失敗: %v", err)
+	}
+	if err := h.Flush(ctx); err != nil {
+		t.Fatalf("寫入快照表失敗: %v", err)
+	}
+	rows = sqlSnapshotRows(t, db)
+	if len(rows) != 6 || rows["F12P3DC1R3R07PA/1/branch_current"] != 5 || rows["F12P3DC1R3R07PA/2/branch_current"] != 6 {
+		t.Fatalf("更新插入後應仍為 6 行並更新數值，實際為 %v", rows)
+	}
+}
+
+func TestSQLOutputSQLiteRetryAfterFailure(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "snapshot.db")
+	h, err := NewSQLOutputHandler(SQLOutputConfig{
+		Driver:      "sqlite3",
+		DSN:         dsn,
+		Table:       "snapshot",
+		Interval:    time.Hour,
+		CreateTable: true,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("創建SQL輸出處理程序失敗: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("打開資料庫失敗: %v", err)
+	}
+	defer db.Close()
+
+	// 快照表不存在時寫入失敗，讀數保留到下一次寫入
+	if _, err := db.Exec(`DROP TABLE "snapshot"`); err != nil {
+		t.Fatalf("刪除快照表失敗: %v", err)
+	}
+	ctx := context.Background()
+	if err := h.HandlePDUData(ctx, []models.PDUData{testSQLPDU(100, 1)}); err != nil {
+		t.Fatalf("處理數據失敗: %v", err)
+	}
+	if err := h.Flush(ctx); err == nil {
+		t.Fatal("快照表不存在時寫入應失敗")
+	}
+	if stats := h.Stats(); stats.Errors != 1 || stats.Pending != 1 || stats.LastError == "" {
+		t.Fatalf("寫入失敗後讀數應保留，實際統計為 %+v", stats)
+	}
+
+	if _, err := db.Exec(sqliteDialect{}.createTable("snapshot", defaultSQLColumns)); err != nil {
+		t.Fatalf("建立快照表失敗: %v", err)
+	}
+	if err := h.Flush(ctx); err != nil {
+		t.Fatalf("重新寫入失敗: %v", err)
+	}
+	if rows := sqlSnapshotRows(t, db); len(rows) != 6 {
+		t.Fatalf("重新寫入後快照表應有 6 行，實際為 %v", rows)
+	}
+	if stats := h.Stats(); stats.Pending != 0 || stats.Flushes != 1 {
+		t.Errorf("統計不正確: %+v", stats)
+	}
+
+	if err := h.Close(); err != nil {
+		t.Fatalf("關閉失敗: %v", err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("重複關閉不應返回錯誤: %v", err)
+	}
+}
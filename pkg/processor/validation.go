@@ -0,0 +1,174 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"viot/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ValidationDrop 未通過驗證的數據丟棄
+	ValidationDrop = "drop"
+	// ValidationFlag 未通過驗證的數據標記後仍輸出
+	ValidationFlag = "flag"
+
+	// ValidationTag 標記未通過驗證數據的標籤
+	ValidationTag = "validation"
+)
+
+// ErrQuarantined 數據未通過驗證且已被丟棄
+var ErrQuarantined = errors.New("數據未通過驗證，已寫入隔離區")
+
+// assignedField 已解析並套用比例因子的字段
+type assignedField struct {
+	Name  FieldName
+	Value float64
+}
+
+// Violation 違反的驗證規則
+type Violation struct {
+	Field string  `json:"field"`
+	Rule  string  `json:"rule"` // min、max、rate 或 required
+	Value float64 `json:"value"`
+	Limit float64 `json:"limit"`
+}
+
+// String 返回違規說明
+func (v Violation) String() string {
+	switch v.Rule {
+	case "min":
+		return fmt.Sprintf("%s=%g 低於下限 %g", v.Field, v.Value, v.Limit)
+	case "max":
+		return fmt.Sprintf("%s=%g 超過上限 %g", v.Field, v.Value, v.Limit)
+	case "rate":
+		return fmt.Sprintf("%s 每秒變化 %g 超過 %g", v.Field, v.Value, v.Limit)
+	case "required":
+		return fmt.Sprintf("缺少必需字段 %s", v.Field)
+	}
+	return fmt.Sprintf("%s 違反規則 %s", v.Field, v.Rule)
+}
+
+// validationOptions 處理器選項中的驗證設置
+type validationOptions struct {
+	models.PDUValidation `yaml:",inline"`
+	QuarantineFile       string `yaml:"quarantine_file"`
+	QuarantineMaxSize    int64  `yaml:"quarantine_max_size"`
+}
+
+// parseValidationOptions 將處理器選項轉換為驗證設置
+func parseValidationOptions(options interface{}) (validationOptions, error) {
+	var result validationOptions
+	data, err := yaml.Marshal(options)
+	if err != nil {
+		return result, err
+	}
+	if err := yaml.Unmarshal(data, &result); err != nil {
+		return result, fmt.Errorf("解析驗證設置失敗: %w", err)
+	}
+	return result, nil
+}
+
+// rateSample 變化率計算使用的上一個讀數
+type rateSample struct {
+	value float64
+	ts    time.Time
+}
+
+// Validator 依型號驗證規則檢查數據的上下限、變化率與必需字段
+// 變化率以同一設備同一字段的上一個讀數為基準，每個字段的基準各自更新；
+// 超出變化率的讀數仍會前移基準，單一突變不會使之後的讀數一直被判為違規，
+// 超出上下限的讀數則不會成為基準，避免錯誤讀數使之後的正常讀數被判為突變
+type Validator struct {
+	mutex sync.Mutex
+	last  map[string]rateSample
+}
+
+// NewValidator 創建驗證器
+func NewValidator() *Validator {
+	return &Validator{
+		last: make(map[string]rateSample),
+	}
+}
+
+// Validate 驗證設備的字段，返回所有違規，並以較新且未超出上下限的讀數更新各字段的變化率基準
+func (v *Validator) Validate(device string, ts time.Time, fields []assignedField, rules *models.PDUValidation) []Violation {
+	var violations []Violation
+
+	present := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		present[f.Name.Canonical()] = struct{}{}
+	}
+	for _, field := range rules.Required {
+		if _, ok := present[field]; !ok {
+			violations = append(violations, Violation{Field: field, Rule: "required"})
+		}
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	for _, f := range fields {
+		field := f.Name.Canonical()
+
+		outOfBounds := false
+		if bound, ok := lookupRule(rules.Bounds, f.Name); ok {
+			if bound.Min != nil && f.Value < *bound.Min {
+				violations = append(violations, Violation{Field: field, Rule: "min", Value: f.Value, Limit: *bound.Min})
+				outOfBounds = true
+			}
+			if bound.Max != nil && f.Value > *bound.Max {
+				violations = append(violations, Violation{Field: field, Rule: "max", Value: f.Value, Limit: *bound.Max})
+				outOfBounds = true
+			}
+		}
+
+		limit, ok := lookupRule(rules.MaxRate, f.Name)
+		if !ok {
+			continue
+		}
+		key := device + "/" + field
+		last, seen := v.last[key]
+		if seen && !ts.After(last.ts) {
+			// 亂序或重複的讀數不計算變化率，也不回退基準
+			continue
+		}
+		if seen {
+			rate := math.Abs(f.Value-last.value) / ts.Sub(last.ts).Seconds()
+			if rate > limit {
+				violations = append(violations, Violation{Field: field, Rule: "rate", Value: rate, Limit: limit})
+			}
+		}
+		if outOfBounds {
+			// 超出上下限的讀數仍與基準比較變化率，但不取代基準
+			continue
+		}
+		v.last[key] = rateSample{value: f.Value, ts: ts}
+	}
+
+	return violations
+}
+
+// lookupRule 依 <scope>.<quantity>、<quantity> 的順序查找規則
+func lookupRule[T any](rules map[string]T, name FieldName) (T, bool) {
+	if rule, ok := rules[string(name.Scope)+"."+name.Quantity]; ok {
+		return rule, true
+	}
+	rule, ok := rules[name.Quantity]
+	return rule, ok
+}
+
+// violationSummary 將違規合併為一行說明
+func violationSummary(violations []Violation) string {
+	parts := make([]string, 0, len(violations))
+	for _, v := range violations {
+		parts = append(parts, v.String())
+	}
+	return strings.Join(parts, "; ")
+}
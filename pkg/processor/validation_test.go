@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"viot/models"
+)
+
+func TestValidatorOutOfBoundsKeepsRateBaseline(t *testing.T) {
+	maxCurrent := 32.0
+	rules := &models.PDUValidation{
+		Bounds:  map[string]models.PDUBound{"current": {Max: &maxCurrent}},
+		MaxRate: map[string]float64{"current": 5},
+	}
+	validator := NewValidator()
+	start := time.Unix(1700000000, 0)
+	current := func(value float64) []assignedField {
+		return []assignedField{{Name: FieldName{Scope: ScopeTotal, Quantity: "current"}, Value: value}}
+	}
+
+	tests := []struct {
+		name  string
+		value float64
+		rules []string
+	}{
+		{"正常讀數", 10, nil},
+		{"超出上限", 999, []string{"max", "rate"}},
+		// 基準仍為 10，恢復正常的讀數不應被判為突變
+		{"恢復正常", 11, nil},
+		{"突變", 30, []string{"rate"}},
+		// 突變的讀數仍成為基準
+		{"突變後", 31, nil},
+	}
+
+	for i, tt := range tests {
+		violations := validator.Validate("pdu-01", start.Add(time.Duration(i)*time.Second), current(tt.value), rules)
+		if len(violations) != len(tt.rules) {
+			t.Fatalf("%s: 應有 %d 個違規，實際為 %+v", tt.name, len(tt.rules), violations)
+		}
+		for j, rule := range tt.rules {
+			if violations[j].Rule != rule {
+				t.Errorf("%s: 第 %d 個違規應為 %s，實際為 %+v", tt.name, j+1, rule, violations[j])
+			}
+		}
+	}
+}
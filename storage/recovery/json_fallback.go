@@ -46,14 +46,26 @@ func NewJSONFallbackStrategy(basePath string, logger logger.Logger) *JSONFallbac
 	}
 }
 
+// backupFilename 生成不重複的備份文件名，時間戳精確到納秒，同名文件已存在時加上序號
+// 同一秒內多次保存時不會覆蓋之前的備份，調用方須持有對應類型的鎖
+func (j *JSONFallbackStrategy) backupFilename(kind, filename string) string {
+	timestamp := time.Now().Format("20060102-150405.000000000")
+	base := fmt.Sprintf("%s_%s", filepath.Base(filename), timestamp)
+	backupFilename := base + ".json"
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filepath.Join(j.basePath, "backup", kind, backupFilename)); os.IsNotExist(err) {
+			return backupFilename
+		}
+		backupFilename = fmt.Sprintf("%s-%d.json", base, i)
+	}
+}
+
 // SavePDUData 將PDU數據保存到JSON備份文件
 func (j *JSONFallbackStrategy) SavePDUData(filename string, data []models.PDUData) error {
 	j.pduDataMutex.Lock()
 	defer j.pduDataMutex.Unlock()
 
-	// 格式化時間戳，用於文件名
-	timestamp := time.Now().Format("20060102-150405")
-	backupFilename := fmt.Sprintf("%s_%s.json", filepath.Base(filename), timestamp)
+	backupFilename := j.backupFilename("pdu", filename)
 	backupPath := filepath.Join(j.basePath, "backup", "pdu", backupFilename)
 
 	// 建立備份索引文件
@@ -115,9 +127,7 @@ func (j *JSONFallbackStrategy) SaveDeviceData(filename string, data []models.Dev
 	j.acRackMutex.Lock()
 	defer j.acRackMutex.Unlock()
 
-	// 格式化時間戳，用於文件名
-	timestamp := time.Now().Format("20060102-150405")
-	backupFilename := fmt.Sprintf("%s_%s.json", filepath.Base(filename), timestamp)
+	backupFilename := j.backupFilename("acrack", filename)
 	backupPath := filepath.Join(j.basePath, "backup", "acrack", backupFilename)
 
 	// 建立備份索引文件